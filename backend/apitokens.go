@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// apiTokenPrefix marks personal API tokens so they are told apart from
+	// access tokens and are easy to spot in leaked config
+	apiTokenPrefix = "noet_"
+
+	apiTokenNameMax = 100
+	apiTokensMax    = 50
+
+	// apiTokenTouchInterval limits last-used writes to one a minute
+	apiTokenTouchInterval = time.Minute
+)
+
+// Scopes an API token can be granted. The owner's role still applies.
+const (
+	scopePostsRead     = "posts:read"
+	scopePostsWrite    = "posts:write"
+	scopeUploadsWrite  = "uploads:write"
+	scopeSettingsWrite = "settings:write"
+)
+
+var apiTokenScopes = []string{scopePostsRead, scopePostsWrite, scopeUploadsWrite, scopeSettingsWrite}
+
+var (
+	errAPITokenInvalid  = errors.New("invalid API token")
+	errAPITokenNotFound = errors.New("API token not found")
+	errAPITokenTooMany  = errors.New("too many API tokens")
+)
+
+// APIToken is a named personal token as listed to its owner; the secret
+// itself is only returned once, on creation
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// hasScope reports whether a request may use scope. Session tokens carry
+// every scope; API tokens only those they were granted.
+func (c *Claims) hasScope(scope string) bool {
+	if c.TokenID == 0 {
+		return true
+	}
+	return scope != "" && slices.Contains(c.Scopes, scope)
+}
+
+// apiTokenScope returns the scope an API token needs for a request, or ""
+// for endpoints that need a signed-in session, such as account management
+func apiTokenScope(r *http.Request) string {
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/api/posts"), path == "/api/tags", path == "/api/search":
+		if read {
+			return scopePostsRead
+		}
+		return scopePostsWrite
+	case strings.HasPrefix(path, "/api/uploads"):
+		return scopeUploadsWrite
+	case strings.HasPrefix(path, "/api/settings"), path == "/api/about":
+		if read {
+			return scopePostsRead
+		}
+		return scopeSettingsWrite
+	}
+	return ""
+}
+
+// normalizeScopes validates requested scopes and returns them sorted and
+// without duplicates
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	out := []string{}
+	for _, s := range scopes {
+		if !slices.Contains(apiTokenScopes, s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// validateBearerToken accepts either a session access token or a personal
+// API token
+func (a *App) validateBearerToken(token string) (*Claims, error) {
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return a.validateAPIToken(token)
+	}
+	return a.validateJWT(token)
+}
+
+// validateAPIToken looks up an API token by its hash and returns claims for
+// its owner, recording when it was last used
+func (a *App) validateAPIToken(token string) (*Claims, error) {
+	var claims Claims
+	var scopes string
+	var expiresAt, lastUsed sql.NullTime
+	err := a.DB.QueryRow(`
+        SELECT t.id, t.scopes, t.expires_at, t.last_used_at, u.id, u.username, u.role
+        FROM api_tokens t JOIN users u ON u.id = t.user_id
+        WHERE t.token_hash = ?`, hashRefreshToken(token)).
+		Scan(&claims.TokenID, &scopes, &expiresAt, &lastUsed, &claims.UserID, &claims.Username, &claims.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errAPITokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if expiresAt.Valid && !expiresAt.Time.After(now) {
+		return nil, errAPITokenInvalid
+	}
+	if err := json.Unmarshal([]byte(scopes), &claims.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode token scopes: %v", err)
+	}
+
+	if !lastUsed.Valid || now.Sub(lastUsed.Time) > apiTokenTouchInterval {
+		_, _ = a.DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now, claims.TokenID)
+	}
+	return &claims, nil
+}
+
+// createAPIToken issues a token for userID and returns it with the secret,
+// which is not stored
+func (a *App) createAPIToken(userID int64, name string, scopes []string, ttl time.Duration) (APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > apiTokenNameMax {
+		return APIToken{}, "", fmt.Errorf("name is required and must be at most %d characters", apiTokenNameMax)
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	var count int
+	if err := a.DB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return APIToken{}, "", err
+	}
+	if count >= apiTokensMax {
+		return APIToken{}, "", errAPITokenTooMany
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIToken{}, "", err
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	t := APIToken{
+		Name:      name,
+		Prefix:    token[:len(apiTokenPrefix)+6],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expires := t.CreatedAt.Add(ttl)
+		t.ExpiresAt = &expires
+	}
+	scopesJSON, _ := json.Marshal(scopes)
+	res, err := a.DB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, t.Name, hashRefreshToken(token), t.Prefix, string(scopesJSON), t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return APIToken{}, "", fmt.Errorf("failed to store API token: %v", err)
+	}
+	t.ID, _ = res.LastInsertId()
+	return t, token, nil
+}
+
+// listAPITokens returns a user's tokens, newest first
+func (a *App) listAPITokens(userID int64) ([]APIToken, error) {
+	rows, err := a.DB.Query(`
+        SELECT id, name, prefix, scopes, created_at, last_used_at, expires_at
+        FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		var lastUsed, expires sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &t.CreatedAt, &lastUsed, &expires); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(scopes), &t.Scopes); err != nil {
+			return nil, fmt.Errorf("failed to decode token scopes: %v", err)
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		if expires.Valid {
+			t.ExpiresAt = &expires.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// handleAPITokens lists the caller's API tokens and creates new ones
+func (a *App) handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			tokens, err := a.listAPITokens(requestClaims(r).UserID)
+			if err != nil {
+				a.Logger.Error("Failed to list API tokens", "error", err.Error())
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(tokens)
+		})(w, r)
+	case http.MethodPost:
+		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			var payload struct {
+				Name          string   `json:"name"`
+				Scopes        []string `json:"scopes"`
+				ExpiresInDays int      `json:"expiresInDays"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if payload.ExpiresInDays < 0 || payload.ExpiresInDays > 3650 {
+				http.Error(w, "expiresInDays must be between 0 (never) and 3650", http.StatusBadRequest)
+				return
+			}
+
+			claims := requestClaims(r)
+			ttl := time.Duration(payload.ExpiresInDays) * 24 * time.Hour
+			t, token, err := a.createAPIToken(claims.UserID, payload.Name, payload.Scopes, ttl)
+			if errors.Is(err, errAPITokenTooMany) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			a.Logger.Info("API token created", "userID", claims.UserID, "tokenID", t.ID, "scopes", strings.Join(t.Scopes, " "))
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"token":    token,
+				"apiToken": t,
+			})
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAPIToken revokes one of the caller's API tokens
+func (a *App) handleAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid token id", http.StatusBadRequest)
+			return
+		}
+		claims := requestClaims(r)
+		res, err := a.DB.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, claims.UserID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, errAPITokenNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		a.Logger.Info("API token revoked", "userID", claims.UserID, "tokenID", id)
+		w.WriteHeader(http.StatusNoContent)
+	})(w, r)
+}
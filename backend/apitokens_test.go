@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// createTestAPIToken issues an API token through the management endpoint
+func createTestAPIToken(t *testing.T, baseURL, session, scopes string) (string, APIToken) {
+	t.Helper()
+	status, body := doJSON(t, http.MethodPost, baseURL+"/api/tokens", session, `{"name":"CI","scopes":`+scopes+`}`)
+	var out struct {
+		Token    string   `json:"token"`
+		APIToken APIToken `json:"apiToken"`
+	}
+	_ = json.Unmarshal(body, &out)
+	if status != http.StatusCreated || !strings.HasPrefix(out.Token, apiTokenPrefix) {
+		t.Fatalf("create token: %d %s", status, body)
+	}
+	return out.Token, out.APIToken
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	session := registerTestUser(t, srv.URL)
+
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/tokens", session, `{"name":"CI","scopes":["posts:admin"]}`); status != http.StatusBadRequest {
+		t.Fatalf("unknown scope accepted: %d", status)
+	}
+	writer, _ := createTestAPIToken(t, srv.URL, session, `["posts:write","posts:read","posts:write"]`)
+	reader, readerInfo := createTestAPIToken(t, srv.URL, session, `["posts:read"]`)
+
+	if status, body := doJSON(t, http.MethodPost, srv.URL+"/api/posts", writer, ""); status != http.StatusCreated {
+		t.Fatalf("create post with API token: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/posts", reader, ""); status != http.StatusForbidden {
+		t.Fatalf("read-only token created a post: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/posts", reader, ""); status != http.StatusOK {
+		t.Fatalf("list posts with API token: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/settings", writer, `{"key":"siteTitle","value":"x"}`); status != http.StatusForbidden {
+		t.Fatalf("token without settings:write changed settings: %d", status)
+	}
+	// Account management needs a real session
+	for _, path := range []string{"/api/tokens", "/api/auth/sessions", "/api/users"} {
+		if status, _ := doJSON(t, http.MethodGet, srv.URL+path, writer, ""); status != http.StatusForbidden {
+			t.Fatalf("API token reached %s: %d", path, status)
+		}
+	}
+
+	status, body := doJSON(t, http.MethodGet, srv.URL+"/api/tokens", session, "")
+	var tokens []APIToken
+	_ = json.Unmarshal(body, &tokens)
+	if status != http.StatusOK || len(tokens) != 2 || strings.Contains(string(body), writer) {
+		t.Fatalf("list tokens: %d %s", status, body)
+	}
+	for _, tok := range tokens {
+		if tok.LastUsedAt == nil {
+			t.Fatalf("token not marked as used: %+v", tok)
+		}
+	}
+	if len(tokens[1].Scopes) != 2 {
+		t.Fatalf("duplicate scopes kept: %v", tokens[1].Scopes)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/tokens/"+itoa(readerInfo.ID), session, ""); status != http.StatusNoContent {
+		t.Fatalf("revoke token: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", reader, ""); status != http.StatusUnauthorized {
+		t.Fatalf("revoked token still accepted: %d", status)
+	}
+}
@@ -2,11 +2,9 @@ package main
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/sha256"
+	"context"
 	"database/sql"
 	"embed"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,10 +14,13 @@ import (
 	"log/slog"
 	"mime"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -42,29 +43,64 @@ type CacheItem struct {
 }
 
 type App struct {
-	DB        *sql.DB
-	Mux       *http.ServeMux
-	JWTSecret []byte
-	Logger    *slog.Logger
+	DB     *sql.DB
+	Mux    *http.ServeMux
+	Logger *slog.Logger
 
 	// Simple in-memory cache
 	cacheMu sync.RWMutex
 	cache   map[string]CacheItem
+
+	// Live post change events for SSE subscribers
+	events *postBroker
+
+	// Background publication of scheduled posts
+	scheduler *publishScheduler
+
+	// Public base URL from NOET_BASE_URL and the proxies allowed to set
+	// X-Forwarded-* headers
+	baseURL        string
+	trustedProxies []netip.Prefix
+
+	// Minimum strength for new passwords
+	passwordPolicy passwordPolicy
+
+	// Access token lifetime and the HS256 keys that sign them
+	tokens  tokenConfig
+	jwtKeys jwtKeyring
+
+	// Backoff and lockout after failed logins
+	limiter *authLimiter
+
+	// Where uploaded files are kept, and how much may be stored
+	blobs        blobStore
+	uploadLimits uploadLimits
+
+	// URLs per sitemap file before the sitemap is split
+	sitemapPageSize int
 }
 
 type Post struct {
-	ID        int64     `json:"id"`
-	Title     *string   `json:"title,omitempty"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	IsPrivate bool      `json:"isPrivate"`
+	ID        int64      `json:"id"`
+	Title     *string    `json:"title,omitempty"`
+	Slug      string     `json:"slug,omitempty"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	IsPrivate bool       `json:"isPrivate"`
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	// PublishedAt records the first publication and never moves afterwards
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	// AuthorID is nil for posts whose author account was deleted
+	AuthorID *int64 `json:"authorId,omitempty"`
 }
 
 type User struct {
 	ID           int64     `json:"id"`
 	Username     string    `json:"username"`
 	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"createdAt"`
 }
 
@@ -75,11 +111,21 @@ type Attachment struct {
 	MimeType     string    `json:"mimeType"`
 	Size         int64     `json:"size"`
 	CreatedAt    time.Time `json:"createdAt"`
+
+	// Pixel dimensions and resized copies, for images
+	Width    int            `json:"width,omitempty"`
+	Height   int            `json:"height,omitempty"`
+	Variants []ImageVariant `json:"variants,omitempty"`
 }
 
 type Claims struct {
-	UserID   int64  `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID int64  `json:"sid"`
+	// TokenID and Scopes are set for requests made with an API token
+	TokenID int64    `json:"-"`
+	Scopes  []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -88,6 +134,7 @@ type siteSettings struct {
 	IntroText    string `json:"introText"`
 	HeroImage    string `json:"heroImage"`
 	AboutEnabled bool   `json:"aboutEnabled"`
+	AuthorName   string `json:"authorName"`
 }
 
 type pageMeta struct {
@@ -98,6 +145,7 @@ type pageMeta struct {
 
 type renderPostItem struct {
 	ID    int64
+	Path  string
 	Title string
 	Date  string
 }
@@ -124,6 +172,7 @@ type pageRender struct {
 	body     string
 	meta     pageMeta
 	status   int
+	redirect string
 	hydrate  map[string]any
 	metaTags []metaTag
 	linkTags []linkTag
@@ -140,6 +189,7 @@ var (
         <a class="header-button" href="/">Home</a>
         <a class="header-button" href="/archive">Archive</a>
         {{if .AboutEnabled}}<a class="header-button" href="/about">About Me</a>{{end}}
+        <a class="header-button" href="/search">Search</a>
         <a class="header-button" href="/rss.xml">RSS</a>
       </nav>
     </div>
@@ -159,7 +209,7 @@ var (
       <ul class="post-list">
         {{range .Posts}}
         <li>
-          <a class="post-link" href="/posts/{{.ID}}">
+          <a class="post-link" href="{{.Path}}">
             <span class="post-title">{{.Title}}</span>
             <span class="post-meta"> — {{.Date}}</span>
           </a>
@@ -185,17 +235,19 @@ var (
         <a class="header-button" href="/">Home</a>
         <a class="header-button" href="/archive">Archive</a>
         {{if .AboutEnabled}}<a class="header-button" href="/about">About Me</a>{{end}}
+        <a class="header-button" href="/search">Search</a>
         <a class="header-button" href="/rss.xml">RSS</a>
       </nav>
     </div>
   </header>
   <main class="home-content">
-    <h1>Archive</h1>
+    <h1>{{.Heading}}</h1>
+    {{if .FeedPath}}<p class="post-meta"><a href="{{.FeedPath}}">RSS feed</a></p>{{end}}
     {{if .Posts}}
     <ul class="post-list">
       {{range .Posts}}
       <li>
-        <a class="post-link" href="/posts/{{.ID}}">
+        <a class="post-link" href="{{.Path}}">
           <span class="post-title">{{.Title}}</span>
           <span class="post-meta"> — {{.Date}}</span>
         </a>
@@ -217,6 +269,7 @@ var (
         <a class="header-button" href="/">Home</a>
         <a class="header-button" href="/archive">Archive</a>
         {{if .AboutEnabled}}<a class="header-button" href="/about">About Me</a>{{end}}
+        <a class="header-button" href="/search">Search</a>
         <a class="header-button" href="/rss.xml">RSS</a>
       </nav>
     </div>
@@ -225,8 +278,9 @@ var (
     <main>
       <article class="ssr-post">
         <h1 class="post-title">{{.Title}}</h1>
-        <div class="post-meta">{{.Date}}</div>
+        <div class="post-meta">{{.Date}}{{if .AuthorName}} · <a class="post-author" href="{{.AuthorPath}}" rel="author">{{.AuthorName}}</a>{{end}}</div>
         <div class="post-content">{{.Content}}</div>
+        {{if .Tags}}<p class="post-tags">{{range .Tags}}<a class="post-tag" href="/tags/{{.}}">#{{.}}</a> {{end}}</p>{{end}}
       </article>
     </main>
   </div>
@@ -241,6 +295,7 @@ var (
         <a class="header-button" href="/">Home</a>
         <a class="header-button" href="/archive">Archive</a>
         {{if .AboutEnabled}}<a class="header-button" href="/about">About Me</a>{{end}}
+        <a class="header-button" href="/search">Search</a>
         <a class="header-button" href="/rss.xml">RSS</a>
       </nav>
     </div>
@@ -285,6 +340,9 @@ func (a *App) Handler() http.Handler {
 
 // Close closes the database connection gracefully
 func (a *App) Close() error {
+	if a.scheduler != nil {
+		a.scheduler.shutdown()
+	}
 	if a.DB != nil {
 		// Force final WAL checkpoint before closing
 		if _, err := a.DB.Exec(`PRAGMA wal_checkpoint(TRUNCATE);`); err != nil {
@@ -296,21 +354,23 @@ func (a *App) Close() error {
 }
 
 func NewApp(dbPath string) (*App, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	// Pragmas for reliability and performance. They go in the DSN so every
+	// pooled connection gets them: foreign_keys in particular is
+	// per-connection, and deletes rely on its cascades.
+	pragmas := url.Values{"_pragma": {
+		"busy_timeout(5000)",
+		"journal_mode(WAL)",
+		"foreign_keys(1)",
+		"synchronous(NORMAL)",
+		"cache_size(10000)",
+		"temp_store(memory)",
+		"mmap_size(268435456)",
+	}}
+	db, err := sql.Open("sqlite", dbPath+"?"+pragmas.Encode())
 	if err != nil {
 		return nil, err
 	}
-	// Pragmas for reliability and performance
-	pragmas := `
-        PRAGMA journal_mode=WAL;
-        PRAGMA foreign_keys=ON;
-        PRAGMA synchronous=NORMAL;
-        PRAGMA cache_size=10000;
-        PRAGMA busy_timeout=5000;
-        PRAGMA temp_store=memory;
-        PRAGMA mmap_size=268435456;
-    `
-	if _, err := db.Exec(pragmas); err != nil {
+	if err := db.Ping(); err != nil {
 		return nil, err
 	}
 
@@ -337,12 +397,6 @@ func NewApp(dbPath string) (*App, error) {
 		}
 	}
 
-	// Get or generate persistent JWT secret
-	jwtSecret, err := getOrCreateJWTSecret(db)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get JWT secret: %v", err)
-	}
-
 	// Initialize logger with database-stored log level
 	logger, err := initLogger(db)
 	if err != nil {
@@ -352,9 +406,32 @@ func NewApp(dbPath string) (*App, error) {
 	a := &App{
 		DB:        db,
 		Mux:       http.NewServeMux(),
-		JWTSecret: jwtSecret,
 		Logger:    logger,
 		cache:     make(map[string]CacheItem),
+		events:    newPostBroker(),
+		scheduler: newPublishScheduler(),
+		limiter:   newAuthLimiter(),
+
+		sitemapPageSize: sitemapPageSize,
+	}
+	if err := a.loadSiteURLConfig(); err != nil {
+		return nil, err
+	}
+	if err := a.loadPasswordPolicy(); err != nil {
+		return nil, err
+	}
+	if err := a.loadTokenConfig(); err != nil {
+		return nil, err
+	}
+	if err := a.loadBlobStore(dbPath); err != nil {
+		return nil, err
+	}
+	if err := a.loadUploadLimits(); err != nil {
+		return nil, err
+	}
+	// Get or generate persistent JWT signing keys
+	if err := a.initJWTKeys(); err != nil {
+		return nil, fmt.Errorf("failed to get JWT secret: %v", err)
 	}
 
 	a.Logger.Info("Application initialized successfully", "dbPath", dbPath)
@@ -365,6 +442,12 @@ func NewApp(dbPath string) (*App, error) {
 		// Don't fail app startup, just log the error
 	}
 
+	// Bring the full-text index in line with posts; search degrades
+	// rather than blocking startup if this fails
+	if err := rebuildSearchIndex(db); err != nil {
+		a.Logger.Error("Failed to rebuild search index", "error", err)
+	}
+
 	a.routes()
 	return a, nil
 }
@@ -377,7 +460,11 @@ CREATE TABLE IF NOT EXISTS posts (
   content TEXT NOT NULL DEFAULT '',
   created_at DATETIME NOT NULL,
   updated_at DATETIME NOT NULL,
-  is_private BOOLEAN NOT NULL DEFAULT 1
+  is_private BOOLEAN NOT NULL DEFAULT 1,
+  slug TEXT NULL,
+  publish_at DATETIME NULL,
+  published_at DATETIME NULL,
+  author_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL
 );
 
 CREATE TABLE IF NOT EXISTS settings (
@@ -390,6 +477,110 @@ CREATE TABLE IF NOT EXISTS users (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   username TEXT UNIQUE NOT NULL,
   password_hash TEXT NOT NULL,
+  role TEXT NOT NULL DEFAULT 'viewer',
+  display_name TEXT NOT NULL DEFAULT '',
+  bio TEXT NOT NULL DEFAULT '',
+  avatar TEXT NOT NULL DEFAULT '',
+  links TEXT NOT NULL DEFAULT '[]',
+  totp_secret TEXT NOT NULL DEFAULT '',
+  totp_enabled INTEGER NOT NULL DEFAULT 0,
+  totp_last_step INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL
+);
+
+-- Single-use recovery codes for two-factor authentication, stored hashed
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME NULL,
+  created_at DATETIME NOT NULL
+);
+
+-- Password logins waiting for their second factor
+CREATE TABLE IF NOT EXISTS login_challenges (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT UNIQUE NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+
+-- WebAuthn passkeys; public_key holds the COSE key, base64 encoded
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  credential_id TEXT UNIQUE NOT NULL,
+  public_key TEXT NOT NULL,
+  sign_count INTEGER NOT NULL DEFAULT 0,
+  name TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  last_used_at DATETIME NULL
+);
+
+-- Single-use challenges for passkey registration (user_id set) and login
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  challenge_hash TEXT UNIQUE NOT NULL,
+  user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+
+-- Failed logins, refreshes and setup attempts, kept for auditing
+CREATE TABLE IF NOT EXISTS auth_failures (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  kind TEXT NOT NULL,
+  username TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  reason TEXT NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_auth_failures_created ON auth_failures(created_at);
+
+-- Personal API tokens for scripts; only a hash of the token is stored
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT UNIQUE NOT NULL,
+  prefix TEXT NOT NULL,
+  scopes TEXT NOT NULL DEFAULT '[]',
+  created_at DATETIME NOT NULL,
+  last_used_at DATETIME NULL,
+  expires_at DATETIME NULL
+);
+
+-- One-time invitations; only a hash of the token is stored
+CREATE TABLE IF NOT EXISTS invitations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  token_hash TEXT UNIQUE NOT NULL,
+  role TEXT NOT NULL,
+  created_by INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL,
+  used_at DATETIME NULL,
+  used_by INTEGER NULL REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- HS256 keys for access tokens, looked up by the kid header. Retired keys
+-- verify tokens for a grace window after rotation.
+CREATE TABLE IF NOT EXISTS jwt_keys (
+  kid TEXT PRIMARY KEY,
+  secret TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  retired_at DATETIME NULL
+);
+
+-- One-time password reset links from the reset-password command
+CREATE TABLE IF NOT EXISTS password_resets (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT UNIQUE NOT NULL,
+  expires_at DATETIME NOT NULL,
   created_at DATETIME NOT NULL
 );
 
@@ -399,6 +590,9 @@ CREATE TABLE IF NOT EXISTS attachments (
   original_name TEXT NOT NULL,
   mime_type TEXT NOT NULL,
   size INTEGER NOT NULL,
+  width INTEGER NOT NULL DEFAULT 0,
+  height INTEGER NOT NULL DEFAULT 0,
+  variants TEXT NOT NULL DEFAULT '[]',
   created_at DATETIME NOT NULL
 );
 
@@ -408,6 +602,9 @@ CREATE TABLE IF NOT EXISTS refresh_tokens (
   token_hash TEXT UNIQUE NOT NULL,
   expires_at DATETIME NOT NULL,
   created_at DATETIME NOT NULL,
+  last_used_at DATETIME NULL,
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
   FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
@@ -424,6 +621,50 @@ CREATE TABLE IF NOT EXISTS post_links (
 CREATE INDEX IF NOT EXISTS idx_post_links_source ON post_links(source_post_id);
 CREATE INDEX IF NOT EXISTS idx_post_links_target ON post_links(target_post_id);
 
+CREATE TABLE IF NOT EXISTS post_slug_redirects (
+  slug TEXT PRIMARY KEY,
+  post_id INTEGER NOT NULL,
+  created_at DATETIME NOT NULL,
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  post_id INTEGER NOT NULL,
+  title TEXT NULL,
+  content TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON post_revisions(post_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT UNIQUE NOT NULL,
+  created_at DATETIME NOT NULL
+);
+
+-- source is 'explicit' (set through the API) or 'content' (#hashtag nodes)
+CREATE TABLE IF NOT EXISTS post_tags (
+  post_id INTEGER NOT NULL,
+  tag_id INTEGER NOT NULL,
+  source TEXT NOT NULL,
+  PRIMARY KEY (post_id, tag_id, source),
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(tag_id);
+
+-- Full-text search over post titles and plain-text bodies, keyed by post id
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+  title,
+  body,
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
 -- Performance indexes for posts table
 CREATE INDEX IF NOT EXISTS idx_posts_updated_at ON posts(updated_at DESC);
 CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at DESC);
@@ -446,11 +687,125 @@ func runMigrations(db *sql.DB) error {
 		}
 	}
 
+	// Check if slug column exists
+	row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('posts') WHERE name='slug'`)
+	if err := row.Scan(&count); err == nil && count == 0 {
+		if _, err := db.Exec(`ALTER TABLE posts ADD COLUMN slug TEXT NULL`); err != nil {
+			return fmt.Errorf("failed to add slug column: %v", err)
+		}
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_slug ON posts(slug) WHERE slug IS NOT NULL`); err != nil {
+		return fmt.Errorf("failed to create slug index: %v", err)
+	}
+	if err := backfillPostSlugs(db); err != nil {
+		return fmt.Errorf("failed to backfill post slugs: %v", err)
+	}
+
+	// Check if publish_at column exists
+	row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('posts') WHERE name='publish_at'`)
+	if err := row.Scan(&count); err == nil && count == 0 {
+		if _, err := db.Exec(`ALTER TABLE posts ADD COLUMN publish_at DATETIME NULL`); err != nil {
+			return fmt.Errorf("failed to add publish_at column: %v", err)
+		}
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts(publish_at) WHERE publish_at IS NOT NULL`); err != nil {
+		return fmt.Errorf("failed to create publish_at index: %v", err)
+	}
+
+	// Check if published_at column exists
+	row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('posts') WHERE name='published_at'`)
+	if err := row.Scan(&count); err == nil && count == 0 {
+		if _, err := db.Exec(`ALTER TABLE posts ADD COLUMN published_at DATETIME NULL`); err != nil {
+			return fmt.Errorf("failed to add published_at column: %v", err)
+		}
+	}
+	// Posts published before publication was tracked count from creation
+	if _, err := db.Exec(`UPDATE posts SET published_at = created_at WHERE is_private = 0 AND published_at IS NULL`); err != nil {
+		return fmt.Errorf("failed to backfill published_at: %v", err)
+	}
+
+	// Check if users.role column exists; accounts from before roles existed
+	// owned the whole instance, so they become admins
+	row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('users') WHERE name='role'`)
+	if err := row.Scan(&count); err == nil && count == 0 {
+		if _, err := db.Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer'`); err != nil {
+			return fmt.Errorf("failed to add role column: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE users SET role = 'admin'`); err != nil {
+			return fmt.Errorf("failed to backfill user roles: %v", err)
+		}
+	}
+
+	// Check if author_id column exists; existing posts belong to the first user
+	row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('posts') WHERE name='author_id'`)
+	if err := row.Scan(&count); err == nil && count == 0 {
+		if _, err := db.Exec(`ALTER TABLE posts ADD COLUMN author_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL`); err != nil {
+			return fmt.Errorf("failed to add author_id column: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE posts SET author_id = (SELECT MIN(id) FROM users)`); err != nil {
+			return fmt.Errorf("failed to backfill post authors: %v", err)
+		}
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_posts_author ON posts(author_id)`); err != nil {
+		return fmt.Errorf("failed to create author index: %v", err)
+	}
+
+	// Add session metadata columns to refresh_tokens
+	for _, col := range []struct{ name, def string }{
+		{"last_used_at", `DATETIME NULL`},
+		{"user_agent", `TEXT NOT NULL DEFAULT ''`},
+		{"ip", `TEXT NOT NULL DEFAULT ''`},
+	} {
+		row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('refresh_tokens') WHERE name = ?`, col.name)
+		if err := row.Scan(&count); err == nil && count == 0 {
+			if _, err := db.Exec(`ALTER TABLE refresh_tokens ADD COLUMN ` + col.name + ` ` + col.def); err != nil {
+				return fmt.Errorf("failed to add %s column: %v", col.name, err)
+			}
+		}
+	}
+
+	// Add author profile and two-factor columns to users
+	for _, col := range []struct{ name, def string }{
+		{"display_name", `TEXT NOT NULL DEFAULT ''`},
+		{"bio", `TEXT NOT NULL DEFAULT ''`},
+		{"avatar", `TEXT NOT NULL DEFAULT ''`},
+		{"links", `TEXT NOT NULL DEFAULT '[]'`},
+		{"totp_secret", `TEXT NOT NULL DEFAULT ''`},
+		{"totp_enabled", `INTEGER NOT NULL DEFAULT 0`},
+		{"totp_last_step", `INTEGER NOT NULL DEFAULT 0`},
+	} {
+		row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('users') WHERE name = ?`, col.name)
+		if err := row.Scan(&count); err == nil && count == 0 {
+			if _, err := db.Exec(`ALTER TABLE users ADD COLUMN ` + col.name + ` ` + col.def); err != nil {
+				return fmt.Errorf("failed to add %s column: %v", col.name, err)
+			}
+		}
+	}
+
+	// Add image dimension and variant columns to attachments
+	for _, col := range []struct{ name, def string }{
+		{"width", `INTEGER NOT NULL DEFAULT 0`},
+		{"height", `INTEGER NOT NULL DEFAULT 0`},
+		{"variants", `TEXT NOT NULL DEFAULT '[]'`},
+	} {
+		row = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('attachments') WHERE name = ?`, col.name)
+		if err := row.Scan(&count); err == nil && count == 0 {
+			if _, err := db.Exec(`ALTER TABLE attachments ADD COLUMN ` + col.name + ` ` + col.def); err != nil {
+				return fmt.Errorf("failed to add %s column: %v", col.name, err)
+			}
+		}
+	}
+
 	// Populate post_links for existing posts that don't have links
 	if err := populateExistingPostLinks(db); err != nil {
 		return fmt.Errorf("failed to populate existing post links: %v", err)
 	}
 
+	// Derive tags from hashtags in posts written before tagging existed
+	if err := populateExistingPostTags(db); err != nil {
+		return fmt.Errorf("failed to populate existing post tags: %v", err)
+	}
+
 	return nil
 }
 
@@ -612,35 +967,6 @@ func (a *App) cacheInvalidatePattern(pattern string) {
 	}
 }
 
-func getOrCreateJWTSecret(db *sql.DB) ([]byte, error) {
-	var secretStr string
-	err := db.QueryRow(`SELECT value FROM settings WHERE key = 'jwt_secret'`).Scan(&secretStr)
-
-	if err == sql.ErrNoRows {
-		// Generate new secret
-		secret := make([]byte, 32)
-		if _, err := rand.Read(secret); err != nil {
-			return nil, err
-		}
-
-		secretStr = base64.StdEncoding.EncodeToString(secret)
-
-		// Store in database
-		_, err = db.Exec(`INSERT INTO settings (key, value, updated_at) VALUES ('jwt_secret', ?, ?)`,
-			secretStr, time.Now())
-		if err != nil {
-			return nil, err
-		}
-
-		return secret, nil
-	} else if err != nil {
-		return nil, err
-	}
-
-	// Decode existing secret
-	return base64.StdEncoding.DecodeString(secretStr)
-}
-
 // initLogger initializes the logger with the log level from database
 func initLogger(db *sql.DB) (*slog.Logger, error) {
 	logLevel := getLogLevel(db)
@@ -709,49 +1035,47 @@ func (a *App) updateLogLevel(newLevel string) error {
 	return nil
 }
 
-func (a *App) createRefreshToken(userID int64) (string, error) {
-	// Generate random refresh token
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return "", err
+// createRefreshToken starts a session for userID and returns its ID, which
+// access tokens carry, together with the refresh token
+func (a *App) createRefreshToken(userID int64, r *http.Request) (int64, string, error) {
+	refreshToken, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return 0, "", err
 	}
 
-	refreshToken := base64.URLEncoding.EncodeToString(tokenBytes)
-	tokenHash := sha256.Sum256([]byte(refreshToken))
-
 	// Clean up expired tokens for this user
 	_, _ = a.DB.Exec(`DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at < ?`, userID, time.Now())
 
 	// Store in database (30 days expiry)
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
-	_, err := a.DB.Exec(`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
-		userID, base64.StdEncoding.EncodeToString(tokenHash[:]), expiresAt, time.Now())
+	now := time.Now()
+	res, err := a.DB.Exec(`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at, last_used_at, user_agent, ip)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, tokenHash, now.Add(refreshTokenTTL), now, now, sessionUserAgent(r), a.clientIP(r))
 	if err != nil {
-		return "", err
+		return 0, "", err
+	}
+	sessionID, err := res.LastInsertId()
+	if err != nil {
+		return 0, "", err
 	}
 
-	return refreshToken, nil
+	return sessionID, refreshToken, nil
 }
 
-func (a *App) validateRefreshToken(refreshToken string) (int64, error) {
-	tokenHash := sha256.Sum256([]byte(refreshToken))
-	tokenHashStr := base64.StdEncoding.EncodeToString(tokenHash[:])
-
-	var userID int64
-	err := a.DB.QueryRow(`SELECT user_id FROM refresh_tokens WHERE token_hash = ? AND expires_at > ?`,
-		tokenHashStr, time.Now()).Scan(&userID)
+// validateRefreshToken returns the user and session a refresh token belongs to
+func (a *App) validateRefreshToken(refreshToken string) (int64, int64, error) {
+	var userID, sessionID int64
+	err := a.DB.QueryRow(`SELECT user_id, id FROM refresh_tokens WHERE token_hash = ? AND expires_at > ?`,
+		hashRefreshToken(refreshToken), time.Now()).Scan(&userID, &sessionID)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
-	return userID, nil
+	return userID, sessionID, nil
 }
 
 func (a *App) revokeRefreshToken(refreshToken string) error {
-	tokenHash := sha256.Sum256([]byte(refreshToken))
-	tokenHashStr := base64.StdEncoding.EncodeToString(tokenHash[:])
-
-	_, err := a.DB.Exec(`DELETE FROM refresh_tokens WHERE token_hash = ?`, tokenHashStr)
+	_, err := a.DB.Exec(`DELETE FROM refresh_tokens WHERE token_hash = ?`, hashRefreshToken(refreshToken))
 	return err
 }
 
@@ -771,38 +1095,17 @@ func (a *App) createUser(username, password string) (*User, error) {
 		return nil, err
 	}
 	if hasUsers {
-		return nil, errors.New("user registration is not allowed - user already exists")
-	}
-
-	// Hash password
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
-	}
-
-	// Insert user
-	res, err := a.DB.Exec(`INSERT INTO users (username, password_hash, created_at) VALUES (?, ?, ?)`,
-		username, string(passwordHash), time.Now())
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := res.LastInsertId()
-	if err != nil {
-		return nil, err
+		return nil, errRegistrationClosed
 	}
 
-	return &User{
-		ID:        id,
-		Username:  username,
-		CreatedAt: time.Now(),
-	}, nil
+	// The account created during setup administers the instance
+	return insertUser(a.DB, username, password, roleAdmin)
 }
 
 func (a *App) authenticateUser(username, password string) (*User, error) {
 	var user User
-	row := a.DB.QueryRow(`SELECT id, username, password_hash, created_at FROM users WHERE username = ?`, username)
-	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	row := a.DB.QueryRow(`SELECT id, username, password_hash, role, created_at FROM users WHERE username = ?`, username)
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -815,34 +1118,59 @@ func (a *App) authenticateUser(username, password string) (*User, error) {
 	return &user, nil
 }
 
-func (a *App) generateJWT(user *User) (string, error) {
+// generateJWT issues an access token bound to a refresh token session
+func (a *App) generateJWT(user *User, sessionID int64) (string, error) {
 	claims := Claims{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // 7 days
+			Issuer:    jwtIssuer,
+			Audience:  jwt.ClaimStrings{jwtAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(a.tokens.accessTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	key, err := a.signingKey()
+	if err != nil {
+		return "", err
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(a.JWTSecret)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.secret)
 }
 
 func (a *App) validateJWT(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return a.JWTSecret, nil
-	})
+	// Only HS256 is accepted, whatever algorithm the token declares
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, a.jwtKeyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithAudience(jwtAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
 
-	return nil, errors.New("invalid token")
+	// Revoking a session also revokes the access tokens issued for it
+	active, err := a.sessionActive(claims.UserID, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, errSessionRevoked
+	}
+
+	return claims, nil
 }
 
 func (a *App) requireAuth(next http.HandlerFunc) http.HandlerFunc {
@@ -859,16 +1187,44 @@ func (a *App) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		_, err := a.validateJWT(tokenString)
+		claims, err := a.validateBearerToken(tokenString)
 		if err != nil {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		next(w, r)
+		// Roles can change while a token is alive, so enforce the current one
+		user, err := a.getUser(claims.UserID)
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		claims.Role = user.Role
+
+		if scope := apiTokenScope(r); !claims.hasScope(scope) {
+			if scope == "" {
+				http.Error(w, "not available to API tokens", http.StatusForbidden)
+			} else {
+				http.Error(w, "API token lacks the "+scope+" scope", http.StatusForbidden)
+			}
+			return
+		}
+
+		next(w, withClaims(r, claims))
 	}
 }
 
+// requireRole is requireAuth for endpoints that need at least the given role
+func (a *App) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if !roleAtLeast(requestClaims(r).Role, role) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
 // helper to extract first <h1> inner text from HTML
 func extractTitleFromHTML(htmlStr string) string {
 	lower := strings.ToLower(htmlStr)
@@ -1030,6 +1386,9 @@ func (a *App) fixExistingMentions() error {
 			if err := a.updatePostLinks(postID, newContent); err != nil {
 				a.Logger.Error("Failed to update post links after content fix", "postID", postID, "error", err)
 			}
+			if err := a.indexPost(postID); err != nil {
+				a.Logger.Error("Failed to update search index after content fix", "postID", postID, "error", err)
+			}
 
 			postsUpdated++
 			a.Logger.Debug("Fixed mentions in post", "postID", postID)
@@ -1044,7 +1403,8 @@ func (a *App) fixExistingMentions() error {
 func (a *App) updatePostLinks(sourcePostID int64, htmlContent string) error {
 	// Extract mentions from the HTML content
 	mentionIDs := extractMentionsFromHTML(htmlContent)
-	a.Logger.Debug("updatePostLinks", "sourcePostID", sourcePostID, "mentionIDs", mentionIDs, "htmlLength", len(htmlContent))
+	mentionSlugs := extractMentionSlugsFromHTML(htmlContent)
+	a.Logger.Debug("updatePostLinks", "sourcePostID", sourcePostID, "mentionIDs", mentionIDs, "mentionSlugs", mentionSlugs, "htmlLength", len(htmlContent))
 
 	// Begin transaction to ensure atomicity
 	tx, err := a.DB.Begin()
@@ -1053,6 +1413,19 @@ func (a *App) updatePostLinks(sourcePostID int64, htmlContent string) error {
 	}
 	defer tx.Rollback() // Rollback if not committed
 
+	// Resolve mentions that link by slug
+	for _, slug := range mentionSlugs {
+		targetID, _, err := slugOwner(tx, slug)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to resolve mention slug: %v", err)
+		}
+		if !slices.Contains(mentionIDs, targetID) {
+			mentionIDs = append(mentionIDs, targetID)
+		}
+	}
+
 	// Remove existing links for this source post
 	_, err = tx.Exec(`DELETE FROM post_links WHERE source_post_id = ?`, sourcePostID)
 	if err != nil {
@@ -1106,7 +1479,7 @@ func (a *App) getPostBacklinks(postID int64) ([]Post, error) {
 	a.Logger.Debug("getPostBacklinks", "postID", postID)
 
 	rows, err := a.DB.Query(`
-        SELECT p.id, p.title, p.content, p.created_at, p.updated_at
+        SELECT p.id, p.title, COALESCE(p.slug, ''), p.content, p.created_at, p.updated_at
         FROM posts p
         JOIN post_links pl ON p.id = pl.source_post_id
         WHERE pl.target_post_id = ?
@@ -1121,7 +1494,7 @@ func (a *App) getPostBacklinks(postID int64) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var p Post
-		err := rows.Scan(&p.ID, &p.Title, &p.Content, &p.CreatedAt, &p.UpdatedAt)
+		err := rows.Scan(&p.ID, &p.Title, &p.Slug, &p.Content, &p.CreatedAt, &p.UpdatedAt)
 		if err != nil {
 			a.Logger.Error("Failed to scan backlink row", "postID", postID, "error", err)
 			return nil, err
@@ -1133,95 +1506,128 @@ func (a *App) getPostBacklinks(postID int64) ([]Post, error) {
 	return posts, rows.Err()
 }
 
-func (a *App) ensureUploadsDir() error {
-	uploadsDir := "uploads"
-	if _, err := os.Stat(uploadsDir); os.IsNotExist(err) {
-		return os.MkdirAll(uploadsDir, 0755)
+// saveAttachment processes an uploaded image and stores it along with its
+// resized variants
+func (a *App) saveAttachment(file io.Reader, originalFilename string) (*Attachment, error) {
+	data, err := io.ReadAll(io.LimitReader(file, a.uploadLimits.maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	if int64(len(data)) > a.uploadLimits.maxFileSize {
+		return nil, errUploadTooLarge
+	}
+	img, err := processImage(data)
+	if err != nil {
+		return nil, err
+	}
+	total := int64(len(img.data))
+	for _, v := range img.variants {
+		total += int64(len(v.data))
+	}
+	if err := a.checkUploadQuota(total); err != nil {
+		return nil, err
 	}
-	return nil
-}
 
-func (a *App) saveAttachment(file io.Reader, originalFilename, mimeType string, size int64) (*Attachment, error) {
 	// Generate unique filename
-	ext := filepath.Ext(originalFilename)
-	filename := uuid.New().String() + ext
-
-	// Ensure uploads directory exists
-	if err := a.ensureUploadsDir(); err != nil {
-		return nil, fmt.Errorf("failed to create uploads directory: %v", err)
+	filename := uuid.New().String() + img.ext
+	ctx := context.Background()
+	stored := []string{}
+	cleanup := func() {
+		for _, key := range stored {
+			_ = a.blobs.Delete(ctx, key)
+		}
 	}
 
-	// Save file to disk
-	filepath := filepath.Join("uploads", filename)
-	outFile, err := os.Create(filepath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create file: %v", err)
+	attachment := &Attachment{
+		Filename:     filename,
+		OriginalName: originalFilename,
+		MimeType:     img.mimeType,
+		Width:        img.width,
+		Height:       img.height,
+		Variants:     []ImageVariant{},
+		CreatedAt:    time.Now(),
 	}
-	defer outFile.Close()
-
-	_, err = io.Copy(outFile, file)
-	if err != nil {
-		os.Remove(filepath) // Clean up on error
-		return nil, fmt.Errorf("failed to save file: %v", err)
+	if attachment.Size, err = a.blobs.Put(ctx, filename, bytes.NewReader(img.data), img.mimeType); err != nil {
+		return nil, err
+	}
+	stored = append(stored, filename)
+	for _, v := range img.variants {
+		variant := ImageVariant{
+			Filename: variantFilename(filename, v.width, v.ext),
+			MimeType: v.mimeType,
+			Width:    v.width,
+			Height:   v.height,
+		}
+		if variant.Size, err = a.blobs.Put(ctx, variant.Filename, bytes.NewReader(v.data), v.mimeType); err != nil {
+			cleanup()
+			return nil, err
+		}
+		stored = append(stored, variant.Filename)
+		attachment.Variants = append(attachment.Variants, variant)
 	}
 
 	// Save metadata to database
-	now := time.Now()
+	variants, _ := json.Marshal(attachment.Variants)
 	result, err := a.DB.Exec(`
-        INSERT INTO attachments (filename, original_name, mime_type, size, created_at) 
-        VALUES (?, ?, ?, ?, ?)
-    `, filename, originalFilename, mimeType, size, now)
+        INSERT INTO attachments (filename, original_name, mime_type, size, width, height, variants, created_at) 
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, filename, originalFilename, attachment.MimeType, attachment.Size, attachment.Width, attachment.Height, string(variants), attachment.CreatedAt)
 	if err != nil {
-		os.Remove(filepath) // Clean up on error
+		cleanup()
 		return nil, fmt.Errorf("failed to save metadata: %v", err)
 	}
 
-	id, err := result.LastInsertId()
+	attachment.ID, err = result.LastInsertId()
 	if err != nil {
 		return nil, err
 	}
-
-	return &Attachment{
-		ID:           id,
-		Filename:     filename,
-		OriginalName: originalFilename,
-		MimeType:     mimeType,
-		Size:         size,
-		CreatedAt:    now,
-	}, nil
+	return attachment, nil
 }
 
-func (a *App) getAttachment(filename string) (*Attachment, error) {
-	var attachment Attachment
-	row := a.DB.QueryRow(`
-        SELECT id, filename, original_name, mime_type, size, created_at 
-        FROM attachments WHERE filename = ?
-    `, filename)
+const attachmentColumns = `id, filename, original_name, mime_type, size, width, height, variants, created_at`
 
+// scanAttachment reads a row selected with attachmentColumns
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var attachment Attachment
+	var variants string
 	err := row.Scan(&attachment.ID, &attachment.Filename, &attachment.OriginalName,
-		&attachment.MimeType, &attachment.Size, &attachment.CreatedAt)
+		&attachment.MimeType, &attachment.Size, &attachment.Width, &attachment.Height, &variants, &attachment.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-
+	if err := json.Unmarshal([]byte(variants), &attachment.Variants); err != nil {
+		return nil, fmt.Errorf("failed to decode image variants: %v", err)
+	}
 	return &attachment, nil
 }
 
-func isValidImageMimeType(mimeType string) bool {
-	validTypes := []string{
-		"image/jpeg",
-		"image/jpg",
-		"image/png",
-		"image/gif",
-		"image/webp",
+func (a *App) getAttachment(filename string) (*Attachment, error) {
+	return scanAttachment(a.DB.QueryRow(`SELECT `+attachmentColumns+` FROM attachments WHERE filename = ?`, filename))
+}
+
+// getUpload finds the attachment an uploaded file belongs to, which is the
+// attachment itself or one of its resized variants, and the file's type
+func (a *App) getUpload(filename string) (*Attachment, string, error) {
+	attachment, err := a.getAttachment(filename)
+	if err == nil {
+		return attachment, attachment.MimeType, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, "", err
 	}
 
-	for _, validType := range validTypes {
-		if mimeType == validType {
-			return true
-		}
+	var parent, mimeType string
+	err = a.DB.QueryRow(`
+        SELECT a.filename, json_extract(v.value, '$.mimeType')
+        FROM attachments a, json_each(a.variants) v
+        WHERE json_extract(v.value, '$.filename') = ?`, filename).Scan(&parent, &mimeType)
+	if err != nil {
+		return nil, "", err
+	}
+	if attachment, err = a.getAttachment(parent); err != nil {
+		return nil, "", err
 	}
-	return false
+	return attachment, mimeType, nil
 }
 
 // corsMiddleware adds CORS headers for cross-origin requests
@@ -1298,42 +1704,32 @@ func (a *App) routes() {
 			return
 		}
 
-		if len(payload.Password) < 3 {
-			http.Error(w, "password must be at least 3 characters", http.StatusBadRequest)
+		if a.throttle(w, ipLimitKey(a.clientIP(r))) {
+			return
+		}
+
+		if err := a.passwordPolicy.check(payload.Username, payload.Password); err != nil {
+			a.recordAuthFailure(r, "register", payload.Username, err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
 		user, err := a.createUser(payload.Username, payload.Password)
 		if err != nil {
-			if err.Error() == "user registration is not allowed - user already exists" {
+			switch {
+			case errors.Is(err, errRegistrationClosed):
+				a.recordAuthFailure(r, "register", payload.Username, "registration closed")
 				http.Error(w, "registration not allowed", http.StatusForbidden)
-			} else {
+			case errors.Is(err, errUsernameInvalid):
+				a.recordAuthFailure(r, "register", payload.Username, err.Error())
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
 				http.Error(w, "failed to create user", http.StatusInternalServerError)
 			}
 			return
 		}
 
-		token, err := a.generateJWT(user)
-		if err != nil {
-			http.Error(w, "failed to generate token", http.StatusInternalServerError)
-			return
-		}
-
-		refreshToken, err := a.createRefreshToken(user.ID)
-		if err != nil {
-			http.Error(w, "failed to generate refresh token", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"token":        token,
-			"refreshToken": refreshToken,
-			"user": map[string]interface{}{
-				"id":       user.ID,
-				"username": user.Username,
-			},
-		})
+		a.writeAuthResponse(w, r, user)
 	}))
 
 	// Auth endpoints
@@ -1353,41 +1749,45 @@ func (a *App) routes() {
 			return
 		}
 
-		user, err := a.authenticateUser(payload.Username, payload.Password)
-		if err != nil {
-			a.Logger.Info("Login attempt failed", "username", payload.Username, "error", err.Error())
-			http.Error(w, "invalid credentials", http.StatusUnauthorized)
-			return
-		}
-
-		a.Logger.Info("User authenticated successfully", "username", user.Username, "userID", user.ID)
-
-		token, err := a.generateJWT(user)
-		if err != nil {
-			a.Logger.Error("Failed to generate JWT token", "userID", user.ID, "error", err.Error())
-			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		// Throttled attempts never reach bcrypt
+		if a.throttle(w, ipLimitKey(a.clientIP(r)), usernameLimitKey(payload.Username)) {
 			return
 		}
 
-		refreshToken, err := a.createRefreshToken(user.ID)
+		user, err := a.authenticateUser(payload.Username, payload.Password)
 		if err != nil {
-			a.Logger.Error("Failed to generate refresh token", "userID", user.ID, "error", err.Error())
-			http.Error(w, "failed to generate refresh token", http.StatusInternalServerError)
+			a.Logger.Info("Login attempt failed", "username", payload.Username, "error", err.Error())
+			reason := "wrong password"
+			if errors.Is(err, sql.ErrNoRows) {
+				reason = "unknown user"
+			}
+			a.recordAuthFailure(r, "login", payload.Username, reason, usernameLimitKey(payload.Username))
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
-
-		a.Logger.Info("Login successful", "username", user.Username, "userID", user.ID)
-
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"token":        token,
-			"refreshToken": refreshToken,
-			"user": map[string]interface{}{
-				"id":       user.ID,
-				"username": user.Username,
-			},
-		})
+		a.Logger.Info("Password accepted", "username", user.Username, "userID", user.ID)
+		a.writeLoginResponse(w, r, user)
 	}))
+	mux.HandleFunc("/api/auth/login/totp", a.corsMiddleware(a.handleLoginTOTP))
+	mux.HandleFunc("/api/auth/login/passkey/options", a.corsMiddleware(a.handlePasskeyLoginOptions))
+	mux.HandleFunc("/api/auth/login/passkey", a.corsMiddleware(a.handlePasskeyLogin))
+
+	mux.HandleFunc("/api/auth/password", a.corsMiddleware(a.handleChangePassword))
+	mux.HandleFunc("/api/auth/logout", a.corsMiddleware(a.handleLogout))
+	mux.HandleFunc("/api/auth/sessions", a.corsMiddleware(a.handleSessions))
+	mux.HandleFunc("/api/auth/sessions/{id}", a.corsMiddleware(a.handleSession))
+	mux.HandleFunc("/api/auth/failures", a.corsMiddleware(a.handleAuthFailures))
+	mux.HandleFunc("/api/tokens", a.corsMiddleware(a.handleAPITokens))
+	mux.HandleFunc("/api/tokens/{id}", a.corsMiddleware(a.handleAPIToken))
+	mux.HandleFunc("/api/auth/reset", a.corsMiddleware(a.handleResetPassword))
+	mux.HandleFunc("/api/auth/totp", a.corsMiddleware(a.handleTOTP))
+	mux.HandleFunc("/api/auth/totp/setup", a.corsMiddleware(a.handleTOTPSetup))
+	mux.HandleFunc("/api/auth/totp/enable", a.corsMiddleware(a.handleTOTPEnable))
+	mux.HandleFunc("/api/auth/totp/disable", a.corsMiddleware(a.handleTOTPDisable))
+	mux.HandleFunc("/api/auth/passkeys", a.corsMiddleware(a.handlePasskeys))
+	mux.HandleFunc("/api/auth/passkeys/{id}", a.corsMiddleware(a.handlePasskey))
+	mux.HandleFunc("/api/auth/passkeys/register/options", a.corsMiddleware(a.handlePasskeyRegisterOptions))
+	mux.HandleFunc("/api/auth/passkeys/register", a.corsMiddleware(a.handlePasskeyRegister))
 
 	mux.HandleFunc("/api/auth/validate", a.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -1407,7 +1807,12 @@ func (a *App) routes() {
 			return
 		}
 
-		claims, err := a.validateJWT(tokenString)
+		claims, err := a.validateBearerToken(tokenString)
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		user, err := a.getUser(claims.UserID)
 		if err != nil {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
@@ -1417,8 +1822,9 @@ func (a *App) routes() {
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
 			"valid": true,
 			"user": map[string]interface{}{
-				"id":       claims.UserID,
-				"username": claims.Username,
+				"id":       user.ID,
+				"username": user.Username,
+				"role":     user.Role,
 			},
 		})
 	}))
@@ -1444,47 +1850,34 @@ func (a *App) routes() {
 			return
 		}
 
+		if a.throttle(w, ipLimitKey(a.clientIP(r))) {
+			return
+		}
+
 		// Validate refresh token
-		userID, err := a.validateRefreshToken(payload.RefreshToken)
+		userID, sessionID, err := a.validateRefreshToken(payload.RefreshToken)
 		if err != nil {
+			a.recordAuthFailure(r, "refresh", "", "invalid refresh token")
 			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
 			return
 		}
 
 		// Get user
-		var user User
-		row := a.DB.QueryRow(`SELECT id, username, created_at FROM users WHERE id = ?`, userID)
-		err = row.Scan(&user.ID, &user.Username, &user.CreatedAt)
+		user, err := a.getUser(userID)
 		if err != nil {
 			http.Error(w, "user not found", http.StatusUnauthorized)
 			return
 		}
 
-		// Generate new tokens
-		newToken, err := a.generateJWT(&user)
+		// Rotate the refresh token; the session keeps its ID
+		refreshToken, err := a.rotateRefreshToken(sessionID, payload.RefreshToken, r)
 		if err != nil {
-			http.Error(w, "failed to generate token", http.StatusInternalServerError)
-			return
-		}
-
-		newRefreshToken, err := a.createRefreshToken(user.ID)
-		if err != nil {
-			http.Error(w, "failed to generate refresh token", http.StatusInternalServerError)
+			a.recordAuthFailure(r, "refresh", user.Username, "refresh token already used")
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
 			return
 		}
 
-		// Revoke old refresh token
-		_ = a.revokeRefreshToken(payload.RefreshToken)
-
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"token":        newToken,
-			"refreshToken": newRefreshToken,
-			"user": map[string]interface{}{
-				"id":       user.ID,
-				"username": user.Username,
-			},
-		})
+		a.writeTokenPair(w, user, sessionID, refreshToken)
 	}))
 
 	// Posts collection: POST(create) and GET(list)
@@ -1492,21 +1885,23 @@ func (a *App) routes() {
 		switch r.Method {
 		case http.MethodPost:
 			// Protect post creation
-			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
 				a.Logger.Debug("Creating new post")
 				now := time.Now()
-				res, err := a.DB.Exec(`INSERT INTO posts(title, content, created_at, updated_at, is_private) VALUES(NULL, '', ?, ?, ?)`, now, now, true)
+				authorID := requestClaims(r).UserID
+				res, err := a.DB.Exec(`INSERT INTO posts(title, content, created_at, updated_at, is_private, author_id) VALUES(NULL, '', ?, ?, ?, ?)`, now, now, true, authorID)
 				if err != nil {
 					a.Logger.Error("Failed to create post in database", "error", err.Error())
 					http.Error(w, "db error", http.StatusInternalServerError)
 					return
 				}
 				id, _ := res.LastInsertId()
-				p := Post{ID: id, Title: nil, Content: "", CreatedAt: now, UpdatedAt: now, IsPrivate: true}
+				p := Post{ID: id, Title: nil, Content: "", CreatedAt: now, UpdatedAt: now, IsPrivate: true, AuthorID: &authorID}
 				a.Logger.Info("Post created successfully", "postID", id, "isPrivate", p.IsPrivate)
 
 				// Invalidate posts cache
 				a.cacheInvalidatePattern("posts_list_")
+				a.events.publish(postEventCreated, p)
 
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusCreated)
@@ -1517,7 +1912,13 @@ func (a *App) routes() {
 			isAuth := a.isAuthenticated(r)
 			a.Logger.Debug("Fetching posts list", "authenticated", isAuth)
 
-			posts, err := a.getPostsWithPrivacy(isAuth)
+			var posts []Post
+			var err error
+			if tag := r.URL.Query().Get("tag"); tag != "" {
+				posts, err = a.getPostsByTag(normalizeTag(tag), isAuth)
+			} else {
+				posts, err = a.getPostsWithPrivacy(isAuth)
+			}
 			if err != nil {
 				a.Logger.Error("Failed to fetch posts from database", "error", err.Error())
 				http.Error(w, "db error", http.StatusInternalServerError)
@@ -1535,6 +1936,15 @@ func (a *App) routes() {
 		}
 	}))
 
+	// Live post updates over Server-Sent Events
+	mux.HandleFunc("/api/posts/stream", a.corsMiddleware(a.handlePostStream))
+
+	// Full-text search
+	mux.HandleFunc("/api/search", a.corsMiddleware(a.handleSearch))
+
+	// Tags
+	mux.HandleFunc("/api/tags", a.corsMiddleware(a.handleTags))
+
 	// Individual post: GET/PUT/DELETE
 	mux.HandleFunc("/api/posts/", a.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, "/api/posts/")
@@ -1543,6 +1953,26 @@ func (a *App) routes() {
 			return
 		}
 
+		// Posts may be addressed by slug as well as by numeric ID
+		resolvedPath, err := a.resolvePostIDRef(path)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, "db error", http.StatusInternalServerError)
+			}
+			return
+		}
+		path = resolvedPath
+
+		// Handle revision history sub-paths
+		if strings.Contains(path, "/revisions") {
+			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+				a.handlePostRevisions(w, r, path)
+			})(w, r)
+			return
+		}
+
 		// Handle backlinks sub-path
 		if strings.HasSuffix(path, "/backlinks") {
 			if r.Method != http.MethodGet {
@@ -1572,16 +2002,27 @@ func (a *App) routes() {
 			return
 		}
 
-		// Handle publish/unpublish sub-path
-		if strings.HasSuffix(path, "/publish") {
-			if r.Method != http.MethodPut {
+		// Handle scheduled publication sub-path
+		if strings.HasSuffix(path, "/schedule") {
+			a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
+				a.handlePostSchedule(w, r, strings.TrimSuffix(path, "/schedule"))
+			})(w, r)
+			return
+		}
+
+		// Handle publish/unpublish sub-paths
+		if strings.HasSuffix(path, "/publish") || strings.HasSuffix(path, "/unpublish") {
+			unpublish := strings.HasSuffix(path, "/unpublish")
+			// PUT /publish is the old privacy toggle, kept as a deprecated alias
+			legacyToggle := r.Method == http.MethodPut && !unpublish
+			if r.Method != http.MethodPost && !legacyToggle {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 				return
 			}
 
 			// Require authentication for publishing
-			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
-				idStr := strings.TrimSuffix(path, "/publish")
+			a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
+				idStr := strings.TrimSuffix(strings.TrimSuffix(path, "/unpublish"), "/publish")
 
 				// Get current post to check if it exists and get current privacy state
 				p, err := a.getPost(idStr)
@@ -1593,31 +2034,31 @@ func (a *App) routes() {
 					}
 					return
 				}
-
-				// Toggle privacy state
-				newPrivate := !p.IsPrivate
-				a.Logger.Info("Toggling post privacy", "postID", idStr, "from", p.IsPrivate, "to", newPrivate)
-
-				_, err = a.DB.Exec(`UPDATE posts SET is_private = ? WHERE id = ?`, newPrivate, idStr)
-				if err != nil {
-					a.Logger.Error("Failed to update post privacy in database", "postID", idStr, "error", err.Error())
-					http.Error(w, "db error", http.StatusInternalServerError)
+				if !canEditPost(requestClaims(r), p) {
+					http.Error(w, "forbidden", http.StatusForbidden)
 					return
 				}
 
-				// Get updated post
-				updatedPost, err := a.getPost(idStr)
-				if err != nil {
-					a.Logger.Error("Failed to fetch updated post after privacy toggle", "postID", idStr, "error", err.Error())
-					http.Error(w, "db error", http.StatusInternalServerError)
-					return
+				newPrivate := unpublish
+				if legacyToggle {
+					a.Logger.Warn("Deprecated PUT publish toggle used", "postID", idStr)
+					w.Header().Set("Deprecation", "true")
+					w.Header().Set("Link", fmt.Sprintf(`</api/posts/%s/publish>; rel="successor-version"`, idStr))
+					newPrivate = !p.IsPrivate
 				}
 
-				a.Logger.Info("Post privacy toggled successfully", "postID", idStr, "isPrivate", updatedPost.IsPrivate)
-
-				// Invalidate posts cache
-				a.cacheInvalidatePattern("posts_list_")
-				a.cacheDelete(fmt.Sprintf("post_%s", idStr))
+				// Publishing and unpublishing are idempotent
+				updatedPost := p
+				if p.IsPrivate != newPrivate {
+					a.Logger.Info("Changing post privacy", "postID", idStr, "from", p.IsPrivate, "to", newPrivate)
+					updatedPost, err = a.setPostPrivacy(idStr, newPrivate)
+					if err != nil {
+						a.Logger.Error("Failed to update post privacy", "postID", idStr, "error", err.Error())
+						http.Error(w, "db error", http.StatusInternalServerError)
+						return
+					}
+					a.Logger.Info("Post privacy changed successfully", "postID", idStr, "isPrivate", updatedPost.IsPrivate)
+				}
 
 				w.Header().Set("Content-Type", "application/json")
 				_ = json.NewEncoder(w).Encode(updatedPost)
@@ -1652,10 +2093,12 @@ func (a *App) routes() {
 			return
 		case http.MethodPut:
 			// Protect post updates
-			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
 				a.Logger.Debug("Updating post", "postID", idStr)
 				var payload struct {
-					Content string `json:"content"`
+					Content *string   `json:"content"`
+					Slug    *string   `json:"slug"`
+					Tags    *[]string `json:"tags"`
 				}
 				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 					a.Logger.Error("Invalid JSON in post update request", "postID", idStr, "error", err.Error())
@@ -1672,8 +2115,37 @@ func (a *App) routes() {
 					}
 					return
 				}
+				if !canEditPost(requestClaims(r), existing) {
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+
+				// Explicit tags are metadata and do not bump updated_at
+				if payload.Tags != nil {
+					if err := a.setExplicitTags(existing.ID, *payload.Tags); err != nil {
+						if errors.Is(err, errTooManyTags) {
+							http.Error(w, err.Error(), http.StatusBadRequest)
+						} else {
+							a.Logger.Error("Failed to update post tags", "postID", idStr, "error", err.Error())
+							http.Error(w, "db error", http.StatusInternalServerError)
+						}
+						return
+					}
+					if existing.Tags, err = a.getPostTags(existing.ID); err != nil {
+						http.Error(w, "db error", http.StatusInternalServerError)
+						return
+					}
+				}
+
+				content := existing.Content
+				if payload.Content != nil {
+					content = *payload.Content
+					if !trustsRawHTML(requestClaims(r).Role) {
+						content = sanitizeHTML(content)
+					}
+				}
 
-				title := strings.TrimSpace(extractTitleFromHTML(payload.Content))
+				title := strings.TrimSpace(extractTitleFromHTML(content))
 				var titlePtr *string
 				if title != "" {
 					titlePtr = &title
@@ -1684,23 +2156,64 @@ func (a *App) routes() {
 					existingTitle = strings.TrimSpace(*existing.Title)
 				}
 
-				contentChanged := existing.Content != payload.Content
+				contentChanged := existing.Content != content
 				titleChanged := existingTitle != title
-				if !contentChanged && !titleChanged {
+
+				// Explicit slug edits win, drafts follow their title, and
+				// published posts keep their URL stable
+				newSlug := existing.Slug
+				switch {
+				case payload.Slug != nil && strings.TrimSpace(*payload.Slug) != "":
+					newSlug, err = a.requestedSlug(existing.ID, *payload.Slug)
+					if err != nil {
+						switch {
+						case errors.Is(err, errSlugTaken):
+							http.Error(w, err.Error(), http.StatusConflict)
+						case errors.Is(err, errSlugInvalid):
+							http.Error(w, err.Error(), http.StatusBadRequest)
+						default:
+							http.Error(w, "db error", http.StatusInternalServerError)
+						}
+						return
+					}
+				case payload.Slug != nil || existing.Slug == "" || (existing.IsPrivate && titleChanged):
+					newSlug, err = uniquePostSlug(a.DB, slugify(title), existing.ID)
+					if err != nil {
+						a.Logger.Error("Failed to derive post slug", "postID", idStr, "error", err.Error())
+						http.Error(w, "db error", http.StatusInternalServerError)
+						return
+					}
+				}
+				slugChanged := newSlug != existing.Slug
+
+				if !contentChanged && !titleChanged && !slugChanged {
 					a.Logger.Debug("No post changes detected, skipping update", "postID", idStr)
+					if payload.Tags != nil {
+						a.cacheInvalidatePattern("posts_list_")
+						a.events.publish(postEventUpdated, existing)
+					}
 					w.Header().Set("Content-Type", "application/json")
 					_ = json.NewEncoder(w).Encode(existing)
 					return
 				}
 
 				now := time.Now()
-				_, err = a.DB.Exec(`UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE id = ?`, titlePtr, payload.Content, now, idStr)
+				_, err = a.DB.Exec(`UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE id = ?`, titlePtr, content, now, idStr)
 				if err != nil {
 					a.Logger.Error("Failed to update post in database", "postID", idStr, "error", err.Error())
 					http.Error(w, "db error", http.StatusInternalServerError)
 					return
 				}
 
+				if slugChanged {
+					// Only public posts can have been shared under the old slug
+					if err := a.setPostSlug(existing.ID, existing.Slug, newSlug, !existing.IsPrivate); err != nil {
+						a.Logger.Error("Failed to update post slug", "postID", idStr, "error", err.Error())
+						http.Error(w, "db error", http.StatusInternalServerError)
+						return
+					}
+				}
+
 				a.Logger.Info("Post updated successfully", "postID", idStr, "title", title)
 
 				// Invalidate posts cache
@@ -1709,11 +2222,22 @@ func (a *App) routes() {
 
 				// Parse post ID and update bi-directional links
 				if postID, parseErr := strconv.ParseInt(idStr, 10, 64); parseErr == nil {
-					if linkErr := a.updatePostLinks(postID, payload.Content); linkErr != nil {
+					if contentChanged {
+						if revErr := a.recordRevision(postID, existing, titlePtr, content, now, true); revErr != nil {
+							a.Logger.Error("Failed to record post revision", "postID", postID, "error", revErr.Error())
+						}
+					}
+					if linkErr := a.updatePostLinks(postID, content); linkErr != nil {
 						a.Logger.Debug("Failed to update post links", "postID", postID, "error", linkErr.Error())
 					} else {
 						a.Logger.Debug("Post links updated successfully", "postID", postID)
 					}
+					if indexErr := a.indexPost(postID); indexErr != nil {
+						a.Logger.Error("Failed to update search index", "postID", postID, "error", indexErr.Error())
+					}
+					if tagErr := a.updateContentTags(postID, content); tagErr != nil {
+						a.Logger.Error("Failed to update post tags", "postID", postID, "error", tagErr.Error())
+					}
 				}
 
 				p, err := a.getPost(idStr)
@@ -1725,21 +2249,42 @@ func (a *App) routes() {
 					}
 					return
 				}
+				a.events.publish(postEventUpdated, p)
+
 				w.Header().Set("Content-Type", "application/json")
 				_ = json.NewEncoder(w).Encode(p)
 			})(w, r)
 			return
 		case http.MethodDelete:
 			// Protect post deletion
-			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
-				_, err := a.DB.Exec(`DELETE FROM posts WHERE id = ?`, idStr)
+			a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
+				// Look up the post first to check ownership and so subscribers
+				// know whether it was public
+				existing, err := a.getPost(idStr)
+				if errors.Is(err, sql.ErrNoRows) {
+					http.NotFound(w, r)
+					return
+				}
 				if err != nil {
 					http.Error(w, "db error", http.StatusInternalServerError)
 					return
 				}
+				if !canEditPost(requestClaims(r), existing) {
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+
+				if _, err := a.DB.Exec(`DELETE FROM posts WHERE id = ?`, idStr); err != nil {
+					http.Error(w, "db error", http.StatusInternalServerError)
+					return
+				}
 
 				// Invalidate posts cache
 				a.cacheInvalidatePattern("posts_list_")
+				a.events.publish(postEventDeleted, existing)
+				if err := a.indexPost(existing.ID); err != nil {
+					a.Logger.Error("Failed to remove post from search index", "postID", idStr, "error", err.Error())
+				}
 
 				w.WriteHeader(http.StatusNoContent)
 			})(w, r)
@@ -1754,45 +2299,45 @@ func (a *App) routes() {
 	mux.HandleFunc("/api/settings", a.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
+			isAuth := a.isAuthenticated(r)
+
 			// Get all settings or specific setting by key query param
 			key := r.URL.Query().Get("key")
 			if key != "" {
+				def, ok := lookupSetting(key)
+				if !ok || def.visibility == settingInternal {
+					http.Error(w, "unknown setting", http.StatusNotFound)
+					return
+				}
+				if def.visibility != settingPublic && !isAuth {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+
 				// Get specific setting
 				var value string
 				err := a.DB.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
-				if err != nil {
-					if errors.Is(err, sql.ErrNoRows) {
-						w.Header().Set("Content-Type", "application/json")
-						w.Header().Set("Cache-Control", "no-cache")
-						_ = json.NewEncoder(w).Encode(map[string]string{"value": ""})
-						return
-					}
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
 					http.Error(w, "db error", http.StatusInternalServerError)
 					return
 				}
 
 				w.Header().Set("Content-Type", "application/json")
 				w.Header().Set("Cache-Control", "no-cache")
+				if def.visibility == settingSecret {
+					_ = json.NewEncoder(w).Encode(map[string]bool{"configured": value != ""})
+					return
+				}
 				_ = json.NewEncoder(w).Encode(map[string]string{"value": value})
 				return
 			}
 
-			// Get all settings
-			rows, err := a.DB.Query(`SELECT key, value FROM settings`)
+			// Get all settings visible to the caller
+			settings, err := a.readSettings(isAuth)
 			if err != nil {
 				http.Error(w, "db error", http.StatusInternalServerError)
 				return
 			}
-			defer rows.Close()
-			settings := make(map[string]string)
-			for rows.Next() {
-				var k, v string
-				if err := rows.Scan(&k, &v); err != nil {
-					http.Error(w, "db error", http.StatusInternalServerError)
-					return
-				}
-				settings[k] = v
-			}
 
 			w.Header().Set("Content-Type", "application/json")
 			w.Header().Set("Cache-Control", "no-cache")
@@ -1800,7 +2345,7 @@ func (a *App) routes() {
 			return
 		case http.MethodPut:
 			// Protect settings updates
-			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
 				var payload struct {
 					Key   string `json:"key"`
 					Value string `json:"value"`
@@ -1813,13 +2358,34 @@ func (a *App) routes() {
 					http.Error(w, "key is required", http.StatusBadRequest)
 					return
 				}
-				now := time.Now()
-				_, err := a.DB.Exec(`INSERT OR REPLACE INTO settings (key, value, updated_at) VALUES (?, ?, ?)`, payload.Key, payload.Value, now)
+
+				def, ok := lookupSetting(payload.Key)
+				if !ok || def.visibility == settingInternal {
+					http.Error(w, fmt.Sprintf("unknown setting key: %s", payload.Key), http.StatusBadRequest)
+					return
+				}
+
+				value, err := def.normalize(payload.Value)
 				if err != nil {
-					http.Error(w, "db error", http.StatusInternalServerError)
+					http.Error(w, fmt.Sprintf("invalid value for %s: %v", payload.Key, err), http.StatusBadRequest)
 					return
 				}
 
+				// The log level also has to reconfigure the running logger
+				if payload.Key == "log_level" {
+					if err := a.updateLogLevel(value); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+				} else {
+					now := time.Now()
+					_, err = a.DB.Exec(`INSERT OR REPLACE INTO settings (key, value, updated_at) VALUES (?, ?, ?)`, payload.Key, value, now)
+					if err != nil {
+						http.Error(w, "db error", http.StatusInternalServerError)
+						return
+					}
+				}
+
 				// Invalidate settings cache
 				a.cacheDelete("settings_all")
 				a.cacheDelete(fmt.Sprintf("setting_%s", payload.Key))
@@ -1827,7 +2393,11 @@ func (a *App) routes() {
 				a.cacheDelete("settings_about")
 
 				w.Header().Set("Content-Type", "application/json")
-				_ = json.NewEncoder(w).Encode(map[string]string{"key": payload.Key, "value": payload.Value})
+				if def.visibility == settingSecret {
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"key": payload.Key, "configured": value != ""})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]string{"key": payload.Key, "value": value})
 			})(w, r)
 			return
 		default:
@@ -1846,7 +2416,7 @@ func (a *App) routes() {
 			return
 		case http.MethodPut:
 			// Protect log level updates
-			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
 				var payload struct {
 					Level string `json:"level"`
 				}
@@ -1871,98 +2441,11 @@ func (a *App) routes() {
 	}))
 
 	// Image upload endpoint
-	mux.HandleFunc("/api/uploads", a.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		// Protect upload endpoint
-		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
-			// Parse multipart form
-			err := r.ParseMultipartForm(10 << 20) // 10MB max
-			if err != nil {
-				http.Error(w, "failed to parse form", http.StatusBadRequest)
-				return
-			}
-
-			file, handler, err := r.FormFile("file")
-			if err != nil {
-				http.Error(w, "no file provided", http.StatusBadRequest)
-				return
-			}
-			defer file.Close()
-
-			// Validate mime type
-			contentType := handler.Header.Get("Content-Type")
-			if contentType == "" {
-				contentType = mime.TypeByExtension(filepath.Ext(handler.Filename))
-			}
-
-			if !isValidImageMimeType(contentType) {
-				http.Error(w, "invalid file type - only images are allowed", http.StatusBadRequest)
-				return
-			}
-
-			// Save attachment
-			attachment, err := a.saveAttachment(file, handler.Filename, contentType, handler.Size)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
-				return
-			}
-
-			// Return attachment info with URL
-			response := map[string]interface{}{
-				"id":           attachment.ID,
-				"filename":     attachment.Filename,
-				"originalName": attachment.OriginalName,
-				"mimeType":     attachment.MimeType,
-				"size":         attachment.Size,
-				"url":          fmt.Sprintf("/api/uploads/%s", attachment.Filename),
-				"createdAt":    attachment.CreatedAt,
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusCreated)
-			_ = json.NewEncoder(w).Encode(response)
-		})(w, r)
-	}))
-
-	// Serve uploaded files
-	mux.HandleFunc("/api/uploads/", a.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	mux.HandleFunc("/api/uploads", a.corsMiddleware(a.handleUploads))
 
-		filename := strings.TrimPrefix(r.URL.Path, "/api/uploads/")
-		if filename == "" {
-			http.NotFound(w, r)
-			return
-		}
-
-		// Get attachment metadata
-		attachment, err := a.getAttachment(filename)
-		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				http.NotFound(w, r)
-			} else {
-				http.Error(w, "database error", http.StatusInternalServerError)
-			}
-			return
-		}
-
-		// Serve file
-		filepath := filepath.Join("uploads", filename)
-		if _, err := os.Stat(filepath); os.IsNotExist(err) {
-			http.NotFound(w, r)
-			return
-		}
-
-		w.Header().Set("Content-Type", attachment.MimeType)
-		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", attachment.OriginalName))
-		http.ServeFile(w, r, filepath)
-	}))
+	// Serve and delete uploaded files; gc reports or removes unused ones
+	mux.HandleFunc("/api/uploads/gc", a.corsMiddleware(a.handleUploadsGC))
+	mux.HandleFunc("/api/uploads/{filename}", a.corsMiddleware(a.handleUpload))
 
 	// About Me endpoints
 	mux.HandleFunc("/api/about", a.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
@@ -1998,7 +2481,7 @@ func (a *App) routes() {
 			return
 		case http.MethodPut:
 			// Protect about me updates
-			a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
 				var payload struct {
 					Content string `json:"content"`
 				}
@@ -2038,7 +2521,7 @@ func (a *App) routes() {
 		}
 
 		// Protect AI endpoint
-		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
 			// Get OpenAI API key from settings
 			var apiKey string
 			err := a.DB.QueryRow(`SELECT value FROM settings WHERE key = ?`, "openai_api_key").Scan(&apiKey)
@@ -2078,7 +2561,7 @@ func (a *App) routes() {
 		}
 
 		// Protect AI endpoint
-		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
 			// Parse request
 			var req struct {
 				SelectedText string `json:"selectedText"`
@@ -2133,6 +2616,29 @@ func (a *App) routes() {
 		})(w, r)
 	}))
 
+	// Syndication feeds
+	mux.HandleFunc("/rss.xml", a.handleRSSFeed)
+	mux.HandleFunc("/atom.xml", a.handleAtomFeed)
+	mux.HandleFunc("/feed.json", a.handleJSONFeed)
+	mux.HandleFunc("/tags/{tag}/rss.xml", a.handleTagFeed)
+	mux.HandleFunc("/authors/{username}/rss.xml", a.handleAuthorFeed)
+
+	// User management and invitations
+	mux.HandleFunc("/api/users", a.corsMiddleware(a.handleUsers))
+	mux.HandleFunc("/api/users/{id}", a.corsMiddleware(a.handleUser))
+	mux.HandleFunc("/api/invitations", a.corsMiddleware(a.handleInvitations))
+	mux.HandleFunc("/api/invitations/{id}", a.corsMiddleware(a.handleInvitation))
+	mux.HandleFunc("/api/invitations/accept", a.corsMiddleware(a.handleAcceptInvitation))
+
+	// Author profiles
+	mux.HandleFunc("/api/profile", a.corsMiddleware(a.handleProfile))
+	mux.HandleFunc("/api/authors/{username}", a.corsMiddleware(a.handleAuthor))
+
+	// Crawler support
+	mux.HandleFunc("/sitemap.xml", a.handleSitemap)
+	mux.HandleFunc("/sitemaps/{file}", a.handleSitemapPage)
+	mux.HandleFunc("/robots.txt", a.handleRobots)
+
 	// Static files + pre-rendered HTML fallbacks
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -2171,17 +2677,7 @@ func (a *App) routes() {
 
 		fallback := index
 		if settings, serr := a.getPublicSettings(); serr == nil {
-			scheme := "https"
-			if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
-				scheme = proto
-			} else if r.TLS == nil {
-				scheme = "http"
-			}
-			host := r.Host
-			if host == "" {
-				host = "localhost"
-			}
-			siteBase := fmt.Sprintf("%s://%s", scheme, host)
+			siteBase := a.requestSiteBase(r)
 			currentPath := r.URL.Path
 			if currentPath == "" {
 				currentPath = "/"
@@ -2227,27 +2723,56 @@ func (a *App) isAuthenticated(r *http.Request) bool {
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 		return false
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	_, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return a.JWTSecret, nil
-	})
-	return err == nil
+	// API tokens see private posts only with the posts:read scope
+	claims, err := a.validateBearerToken(strings.TrimPrefix(authHeader, "Bearer "))
+	return err == nil && claims.hasScope(scopePostsRead)
 }
 
-func (a *App) getPost(idStr string) (Post, error) {
-	a.Logger.Debug("getPost", "idStr", idStr)
+// postColumns lists the posts columns read by scanPost, in order
+const postColumns = `id, title, COALESCE(slug, ''), content, created_at, updated_at, is_private, publish_at, published_at, author_id`
+
+// publicPostOrder sorts public listings by publication date
+const publicPostOrder = `ORDER BY COALESCE(published_at, created_at) DESC, id DESC`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPost reads a row selected with postColumns
+func scanPost(row rowScanner) (Post, error) {
 	var p Post
 	var title sql.NullString
-	row := a.DB.QueryRow(`SELECT id, title, content, created_at, updated_at, is_private FROM posts WHERE id = ?`, idStr)
-	err := row.Scan(&p.ID, &title, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.IsPrivate)
-	if err != nil {
-		a.Logger.Error("getPost failed", "idStr", idStr, "error", err)
+	var publishAt, publishedAt sql.NullTime
+	var authorID sql.NullInt64
+	if err := row.Scan(&p.ID, &title, &p.Slug, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.IsPrivate, &publishAt, &publishedAt, &authorID); err != nil {
 		return Post{}, err
 	}
 	if title.Valid {
 		t := title.String
 		p.Title = &t
 	}
+	if publishAt.Valid {
+		p.PublishAt = &publishAt.Time
+	}
+	if publishedAt.Valid {
+		p.PublishedAt = &publishedAt.Time
+	}
+	if authorID.Valid {
+		p.AuthorID = &authorID.Int64
+	}
+	return p, nil
+}
+
+func (a *App) getPost(idStr string) (Post, error) {
+	a.Logger.Debug("getPost", "idStr", idStr)
+	p, err := scanPost(a.DB.QueryRow(`SELECT `+postColumns+` FROM posts WHERE id = ?`, idStr))
+	if err != nil {
+		a.Logger.Error("getPost failed", "idStr", idStr, "error", err)
+		return Post{}, err
+	}
+	if p.Tags, err = a.getPostTags(p.ID); err != nil {
+		return Post{}, err
+	}
 	a.Logger.Debug("getPost success", "idStr", idStr, "postID", p.ID)
 	return p, nil
 }
@@ -2255,9 +2780,9 @@ func (a *App) getPost(idStr string) (Post, error) {
 func (a *App) getPostsWithPrivacy(isAuthenticated bool) ([]Post, error) {
 	var query string
 	if isAuthenticated {
-		query = `SELECT id, title, content, created_at, updated_at, is_private FROM posts ORDER BY updated_at DESC, created_at DESC`
+		query = `SELECT ` + postColumns + ` FROM posts ORDER BY updated_at DESC, created_at DESC`
 	} else {
-		query = `SELECT id, title, content, created_at, updated_at, is_private FROM posts WHERE is_private = 0 ORDER BY updated_at DESC, created_at DESC`
+		query = `SELECT ` + postColumns + ` FROM posts WHERE is_private = 0 ` + publicPostOrder
 	}
 
 	rows, err := a.DB.Query(query)
@@ -2268,17 +2793,15 @@ func (a *App) getPostsWithPrivacy(isAuthenticated bool) ([]Post, error) {
 
 	var posts []Post
 	for rows.Next() {
-		var p Post
-		var title sql.NullString
-		if err := rows.Scan(&p.ID, &title, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.IsPrivate); err != nil {
+		p, err := scanPost(rows)
+		if err != nil {
 			return nil, err
 		}
-		if title.Valid {
-			t := title.String
-			p.Title = &t
-		}
 		posts = append(posts, p)
 	}
+	if err := a.attachPostTags(posts); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
@@ -2297,7 +2820,7 @@ func (a *App) getPublicSettings() (siteSettings, error) {
 		AboutEnabled: false,
 	}
 
-	rows, err := a.DB.Query(`SELECT key, value FROM settings WHERE key IN ('siteTitle','introText','heroImage','aboutEnabled')`)
+	rows, err := a.DB.Query(`SELECT key, value FROM settings WHERE key IN ('siteTitle','introText','heroImage','aboutEnabled','authorName')`)
 	if err != nil {
 		return settings, err
 	}
@@ -2319,6 +2842,8 @@ func (a *App) getPublicSettings() (siteSettings, error) {
 			settings.HeroImage = strings.TrimSpace(value)
 		case "aboutEnabled":
 			settings.AboutEnabled = strings.EqualFold(strings.TrimSpace(value), "true")
+		case "authorName":
+			settings.AuthorName = strings.TrimSpace(value)
 		}
 	}
 
@@ -2350,17 +2875,7 @@ func (a *App) getAboutContent() (string, bool, error) {
 
 func (a *App) servePreRenderedPage(w http.ResponseWriter, r *http.Request) bool {
 	path := r.URL.Path
-	scheme := "https"
-	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
-		scheme = proto
-	} else if r.TLS == nil {
-		scheme = "http"
-	}
-	host := r.Host
-	if host == "" {
-		host = "localhost"
-	}
-	siteBase := fmt.Sprintf("%s://%s", scheme, host)
+	siteBase := a.requestSiteBase(r)
 	if path == "" {
 		path = "/"
 	}
@@ -2379,6 +2894,18 @@ func (a *App) servePreRenderedPage(w http.ResponseWriter, r *http.Request) bool
 		page, err = a.renderArchivePage(currentURL, siteBase)
 	case path == "/about":
 		page, err = a.renderAboutPage(currentURL, siteBase)
+	case strings.HasPrefix(path, "/tags/"):
+		page, found, err = a.renderTagPage(strings.TrimPrefix(path, "/tags/"), currentURL, siteBase)
+		if err == nil && !found {
+			page, err = a.renderNotFoundPage(currentURL, siteBase)
+		}
+	case strings.HasPrefix(path, "/authors/"):
+		page, found, err = a.renderAuthorPage(strings.TrimPrefix(path, "/authors/"), currentURL, siteBase)
+		if err == nil && !found {
+			page, err = a.renderNotFoundPage(currentURL, siteBase)
+		}
+	case path == "/search":
+		page, err = a.renderSearchPage(currentURL, siteBase, r.URL.Query().Get("q"), a.isAuthenticated(r))
 	case strings.HasPrefix(path, "/posts/"):
 		page, found, err = a.renderPostPage(strings.TrimPrefix(path, "/posts/"), currentURL, siteBase)
 		if err == nil && !found {
@@ -2393,6 +2920,11 @@ func (a *App) servePreRenderedPage(w http.ResponseWriter, r *http.Request) bool
 		return false
 	}
 
+	if page.redirect != "" {
+		http.Redirect(w, r, page.redirect, http.StatusMovedPermanently)
+		return true
+	}
+
 	if page.body == "" {
 		return false
 	}
@@ -2436,6 +2968,7 @@ func (a *App) renderHomePage(currentURL, siteBase string) (pageRender, error) {
 		title := defaultPostTitle(p.Title, p.ID)
 		items = append(items, renderPostItem{
 			ID:    p.ID,
+			Path:  postPath(p),
 			Title: title,
 			Date:  displayDate(p),
 		})
@@ -2501,9 +3034,7 @@ func (a *App) renderHomePage(currentURL, siteBase string) (pageRender, error) {
 		)
 	}
 
-	linkTags := []linkTag{
-		{Rel: "alternate", Href: siteBase + "/rss.xml", Type: "application/rss+xml", Title: metaTitle},
-	}
+	linkTags := feedLinkTags(siteBase, metaTitle)
 
 	jsonLD := []string{}
 	if ld := buildJSONLD(map[string]any{
@@ -2543,20 +3074,39 @@ func (a *App) renderHomePage(currentURL, siteBase string) (pageRender, error) {
 }
 
 func (a *App) renderArchivePage(currentURL, siteBase string) (pageRender, error) {
-	settings, err := a.getPublicSettings()
+	posts, err := a.getPostsWithPrivacy(false)
 	if err != nil {
 		return pageRender{}, err
 	}
+	return a.renderPostListPage(postListPage{
+		heading: "Archive",
+		route:   "/archive",
+		posts:   posts,
+	}, currentURL, siteBase)
+}
 
-	posts, err := a.getPostsWithPrivacy(false)
+// postListPage describes an archive-style listing of public posts
+type postListPage struct {
+	heading  string
+	route    string
+	posts    []Post
+	feedPath string // optional feed scoped to this listing
+	feedName string
+	partial  bool // posts are a subset, so they must not seed the client's list cache
+}
+
+func (a *App) renderPostListPage(list postListPage, currentURL, siteBase string) (pageRender, error) {
+	settings, err := a.getPublicSettings()
 	if err != nil {
 		return pageRender{}, err
 	}
 
+	posts := list.posts
 	items := make([]renderPostItem, 0, len(posts))
 	for _, p := range posts {
 		items = append(items, renderPostItem{
 			ID:    p.ID,
+			Path:  postPath(p),
 			Title: defaultPostTitle(p.Title, p.ID),
 			Date:  displayDate(p),
 		})
@@ -2566,10 +3116,14 @@ func (a *App) renderArchivePage(currentURL, siteBase string) (pageRender, error)
 	data := struct {
 		SiteTitle    string
 		AboutEnabled bool
+		Heading      string
+		FeedPath     string
 		Posts        []renderPostItem
 	}{
 		SiteTitle:    settings.SiteTitle,
 		AboutEnabled: settings.AboutEnabled,
+		Heading:      list.heading,
+		FeedPath:     list.feedPath,
 		Posts:        items,
 	}
 
@@ -2577,9 +3131,9 @@ func (a *App) renderArchivePage(currentURL, siteBase string) (pageRender, error)
 		return pageRender{}, err
 	}
 
-	metaTitle := buildPageTitle("Archive", settings.SiteTitle)
+	metaTitle := buildPageTitle(list.heading, settings.SiteTitle)
 	if strings.TrimSpace(metaTitle) == "" {
-		metaTitle = "Archive — Noet"
+		metaTitle = list.heading + " — Noet"
 	}
 	meta := pageMeta{
 		title:       metaTitle,
@@ -2599,8 +3153,10 @@ func (a *App) renderArchivePage(currentURL, siteBase string) (pageRender, error)
 		{Name: "twitter:description", Content: meta.description},
 	}
 
-	linkTags := []linkTag{
-		{Rel: "alternate", Href: siteBase + "/rss.xml", Type: "application/rss+xml", Title: strings.TrimSpace(settings.SiteTitle)},
+	linkTags := feedLinkTags(siteBase, settings.SiteTitle)
+	if list.feedPath != "" {
+		scoped := linkTag{Rel: "alternate", Href: siteBase + list.feedPath, Type: "application/rss+xml", Title: list.feedName}
+		linkTags = append([]linkTag{scoped}, linkTags...)
 	}
 
 	jsonLD := []string{}
@@ -2613,14 +3169,18 @@ func (a *App) renderArchivePage(currentURL, siteBase string) (pageRender, error)
 		jsonLD = append(jsonLD, ld)
 	}
 
+	hydrate := map[string]any{
+		"route":    list.route,
+		"settings": settings,
+	}
+	if !list.partial {
+		hydrate["posts"] = posts
+	}
+
 	return pageRender{
-		body: buf.String(),
-		meta: meta,
-		hydrate: map[string]any{
-			"route":    "/archive",
-			"settings": settings,
-			"posts":    posts,
-		},
+		body:     buf.String(),
+		meta:     meta,
+		hydrate:  hydrate,
 		metaTags: metaTags,
 		linkTags: linkTags,
 		jsonLD:   jsonLD,
@@ -2710,16 +3270,17 @@ func (a *App) renderAboutPage(currentURL, siteBase string) (pageRender, error) {
 			},
 		},
 		metaTags: metaTags,
+		linkTags: feedLinkTags(siteBase, settings.SiteTitle),
 		jsonLD:   jsonLD,
 	}, nil
 }
-func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender, bool, error) {
-	id = strings.TrimSpace(id)
-	if id == "" {
+func (a *App) renderPostPage(ref, _, siteBase string) (pageRender, bool, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
 		return pageRender{}, false, nil
 	}
 
-	post, err := a.getPost(id)
+	post, redirected, err := a.resolvePostRef(ref)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return pageRender{}, false, nil
@@ -2731,12 +3292,32 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 		return pageRender{}, false, nil
 	}
 
+	// Old slugs permanently redirect to the post's current URL
+	if redirected {
+		return pageRender{redirect: postPath(post)}, true, nil
+	}
+	canonicalURL := strings.TrimRight(siteBase, "/") + postPath(post)
+
 	settings, err := a.getPublicSettings()
 	if err != nil {
 		return pageRender{}, false, err
 	}
 
 	title := defaultPostTitle(post.Title, post.ID)
+	// Everything below, including the hydration data, uses the safe HTML
+	post.Content = a.postContentHTML(post)
+
+	// Posts by accounts with an author page link to it; otherwise the
+	// site-wide author is credited
+	author := map[string]any{"@type": "Person", "name": feedAuthorName(settings)}
+	var authorName, authorHref string
+	if profile, ok := a.postAuthorProfile(post); ok && profile.hasAuthorPage() {
+		author = personJSONLD(profile, siteBase)
+		authorName = profile.name()
+		authorHref = authorPath(profile.Username)
+	} else if ok {
+		author["name"] = profile.name()
+	}
 
 	var buf bytes.Buffer
 	data := struct {
@@ -2744,13 +3325,19 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 		AboutEnabled bool
 		Title        string
 		Date         string
+		AuthorName   string
+		AuthorPath   string
 		Content      template.HTML
+		Tags         []string
 	}{
 		SiteTitle:    settings.SiteTitle,
 		AboutEnabled: settings.AboutEnabled,
 		Title:        title,
 		Date:         displayDate(post),
-		Content:      template.HTML(post.Content),
+		AuthorName:   authorName,
+		AuthorPath:   authorHref,
+		Content:      template.HTML(a.responsiveImages(post.Content)),
+		Tags:         post.Tags,
 	}
 
 	if err := postPageTemplate.Execute(&buf, data); err != nil {
@@ -2761,7 +3348,7 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 	meta := pageMeta{
 		title:       buildPageTitle(title, settings.SiteTitle),
 		description: description,
-		canonical:   currentURL,
+		canonical:   canonicalURL,
 	}
 
 	image := firstImageSrc(post.Content)
@@ -2775,7 +3362,7 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 		cardType = "summary_large_image"
 	}
 
-	published := post.CreatedAt.UTC().Format(time.RFC3339)
+	published := postPublishedTime(post).UTC().Format(time.RFC3339)
 	modifiedTime := post.UpdatedAt
 	if modifiedTime.IsZero() {
 		modifiedTime = post.CreatedAt
@@ -2787,7 +3374,7 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 		{Property: "og:title", Content: meta.title},
 		{Property: "og:description", Content: meta.description},
 		{Property: "og:type", Content: "article"},
-		{Property: "og:url", Content: currentURL},
+		{Property: "og:url", Content: canonicalURL},
 		{Property: "og:site_name", Content: strings.TrimSpace(settings.SiteTitle)},
 		{Property: "article:published_time", Content: published},
 		{Property: "article:modified_time", Content: modified},
@@ -2801,6 +3388,12 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 			metaTag{Name: "twitter:image", Content: image},
 		)
 	}
+	if authorHref != "" {
+		metaTags = append(metaTags, metaTag{Property: "article:author", Content: siteBase + authorHref})
+	}
+	for _, tag := range post.Tags {
+		metaTags = append(metaTags, metaTag{Property: "article:tag", Content: tag})
+	}
 
 	jsonLDData := map[string]any{
 		"@context":    "https://schema.org",
@@ -2809,7 +3402,7 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 		"description": description,
 		"mainEntityOfPage": map[string]any{
 			"@type": "WebPage",
-			"@id":   currentURL,
+			"@id":   canonicalURL,
 		},
 		"datePublished": published,
 		"dateModified":  modified,
@@ -2817,14 +3410,14 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 			"@type": "Organization",
 			"name":  strings.TrimSpace(settings.SiteTitle),
 		},
-		"author": map[string]any{
-			"@type": "Person",
-			"name":  strings.TrimSpace(settings.SiteTitle),
-		},
+		"author": author,
 	}
 	if image != "" {
 		jsonLDData["image"] = []string{image}
 	}
+	if len(post.Tags) > 0 {
+		jsonLDData["keywords"] = post.Tags
+	}
 	jsonLD := []string{}
 	if ld := buildJSONLD(jsonLDData); ld != "" {
 		jsonLD = append(jsonLD, ld)
@@ -2835,11 +3428,12 @@ func (a *App) renderPostPage(id string, currentURL, siteBase string) (pageRender
 		meta:   meta,
 		status: http.StatusOK,
 		hydrate: map[string]any{
-			"route":    fmt.Sprintf("/posts/%s", id),
+			"route":    postPath(post),
 			"settings": settings,
 			"post":     post,
 		},
 		metaTags: metaTags,
+		linkTags: feedLinkTags(siteBase, settings.SiteTitle),
 		jsonLD:   jsonLD,
 	}, true, nil
 }
@@ -3009,7 +3603,19 @@ func defaultPostTitle(title *string, id int64) string {
 	return fmt.Sprintf("Untitled Post %d", id)
 }
 
+// postPublishedTime is when a post went public, falling back to its creation
+// for posts that have never been published
+func postPublishedTime(p Post) time.Time {
+	if p.PublishedAt != nil && !p.PublishedAt.IsZero() {
+		return *p.PublishedAt
+	}
+	return p.CreatedAt
+}
+
 func displayDate(p Post) string {
+	if p.PublishedAt != nil && !p.PublishedAt.IsZero() {
+		return p.PublishedAt.Format("January 2, 2006")
+	}
 	if !p.UpdatedAt.IsZero() {
 		return p.UpdatedAt.Format("January 2, 2006")
 	}
@@ -2,10 +2,10 @@ package main
 
 import (
     "encoding/json"
+    "fmt"
     "io"
     "net/http"
     "net/http/httptest"
-    "os"
     "path/filepath"
     "strings"
     "testing"
@@ -34,16 +34,41 @@ func newTestApp(t *testing.T) *App {
     if err != nil {
         t.Fatalf("NewApp: %v", err)
     }
+    t.Cleanup(func() { _ = app.Close() })
     return app
 }
 
+// registerTestUser creates the initial account and returns its access token
+func registerTestUser(t *testing.T, baseURL string) string {
+    t.Helper()
+    resp, err := http.Post(baseURL+"/api/setup/register", "application/json", strings.NewReader(`{"username":"admin","password":"secret-password"}`))
+    if err != nil {
+        t.Fatalf("register: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        b, _ := io.ReadAll(resp.Body)
+        t.Fatalf("register status: %d body=%s", resp.StatusCode, string(b))
+    }
+    var out struct {
+        Token string `json:"token"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+        t.Fatalf("decode register: %v", err)
+    }
+    return out.Token
+}
+
 func TestCRUDHandlers(t *testing.T) {
     app := newTestApp(t)
     srv := httptest.NewServer(app.Mux)
     defer srv.Close()
+    token := registerTestUser(t, srv.URL)
 
     // Create
-    resp, err := http.Post(srv.URL+"/api/posts", "application/json", nil)
+    req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/posts", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := http.DefaultClient.Do(req)
     if err != nil {
         t.Fatalf("create: %v", err)
     }
@@ -60,7 +85,9 @@ func TestCRUDHandlers(t *testing.T) {
     }
 
     // List should include
-    resp, err = http.Get(srv.URL + "/api/posts")
+    req, _ = http.NewRequest(http.MethodGet, srv.URL+"/api/posts", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err = http.DefaultClient.Do(req)
     if err != nil {
         t.Fatalf("list: %v", err)
     }
@@ -78,8 +105,9 @@ func TestCRUDHandlers(t *testing.T) {
 
     // Update content and auto title
     html := "<h1>My Title</h1><p>Body</p>"
-    req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/posts/"+itoa(created.ID), strings.NewReader(`{"content":`+toJSON(html)+`}`))
+    req, _ = http.NewRequest(http.MethodPut, srv.URL+"/api/posts/"+itoa(created.ID), strings.NewReader(`{"content":`+toJSON(html)+`}`))
     req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Authorization", "Bearer "+token)
     resp, err = http.DefaultClient.Do(req)
     if err != nil {
         t.Fatalf("update: %v", err)
@@ -101,7 +129,9 @@ func TestCRUDHandlers(t *testing.T) {
     }
 
     // Read by id
-    resp, err = http.Get(srv.URL + "/api/posts/" + itoa(created.ID))
+    req, _ = http.NewRequest(http.MethodGet, srv.URL+"/api/posts/"+itoa(created.ID), nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err = http.DefaultClient.Do(req)
     if err != nil {
         t.Fatalf("get: %v", err)
     }
@@ -119,6 +149,7 @@ func TestCRUDHandlers(t *testing.T) {
 
     // Delete
     req, _ = http.NewRequest(http.MethodDelete, srv.URL+"/api/posts/"+itoa(created.ID), nil)
+    req.Header.Set("Authorization", "Bearer "+token)
     resp, err = http.DefaultClient.Do(req)
     if err != nil {
         t.Fatalf("delete: %v", err)
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	profileDisplayNameMax = 100
+	profileBioMax         = 20000
+	profileMaxLinks       = 10
+	profileLinkLabelMax   = 100
+)
+
+var errAvatarNotUploaded = errors.New("avatar must be an uploaded image")
+
+type ProfileLink struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// UserProfile is the public face of an account on author pages and in
+// post metadata. Bio is HTML, sanitized with htmlPolicy whatever the role.
+type UserProfile struct {
+	ID          int64         `json:"id"`
+	Username    string        `json:"username"`
+	DisplayName string        `json:"displayName"`
+	Bio         string        `json:"bio"`
+	Avatar      string        `json:"avatar"`
+	Links       []ProfileLink `json:"links"`
+	Role        string        `json:"-"`
+}
+
+// name returns the display name, falling back to the username
+func (p UserProfile) name() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return p.Username
+}
+
+var authorPageTemplate = template.Must(template.New("author_ssr").Parse(`
+<div class="home-container">
+  <header class="site-header ssr-header">
+    <div class="site-header-content">
+      <div class="site-title">{{.SiteTitle}}</div>
+      <nav class="header-actions ssr-nav" aria-label="Primary">
+        <a class="header-button" href="/">Home</a>
+        <a class="header-button" href="/archive">Archive</a>
+        {{if .AboutEnabled}}<a class="header-button" href="/about">About Me</a>{{end}}
+        <a class="header-button" href="/search">Search</a>
+        <a class="header-button" href="/rss.xml">RSS</a>
+      </nav>
+    </div>
+  </header>
+  <main class="home-content author-profile">
+    {{if .Avatar}}<img class="author-avatar" src="{{.Avatar}}" alt="" width="96" height="96">{{end}}
+    <h1>{{.Name}}</h1>
+    {{if .Bio}}<div class="post-content author-bio">{{.Bio}}</div>{{end}}
+    {{if .Links}}<ul class="author-links">{{range .Links}}<li><a href="{{.URL}}" rel="me noopener">{{.Label}}</a></li>{{end}}</ul>{{end}}
+    <p class="post-meta"><a href="{{.FeedPath}}">RSS feed</a></p>
+    {{if .Posts}}
+    <ul class="post-list">
+      {{range .Posts}}
+      <li>
+        <a class="post-link" href="{{.Path}}">
+          <span class="post-title">{{.Title}}</span>
+          <span class="post-meta"> — {{.Date}}</span>
+        </a>
+      </li>
+      {{end}}
+    </ul>
+    {{else}}
+    <p>No posts yet.</p>
+    {{end}}
+  </main>
+</div>`))
+
+// authorPath returns the site-relative URL of an author page
+func authorPath(username string) string {
+	return "/authors/" + username
+}
+
+const profileColumns = `id, username, role, display_name, bio, avatar, links`
+
+func scanProfile(row rowScanner) (UserProfile, error) {
+	var p UserProfile
+	var links string
+	if err := row.Scan(&p.ID, &p.Username, &p.Role, &p.DisplayName, &p.Bio, &p.Avatar, &links); err != nil {
+		return UserProfile{}, err
+	}
+	p.Links = []ProfileLink{}
+	if links != "" {
+		if err := json.Unmarshal([]byte(links), &p.Links); err != nil {
+			return UserProfile{}, fmt.Errorf("failed to decode profile links: %v", err)
+		}
+	}
+	return p, nil
+}
+
+func (a *App) getProfile(userID int64) (UserProfile, error) {
+	return scanProfile(a.DB.QueryRow(`SELECT `+profileColumns+` FROM users WHERE id = ?`, userID))
+}
+
+// getProfileByUsername looks a profile up regardless of username case
+func (a *App) getProfileByUsername(username string) (UserProfile, error) {
+	return scanProfile(a.DB.QueryRow(`SELECT `+profileColumns+` FROM users WHERE username = ? COLLATE NOCASE`, username))
+}
+
+// hasAuthorPage reports whether the account publishes under /authors/;
+// viewers never write, so they have no public presence
+func (p UserProfile) hasAuthorPage() bool {
+	return roleAtLeast(p.Role, roleAuthor)
+}
+
+// normalizeProfile validates user-supplied profile fields
+func normalizeProfile(p UserProfile) (UserProfile, error) {
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	if strings.ContainsAny(p.DisplayName, "\r\n") || utf8.RuneCountInString(p.DisplayName) > profileDisplayNameMax {
+		return p, fmt.Errorf("display name must be a single line of at most %d characters", profileDisplayNameMax)
+	}
+	p.Bio = strings.TrimSpace(p.Bio)
+	if !utf8.ValidString(p.Bio) || len(p.Bio) > profileBioMax {
+		return p, fmt.Errorf("bio must be valid UTF-8 of at most %d bytes", profileBioMax)
+	}
+	p.Bio = sanitizeHTML(p.Bio)
+	p.Avatar = strings.TrimSpace(p.Avatar)
+	if p.Avatar != "" && (!strings.HasPrefix(p.Avatar, "/api/uploads/") || strings.ContainsAny(p.Avatar, "?#")) {
+		return p, errAvatarNotUploaded
+	}
+
+	if len(p.Links) > profileMaxLinks {
+		return p, fmt.Errorf("at most %d links are allowed", profileMaxLinks)
+	}
+	links := []ProfileLink{}
+	for _, link := range p.Links {
+		link.Label = strings.TrimSpace(link.Label)
+		link.URL = strings.TrimSpace(link.URL)
+		u, err := url.Parse(link.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return p, fmt.Errorf("link %q must be an http(s) URL", link.URL)
+		}
+		if link.Label == "" {
+			link.Label = u.Host
+		}
+		if strings.ContainsAny(link.Label, "\r\n") || utf8.RuneCountInString(link.Label) > profileLinkLabelMax {
+			return p, fmt.Errorf("link labels must be a single line of at most %d characters", profileLinkLabelMax)
+		}
+		links = append(links, link)
+	}
+	p.Links = links
+	return p, nil
+}
+
+// updateProfile stores validated profile fields for a user
+func (a *App) updateProfile(userID int64, p UserProfile) error {
+	if p.Avatar != "" {
+		var exists bool
+		filename := strings.TrimPrefix(p.Avatar, "/api/uploads/")
+		if err := a.DB.QueryRow(`SELECT COUNT(*) > 0 FROM attachments WHERE filename = ?`, filename).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return errAvatarNotUploaded
+		}
+	}
+
+	links, err := json.Marshal(p.Links)
+	if err != nil {
+		return err
+	}
+	_, err = a.DB.Exec(`UPDATE users SET display_name = ?, bio = ?, avatar = ?, links = ? WHERE id = ?`,
+		p.DisplayName, p.Bio, p.Avatar, string(links), userID)
+	return err
+}
+
+// postAuthorProfile returns the profile of a post's author, if the account
+// still exists
+func (a *App) postAuthorProfile(p Post) (UserProfile, bool) {
+	if p.AuthorID == nil {
+		return UserProfile{}, false
+	}
+	profile, err := a.getProfile(*p.AuthorID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			a.Logger.Error("Failed to load post author", "postID", p.ID, "error", err.Error())
+		}
+		return UserProfile{}, false
+	}
+	return profile, true
+}
+
+// personJSONLD describes an author as a schema.org Person
+func personJSONLD(p UserProfile, siteBase string) map[string]any {
+	person := map[string]any{
+		"@type": "Person",
+		"name":  p.name(),
+		"url":   siteBase + authorPath(p.Username),
+	}
+	if p.Avatar != "" {
+		person["image"] = makeAbsoluteAssetURL(siteBase, p.Avatar)
+	}
+	if bio := truncateWithEllipsis(stripHTML(p.Bio), 160); bio != "" {
+		person["description"] = bio
+	}
+	if len(p.Links) > 0 {
+		sameAs := make([]string, 0, len(p.Links))
+		for _, link := range p.Links {
+			sameAs = append(sameAs, link.URL)
+		}
+		person["sameAs"] = sameAs
+	}
+	return person
+}
+
+// getPostsByAuthor lists an author's posts, honouring privacy like
+// getPostsWithPrivacy
+func (a *App) getPostsByAuthor(userID int64, isAuthenticated bool) ([]Post, error) {
+	order := publicPostOrder
+	if isAuthenticated {
+		order = `ORDER BY updated_at DESC, created_at DESC`
+	}
+	rows, err := a.DB.Query(`
+        SELECT `+postColumns+` FROM posts
+        WHERE (? OR is_private = 0) AND author_id = ?
+        `+order, isAuthenticated, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := a.attachPostTags(posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// handleProfile reads (GET) or updates (PUT) the caller's own profile
+func (a *App) handleProfile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			profile, err := a.getProfile(requestClaims(r).UserID)
+			if err != nil {
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			_ = json.NewEncoder(w).Encode(profile)
+		})(w, r)
+	case http.MethodPut:
+		// Profiles are public on author pages, which only writers have
+		a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
+			var payload UserProfile
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			profile, err := normalizeProfile(payload)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			userID := requestClaims(r).UserID
+			if err := a.updateProfile(userID, profile); err != nil {
+				if errors.Is(err, errAvatarNotUploaded) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				a.Logger.Error("Failed to update profile", "userID", userID, "error", err.Error())
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			a.Logger.Info("Profile updated", "userID", userID)
+
+			updated, err := a.getProfile(userID)
+			if err != nil {
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(updated)
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// lookupAuthor resolves an author page reference to a profile that has one
+func (a *App) lookupAuthor(username string) (UserProfile, bool, error) {
+	if validateUsername(username) != nil {
+		return UserProfile{}, false, nil
+	}
+	profile, err := a.getProfileByUsername(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserProfile{}, false, nil
+	}
+	if err != nil {
+		return UserProfile{}, false, err
+	}
+	// Bios saved before they were sanitized on write
+	profile.Bio = sanitizeHTML(profile.Bio)
+	return profile, profile.hasAuthorPage(), nil
+}
+
+// handleAuthor returns an author's public profile and their posts
+func (a *App) handleAuthor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profile, found, err := a.lookupAuthor(r.PathValue("username"))
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	posts, err := a.getPostsByAuthor(profile.ID, a.isAuthenticated(r))
+	if err != nil {
+		a.Logger.Error("Failed to load author posts", "userID", profile.ID, "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if posts == nil {
+		posts = []Post{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"profile": profile,
+		"posts":   posts,
+	})
+}
+
+// handleAuthorFeed serves the RSS feed of an author's public posts
+func (a *App) handleAuthorFeed(w http.ResponseWriter, r *http.Request) {
+	profile, found, err := a.lookupAuthor(r.PathValue("username"))
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	load := func() (feedSource, error) {
+		posts, err := a.getPostsByAuthor(profile.ID, false)
+		if err != nil {
+			return feedSource{}, err
+		}
+		src, err := a.newFeedSource(posts)
+		if err != nil {
+			return feedSource{}, err
+		}
+		src.title = buildPageTitle(profile.name(), strings.TrimSpace(src.settings.SiteTitle))
+		src.homePath = authorPath(profile.Username)
+		src.rssPath = authorPath(profile.Username) + "/rss.xml"
+		return src, nil
+	}
+	a.serveFeed(w, r, "application/rss+xml; charset=utf-8", load, a.buildRSSFeed)
+}
+
+// renderAuthorPage shows an author's profile and public posts.
+// Differently cased usernames redirect to the canonical URL.
+func (a *App) renderAuthorPage(ref, currentURL, siteBase string) (pageRender, bool, error) {
+	profile, found, err := a.lookupAuthor(ref)
+	if err != nil || !found {
+		return pageRender{}, false, err
+	}
+	if profile.Username != ref {
+		return pageRender{redirect: authorPath(profile.Username)}, true, nil
+	}
+
+	settings, err := a.getPublicSettings()
+	if err != nil {
+		return pageRender{}, false, err
+	}
+	posts, err := a.getPostsByAuthor(profile.ID, false)
+	if err != nil {
+		return pageRender{}, false, err
+	}
+
+	items := make([]renderPostItem, 0, len(posts))
+	for _, p := range posts {
+		items = append(items, renderPostItem{
+			ID:    p.ID,
+			Path:  postPath(p),
+			Title: defaultPostTitle(p.Title, p.ID),
+			Date:  displayDate(p),
+		})
+	}
+
+	path := authorPath(profile.Username)
+	var buf bytes.Buffer
+	data := struct {
+		SiteTitle    string
+		AboutEnabled bool
+		Name         string
+		Avatar       string
+		Bio          template.HTML
+		Links        []ProfileLink
+		FeedPath     string
+		Posts        []renderPostItem
+	}{
+		SiteTitle:    settings.SiteTitle,
+		AboutEnabled: settings.AboutEnabled,
+		Name:         profile.name(),
+		Avatar:       profile.Avatar,
+		Bio:          template.HTML(profile.Bio),
+		Links:        profile.Links,
+		FeedPath:     path + "/rss.xml",
+		Posts:        items,
+	}
+	if err := authorPageTemplate.Execute(&buf, data); err != nil {
+		return pageRender{}, false, err
+	}
+
+	description := truncateWithEllipsis(stripHTML(profile.Bio), 160)
+	if description == "" {
+		description = fmt.Sprintf("Posts by %s", profile.name())
+	}
+	canonicalURL := siteBase + path
+	meta := pageMeta{
+		title:       buildPageTitle(profile.name(), settings.SiteTitle),
+		description: description,
+		canonical:   canonicalURL,
+	}
+
+	metaTags := []metaTag{
+		{Name: "robots", Content: "index,follow"},
+		{Property: "og:title", Content: meta.title},
+		{Property: "og:description", Content: meta.description},
+		{Property: "og:type", Content: "profile"},
+		{Property: "og:url", Content: canonicalURL},
+		{Property: "og:site_name", Content: strings.TrimSpace(settings.SiteTitle)},
+		{Property: "profile:username", Content: profile.Username},
+		{Name: "twitter:card", Content: "summary"},
+		{Name: "twitter:title", Content: meta.title},
+		{Name: "twitter:description", Content: meta.description},
+	}
+	if profile.Avatar != "" {
+		image := makeAbsoluteAssetURL(siteBase, profile.Avatar)
+		metaTags = append(metaTags,
+			metaTag{Property: "og:image", Content: image},
+			metaTag{Name: "twitter:image", Content: image},
+		)
+	}
+
+	feedName := buildPageTitle(profile.name(), strings.TrimSpace(settings.SiteTitle))
+	linkTags := append([]linkTag{{Rel: "alternate", Href: siteBase + path + "/rss.xml", Type: "application/rss+xml", Title: feedName}},
+		feedLinkTags(siteBase, settings.SiteTitle)...)
+
+	jsonLD := []string{}
+	if ld := buildJSONLD(map[string]any{
+		"@context":   "https://schema.org",
+		"@type":      "ProfilePage",
+		"url":        canonicalURL,
+		"mainEntity": personJSONLD(profile, siteBase),
+	}); ld != "" {
+		jsonLD = append(jsonLD, ld)
+	}
+
+	return pageRender{
+		body:   buf.String(),
+		meta:   meta,
+		status: http.StatusOK,
+		hydrate: map[string]any{
+			"route":    path,
+			"settings": settings,
+		},
+		metaTags: metaTags,
+		linkTags: linkTags,
+		jsonLD:   jsonLD,
+	}, true, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfileUpdateValidates(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	author := createTestAccount(t, app, "ada", roleAuthor)
+	viewer := createTestAccount(t, app, "reader", roleViewer)
+
+	for _, body := range []string{
+		`{"displayName":"two\nlines"}`,
+		`{"avatar":"https://elsewhere.example/me.png"}`,
+		`{"avatar":"/api/uploads/missing.png"}`,
+		`{"links":[{"label":"x","url":"javascript:alert(1)"}]}`,
+	} {
+		if status, resp := doJSON(t, http.MethodPut, srv.URL+"/api/profile", author, body); status != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d %s", body, status, resp)
+		}
+	}
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/profile", viewer, `{"displayName":"Reader"}`); status != http.StatusForbidden {
+		t.Fatalf("viewer edited a public profile: %d", status)
+	}
+
+	app.DB.Exec(`INSERT INTO attachments (filename, original_name, mime_type, size, created_at)
+        VALUES ('ada.png', 'ada.png', 'image/png', 10, CURRENT_TIMESTAMP)`)
+	update := `{"displayName":"Ada Lovelace","bio":"<p>Analyst<img src=x onerror=alert(1)></p><script>alert(2)</script>","avatar":"/api/uploads/ada.png",
+        "links":[{"label":"","url":"https://example.com/ada"}]}`
+	status, body := doJSON(t, http.MethodPut, srv.URL+"/api/profile", author, update)
+	if status != http.StatusOK {
+		t.Fatalf("update profile: %d %s", status, body)
+	}
+
+	status, body = doJSON(t, http.MethodGet, srv.URL+"/api/profile", author, "")
+	var profile UserProfile
+	_ = json.Unmarshal(body, &profile)
+	if status != http.StatusOK || profile.DisplayName != "Ada Lovelace" || len(profile.Links) != 1 ||
+		profile.Links[0].Label != "example.com" {
+		t.Fatalf("unexpected profile: %d %s", status, body)
+	}
+	if profile.Bio != `<p>Analyst<img src="x"></p>` {
+		t.Fatalf("bio not sanitized: %q", profile.Bio)
+	}
+
+	// Bios stored before sanitizing are cleaned when shown
+	app.DB.Exec(`UPDATE users SET bio = ? WHERE username = 'ada'`, `<p>Old</p><img src=x onerror="alert(3)"><script>alert(4)</script>`)
+	page := getBodyOK(t, srv.URL+"/authors/ada")
+	if strings.Contains(page, "alert(") || !strings.Contains(page, "<p>Old</p>") {
+		t.Fatalf("unsafe bio rendered:\n%s", page)
+	}
+}
+
+func TestAuthorPageAndFeed(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	createTestAccount(t, app, "ada", roleAuthor)
+	app.DB.Exec(`UPDATE users SET display_name = 'Ada Lovelace', links = '[{"label":"Site","url":"https://example.com/ada"}]'
+        WHERE username = 'ada'`)
+
+	public := insertTestPost(t, app, "Engines", "<h1>Engines</h1>", false)
+	secret := insertTestPost(t, app, "Draft", "<h1>Draft</h1>", true)
+	app.DB.Exec(`UPDATE posts SET author_id = (SELECT id FROM users WHERE username = 'ada') WHERE id IN (?, ?)`, public, secret)
+
+	page := getBodyOK(t, srv.URL+"/authors/ada")
+	if !strings.Contains(page, "Ada Lovelace") || !strings.Contains(page, "Engines") || strings.Contains(page, "Draft") {
+		t.Fatalf("author page does not list public posts only:\n%s", page)
+	}
+	if !strings.Contains(page, `"mainEntity":{"@type":"Person","name":"Ada Lovelace","sameAs":["https://example.com/ada"]`) {
+		t.Fatalf("author page missing Person JSON-LD:\n%s", page)
+	}
+
+	feed := getBodyOK(t, srv.URL+"/authors/ada/rss.xml")
+	if !strings.Contains(feed, "Engines") || strings.Contains(feed, "Draft") {
+		t.Fatalf("unexpected author feed:\n%s", feed)
+	}
+
+	post := getBodyOK(t, srv.URL+"/posts/"+itoa(public))
+	if !strings.Contains(post, `property="article:author" content="`+srv.URL+`/authors/ada"`) {
+		t.Fatalf("post page missing article:author:\n%s", post)
+	}
+
+	// Case variants redirect; unknown authors and viewers have no page
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(srv.URL + "/authors/ADA")
+	if err != nil {
+		t.Fatalf("get author page: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/authors/ada" {
+		t.Fatalf("expected redirect to canonical author URL, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	createTestAccount(t, app, "reader", roleViewer)
+	for _, path := range []string{"/authors/nobody/rss.xml", "/authors/reader/rss.xml", "/api/authors/reader"} {
+		if status, _ := doJSON(t, http.MethodGet, srv.URL+path, "", ""); status != http.StatusNotFound {
+			t.Errorf("expected 404 for %s, got %d", path, status)
+		}
+	}
+}
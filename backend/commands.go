@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// commandUsage lists the administrative subcommands of the noet binary
+const commandUsage = `usage: noet [command]
+
+Without a command noet starts the web server.
+
+commands:
+  reset-password [-ttl 1h] <username>
+        print a one-time link that lets <username> choose a new password
+  rotate-jwt-key
+        sign new access tokens with a fresh key; tokens signed with the
+        old key stay valid for NOET_JWT_KEY_GRACE`
+
+// runCommand executes an administrative subcommand against the database
+func (a *App) runCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", commandUsage)
+	}
+	switch args[0] {
+	case "reset-password":
+		return a.resetPasswordCommand(args[1:], out)
+	case "rotate-jwt-key":
+		key, err := rotateJWTKey(a.DB, a.tokens.keyGrace)
+		if err != nil {
+			return err
+		}
+		a.Logger.Info("JWT signing key rotated", "kid", key.id)
+		fmt.Fprintf(out, "New signing key %s; running servers pick it up within %s\n", key.id, jwtKeyReload)
+		return nil
+	case "help", "-h", "--help":
+		fmt.Fprintln(out, commandUsage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], commandUsage)
+	}
+}
+
+// resetPasswordCommand prints a one-time password reset link. Noet sends no
+// email, so an operator with shell access hands the link over themselves.
+func (a *App) resetPasswordCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	fs.SetOutput(out)
+	ttl := fs.Duration("ttl", passwordResetTTL, "how long the link stays valid")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *ttl <= 0 {
+		return fmt.Errorf("usage: noet reset-password [-ttl 1h] <username>")
+	}
+
+	user, token, err := a.createPasswordReset(fs.Arg(0), *ttl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user named %q", fs.Arg(0))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create reset link: %v", err)
+	}
+	a.Logger.Info("Password reset link issued", "userID", user.ID, "username", user.Username)
+
+	base := a.configuredBaseURL()
+	if base == "" {
+		// Without NOET_BASE_URL or site_url the public origin is unknown
+		base = "http://localhost:8081"
+	}
+	fmt.Fprintf(out, "Password reset link for %s (valid until %s):\n%s/reset-password?token=%s\n",
+		user.Username, time.Now().Add(*ttl).Format(time.RFC1123), base, token)
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Post event kinds published by the post handlers
+const (
+	postEventCreated = "post-created"
+	postEventUpdated = "post-updated"
+	postEventDeleted = "post-deleted"
+	postEventPrivacy = "post-privacy-toggled"
+)
+
+const (
+	// postEventHistorySize is how many events are kept for Last-Event-ID resumption
+	postEventHistorySize = 256
+	// postEventBuffer is the per-subscriber channel size; slower clients are dropped
+	postEventBuffer = 64
+)
+
+// sseHeartbeatInterval keeps idle connections alive through proxies and is
+// how often a signed-in stream re-checks its token; tests shorten it
+var sseHeartbeatInterval = 25 * time.Second
+
+type postEvent struct {
+	ID   int64
+	Kind string
+	Post Post
+}
+
+// postBroker fans out post change events to SSE subscribers and keeps a short
+// history so reconnecting clients can resume from their last seen event
+type postBroker struct {
+	mu          sync.Mutex
+	nextID      int64
+	history     []postEvent
+	subscribers map[chan postEvent]struct{}
+	closed      bool
+}
+
+func newPostBroker() *postBroker {
+	return &postBroker{
+		// Seed IDs from the clock so they keep increasing across restarts
+		nextID:      time.Now().UnixMilli(),
+		subscribers: make(map[chan postEvent]struct{}),
+	}
+}
+
+func (b *postBroker) publish(kind string, post Post) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	ev := postEvent{ID: b.nextID, Kind: kind, Post: post}
+	b.history = append(b.history, ev)
+	if len(b.history) > postEventHistorySize {
+		b.history = b.history[len(b.history)-postEventHistorySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Subscriber is not keeping up; drop it so it reconnects and resyncs
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a new subscriber. When lastEventID is covered by the
+// history, the missed events are returned and resumed is true; otherwise the
+// caller must send a full snapshot.
+func (b *postBroker) subscribe(lastEventID int64) (ch chan postEvent, missed []postEvent, currentID int64, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch = make(chan postEvent, postEventBuffer)
+	if b.closed {
+		close(ch)
+		return ch, nil, b.nextID, false
+	}
+	b.subscribers[ch] = struct{}{}
+
+	if lastEventID > 0 && lastEventID <= b.nextID {
+		oldest := b.nextID + 1
+		if len(b.history) > 0 {
+			oldest = b.history[0].ID
+		}
+		if lastEventID >= oldest-1 {
+			for _, ev := range b.history {
+				if ev.ID > lastEventID {
+					missed = append(missed, ev)
+				}
+			}
+			return ch, missed, b.nextID, true
+		}
+	}
+
+	return ch, nil, b.nextID, false
+}
+
+func (b *postBroker) unsubscribe(ch chan postEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close disconnects every subscriber, used during server shutdown
+func (b *postBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// ShutdownStreams disconnects all live event streams so graceful shutdown
+// does not wait on long-lived SSE connections
+func (a *App) ShutdownStreams() {
+	a.events.close()
+}
+
+// wireEvent translates a post event into the SSE event name and payload a
+// subscriber should receive, hiding private posts from anonymous readers
+func wireEvent(ev postEvent, authenticated bool) (string, any, bool) {
+	deleted := map[string]int64{"id": ev.Post.ID}
+
+	switch ev.Kind {
+	case postEventCreated, postEventUpdated:
+		if ev.Post.IsPrivate && !authenticated {
+			return "", nil, false
+		}
+		return ev.Kind, ev.Post, true
+	case postEventDeleted:
+		if ev.Post.IsPrivate && !authenticated {
+			return "", nil, false
+		}
+		return postEventDeleted, deleted, true
+	case postEventPrivacy:
+		if authenticated {
+			return postEventUpdated, ev.Post, true
+		}
+		// For anonymous readers a post becoming public appears, and a post
+		// becoming private disappears
+		if ev.Post.IsPrivate {
+			return postEventDeleted, deleted, true
+		}
+		return postEventCreated, ev.Post, true
+	}
+	return "", nil, false
+}
+
+func writeSSEEvent(w http.ResponseWriter, id int64, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+func (a *App) handlePostStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// EventSource cannot set headers, so the token travels in the query string
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			token = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+	}
+	var claims *Claims
+	if token != "" {
+		var err error
+		if claims, err = a.validateBearerToken(token); err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if !claims.hasScope(scopePostsRead) {
+			http.Error(w, "API token lacks the "+scopePostsRead+" scope", http.StatusForbidden)
+			return
+		}
+	}
+	isAuth := claims != nil
+
+	rc := http.NewResponseController(w)
+
+	var lastEventID int64
+	if raw := r.Header.Get("Last-Event-ID"); raw != "" {
+		lastEventID, _ = strconv.ParseInt(raw, 10, 64)
+	}
+
+	ch, missed, currentID, resumed := a.events.subscribe(lastEventID)
+	defer a.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprint(w, "retry: 5000\n\n"); err != nil {
+		return
+	}
+
+	if resumed {
+		a.Logger.Debug("Resuming post stream", "lastEventID", lastEventID, "missed", len(missed))
+		for _, ev := range missed {
+			if name, data, ok := wireEvent(ev, isAuth); ok {
+				if err := writeSSEEvent(w, ev.ID, name, data); err != nil {
+					return
+				}
+			}
+		}
+	} else {
+		posts, err := a.getPostsWithPrivacy(isAuth)
+		if err != nil {
+			a.Logger.Error("Failed to load post stream snapshot", "error", err)
+			return
+		}
+		if posts == nil {
+			posts = []Post{}
+		}
+		if err := writeSSEEvent(w, currentID, "snapshot", posts); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		a.Logger.Debug("Post stream does not support flushing", "error", err)
+		return
+	}
+
+	a.Logger.Debug("Post stream subscriber connected", "authenticated", isAuth, "resumed", resumed)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if isAuth && claims.ExpiresAt != nil && !time.Now().Before(claims.ExpiresAt.Time) {
+				a.Logger.Debug("Closing post stream, access token expired", "userID", claims.UserID)
+				return
+			}
+			name, data, send := wireEvent(ev, isAuth)
+			if !send {
+				continue
+			}
+			if err := writeSSEEvent(w, ev.ID, name, data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// Logging out, revoking the session or the API token, or the
+			// access token expiring ends the stream; clients reconnect with
+			// a fresh token
+			if isAuth {
+				if _, err := a.validateBearerToken(token); err != nil {
+					a.Logger.Debug("Closing post stream, token no longer valid", "userID", claims.UserID, "error", err)
+					return
+				}
+			}
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
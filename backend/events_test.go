@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostBrokerResume(t *testing.T) {
+	b := newPostBroker()
+
+	ch, _, current, _ := b.subscribe(0)
+	b.publish(postEventCreated, Post{ID: 1})
+	b.publish(postEventUpdated, Post{ID: 1})
+	first := <-ch
+	<-ch
+	b.unsubscribe(ch)
+
+	if first.ID != current+1 {
+		t.Fatalf("expected first event id %d, got %d", current+1, first.ID)
+	}
+
+	_, missed, _, resumed := b.subscribe(first.ID)
+	if !resumed || len(missed) != 1 || missed[0].Kind != postEventUpdated {
+		t.Fatalf("expected to resume with one missed event, got resumed=%v missed=%+v", resumed, missed)
+	}
+
+	if _, _, _, resumed := b.subscribe(1); resumed {
+		t.Fatalf("expected unknown event id to require a snapshot")
+	}
+}
+
+func TestWireEventHidesPrivatePosts(t *testing.T) {
+	private := postEvent{ID: 1, Kind: postEventUpdated, Post: Post{ID: 7, IsPrivate: true}}
+	if _, _, ok := wireEvent(private, false); ok {
+		t.Fatalf("private post update must not reach anonymous subscribers")
+	}
+	if name, _, ok := wireEvent(private, true); !ok || name != postEventUpdated {
+		t.Fatalf("authenticated subscribers should see private updates")
+	}
+
+	unpublished := postEvent{ID: 2, Kind: postEventPrivacy, Post: Post{ID: 7, IsPrivate: true}}
+	if name, _, ok := wireEvent(unpublished, false); !ok || name != postEventDeleted {
+		t.Fatalf("unpublished post should appear deleted to anonymous subscribers, got %q", name)
+	}
+}
+
+func TestPostStreamSnapshot(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	insertTestPost(t, app, "Streamed", "<h1>Streamed</h1>", false)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(srv.URL + "/api/posts/stream")
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		if strings.HasPrefix(line, "event: snapshot") {
+			data, _ := reader.ReadString('\n')
+			if !strings.Contains(data, "Streamed") {
+				t.Fatalf("snapshot missing post: %s", data)
+			}
+			return
+		}
+	}
+}
+
+// openStream connects to the post stream and reads up to the snapshot
+func openStream(t *testing.T, url string) (*http.Response, *bufio.Reader, string) {
+	t.Helper()
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	reader := bufio.NewReader(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return resp, reader, ""
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		if strings.HasPrefix(line, "event: snapshot") {
+			data, _ := reader.ReadString('\n')
+			return resp, reader, data
+		}
+	}
+}
+
+func TestPostStreamAuthentication(t *testing.T) {
+	heartbeat := sseHeartbeatInterval
+	sseHeartbeatInterval = 50 * time.Millisecond
+	defer func() { sseHeartbeatInterval = heartbeat }()
+
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+	insertTestPost(t, app, "Secret draft", "<h1>Secret draft</h1>", true)
+
+	// API tokens work like everywhere else, given posts:read
+	_, reader, _ := app.createAPIToken(1, "reader", []string{scopePostsRead}, 0)
+	resp, _, snapshot := openStream(t, srv.URL+"/api/posts/stream?token="+reader)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(snapshot, "Secret draft") {
+		t.Fatalf("API token stream: %d %s", resp.StatusCode, snapshot)
+	}
+	_, writer, _ := app.createAPIToken(1, "writer", []string{scopePostsWrite}, 0)
+	resp, _, _ = openStream(t, srv.URL+"/api/posts/stream?token="+writer)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("stream without posts:read: %d", resp.StatusCode)
+	}
+
+	// Logging out ends a signed-in stream
+	resp, stream, snapshot := openStream(t, srv.URL+"/api/posts/stream?token="+token)
+	defer resp.Body.Close()
+	if !strings.Contains(snapshot, "Secret draft") {
+		t.Fatalf("signed-in snapshot missing private post: %s", snapshot)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/logout", token, ""); status != http.StatusNoContent {
+		t.Fatalf("logout: %d", status)
+	}
+	for {
+		if _, err := stream.ReadString('\n'); err != nil {
+			if err != io.EOF {
+				t.Fatalf("stream not closed after logout: %v", err)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// feedMaxItems caps the number of entries published in syndication feeds
+const feedMaxItems = 50
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	Generator     string      `xml:"generator"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Content     xmlCDATA `xml:"content:encoded"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type xmlCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	XMLNS     string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href  string `xml:"href,attr"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Links     []atomLink `xml:"link"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+// feedImage describes the lead image of a post for feed attachments
+type feedImage struct {
+	url      string
+	mimeType string
+	size     int64
+}
+
+// feedSource holds everything needed to render a feed in any format.
+// title, homePath and rssPath let filtered feeds describe themselves.
+type feedSource struct {
+	settings     siteSettings
+	posts        []Post
+	lastModified time.Time
+	title        string
+	homePath     string
+	rssPath      string
+}
+
+func (a *App) loadFeedSource() (feedSource, error) {
+	posts, err := a.getPostsWithPrivacy(false)
+	if err != nil {
+		return feedSource{}, err
+	}
+	return a.newFeedSource(posts)
+}
+
+// newFeedSource wraps public posts in a site-wide feed source that callers
+// may narrow by overriding title, homePath and rssPath
+func (a *App) newFeedSource(posts []Post) (feedSource, error) {
+	settings, err := a.getPublicSettings()
+	if err != nil {
+		return feedSource{}, err
+	}
+
+	var lastModified time.Time
+	for _, p := range posts {
+		if p.UpdatedAt.After(lastModified) {
+			lastModified = p.UpdatedAt
+		}
+	}
+
+	if len(posts) > feedMaxItems {
+		posts = posts[:feedMaxItems]
+	}
+	// Feeds carry post HTML as the site renders it, sanitized where the
+	// author isn't trusted with raw HTML; copy so cached posts stay as stored
+	items := make([]Post, len(posts))
+	for i, p := range posts {
+		p.Content = a.postContentHTML(p)
+		items[i] = p
+	}
+
+	return feedSource{
+		settings:     settings,
+		posts:        items,
+		lastModified: lastModified,
+		title:        strings.TrimSpace(settings.SiteTitle),
+		homePath:     "/",
+		rssPath:      "/rss.xml",
+	}, nil
+}
+
+// feedDescription returns the channel-level description for feeds
+func feedDescription(settings siteSettings) string {
+	if intro := strings.TrimSpace(settings.IntroText); intro != "" {
+		return intro
+	}
+	return fmt.Sprintf("Latest posts from %s", strings.TrimSpace(settings.SiteTitle))
+}
+
+// feedAuthorName returns the author name advertised in feeds
+func feedAuthorName(settings siteSettings) string {
+	if name := strings.TrimSpace(settings.AuthorName); name != "" {
+		return name
+	}
+	return strings.TrimSpace(settings.SiteTitle)
+}
+
+// feedLinkTags advertises every available feed format for SSR pages
+func feedLinkTags(siteBase, title string) []linkTag {
+	title = strings.TrimSpace(title)
+	return []linkTag{
+		{Rel: "alternate", Href: siteBase + "/rss.xml", Type: "application/rss+xml", Title: title},
+		{Rel: "alternate", Href: siteBase + "/atom.xml", Type: "application/atom+xml", Title: title},
+		{Rel: "alternate", Href: siteBase + "/feed.json", Type: "application/feed+json", Title: title},
+	}
+}
+
+func postURL(siteBase string, p Post) string {
+	return strings.TrimRight(siteBase, "/") + postPath(p)
+}
+
+var relativeURLAttrRegex = regexp.MustCompile(`(?i)(\s(?:src|href)=["'])(/(?:[^/"'][^"']*)?)(["'])`)
+
+// absolutizeHTMLURLs rewrites root-relative src/href attributes so that
+// content stays valid when read outside the site (feed readers, aggregators)
+func absolutizeHTMLURLs(siteBase, html string) string {
+	return relativeURLAttrRegex.ReplaceAllStringFunc(html, func(match string) string {
+		parts := relativeURLAttrRegex.FindStringSubmatch(match)
+		if len(parts) < 4 {
+			return match
+		}
+		return parts[1] + makeAbsoluteAssetURL(siteBase, parts[2]) + parts[3]
+	})
+}
+
+func (a *App) buildRSSFeed(src feedSource, siteBase string) ([]byte, error) {
+	channel := rssChannel{
+		Title:       src.title,
+		Link:        siteBase + src.homePath,
+		Description: feedDescription(src.settings),
+		AtomLink: rssAtomLink{
+			Href: siteBase + src.rssPath,
+			Rel:  "self",
+			Type: "application/rss+xml",
+		},
+		Generator: "Noet",
+	}
+	if !src.lastModified.IsZero() {
+		channel.LastBuildDate = src.lastModified.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, p := range src.posts {
+		link := postURL(siteBase, p)
+		content := absolutizeHTMLURLs(siteBase, p.Content)
+		channel.Items = append(channel.Items, rssItem{
+			Title:       defaultPostTitle(p.Title, p.ID),
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: "true", Value: link},
+			PubDate:     postPublishedTime(p).UTC().Format(time.RFC1123Z),
+			Description: truncateWithEllipsis(stripHTML(p.Content), 300),
+			Content:     xmlCDATA{Value: content},
+		})
+	}
+
+	feed := rssFeed{
+		Version:   "2.0",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		Channel:   channel,
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// postFeedImage resolves the first image of a post to an absolute URL and,
+// for uploaded files, the stored MIME type and size
+func (a *App) postFeedImage(siteBase, content string) (feedImage, bool) {
+	src := firstImageSrc(content)
+	if src == "" {
+		return feedImage{}, false
+	}
+
+	img := feedImage{url: makeAbsoluteAssetURL(siteBase, src)}
+	if parsed, err := url.Parse(src); err == nil {
+		if filename, ok := strings.CutPrefix(parsed.Path, "/api/uploads/"); ok && filename != "" {
+			if attachment, err := a.getAttachment(filename); err == nil {
+				img.mimeType = attachment.MimeType
+				img.size = attachment.Size
+			}
+		}
+		if img.mimeType == "" {
+			img.mimeType = mime.TypeByExtension(path.Ext(parsed.Path))
+		}
+	}
+	if img.mimeType == "" {
+		img.mimeType = "application/octet-stream"
+	}
+	return img, true
+}
+
+func (a *App) buildAtomFeed(src feedSource, siteBase string) ([]byte, error) {
+	// An empty feed needs a stable date, or its ETag would change every
+	// second and conditional requests would never match
+	updated := src.lastModified
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+
+	feed := atomFeed{
+		XMLNS:    "http://www.w3.org/2005/Atom",
+		Title:    src.title,
+		Subtitle: feedDescription(src.settings),
+		ID:       siteBase + "/",
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: siteBase + "/atom.xml", Rel: "self", Type: "application/atom+xml"},
+			{Href: siteBase + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Author:    &atomPerson{Name: feedAuthorName(src.settings), URI: siteBase + "/"},
+		Generator: "Noet",
+	}
+
+	for _, p := range src.posts {
+		link := postURL(siteBase, p)
+		modified := p.UpdatedAt
+		if modified.IsZero() {
+			modified = p.CreatedAt
+		}
+		entry := atomEntry{
+			Title:     defaultPostTitle(p.Title, p.ID),
+			ID:        link,
+			Published: postPublishedTime(p).UTC().Format(time.RFC3339),
+			Updated:   modified.UTC().Format(time.RFC3339),
+			Links:     []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+			Summary:   atomText{Type: "text", Value: truncateWithEllipsis(stripHTML(p.Content), 300)},
+			Content:   atomText{Type: "html", Value: absolutizeHTMLURLs(siteBase, p.Content)},
+		}
+		if img, ok := a.postFeedImage(siteBase, p.Content); ok {
+			entry.Links = append(entry.Links, atomLink{Href: img.url, Rel: "enclosure", Type: img.mimeType})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func (a *App) buildJSONFeed(src feedSource, siteBase string) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       src.title,
+		HomePageURL: siteBase + src.homePath,
+		FeedURL:     siteBase + "/feed.json",
+		Description: feedDescription(src.settings),
+		Authors:     []jsonFeedAuthor{{Name: feedAuthorName(src.settings), URL: siteBase + "/"}},
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, p := range src.posts {
+		link := postURL(siteBase, p)
+		item := jsonFeedItem{
+			ID:            link,
+			URL:           link,
+			Title:         defaultPostTitle(p.Title, p.ID),
+			ContentHTML:   absolutizeHTMLURLs(siteBase, p.Content),
+			Summary:       truncateWithEllipsis(stripHTML(p.Content), 300),
+			DatePublished: postPublishedTime(p).UTC().Format(time.RFC3339),
+		}
+		if !p.UpdatedAt.IsZero() {
+			item.DateModified = p.UpdatedAt.UTC().Format(time.RFC3339)
+		}
+		if img, ok := a.postFeedImage(siteBase, p.Content); ok {
+			item.Image = img.url
+			item.Attachments = []jsonFeedAttachment{{
+				URL:         img.url,
+				MimeType:    img.mimeType,
+				SizeInBytes: img.size,
+			}}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+func (a *App) handleRSSFeed(w http.ResponseWriter, r *http.Request) {
+	a.serveFeed(w, r, "application/rss+xml; charset=utf-8", a.loadFeedSource, a.buildRSSFeed)
+}
+
+func (a *App) handleAtomFeed(w http.ResponseWriter, r *http.Request) {
+	a.serveFeed(w, r, "application/atom+xml; charset=utf-8", a.loadFeedSource, a.buildAtomFeed)
+}
+
+func (a *App) handleJSONFeed(w http.ResponseWriter, r *http.Request) {
+	a.serveFeed(w, r, "application/feed+json; charset=utf-8", a.loadFeedSource, a.buildJSONFeed)
+}
+
+// serveFeed loads a feed source, renders it with the given builder and writes
+// it with conditional request support
+func (a *App) serveFeed(w http.ResponseWriter, r *http.Request, contentType string,
+	load func() (feedSource, error), build func(feedSource, string) ([]byte, error)) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	src, err := load()
+	if err != nil {
+		a.Logger.Error("Failed to load feed source", "path", r.URL.Path, "error", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := build(src, a.requestSiteBase(r))
+	if err != nil {
+		a.Logger.Error("Failed to render feed", "path", r.URL.Path, "error", err)
+		http.Error(w, "failed to render feed", http.StatusInternalServerError)
+		return
+	}
+
+	writeFeedResponse(w, r, contentType, body, src.lastModified)
+}
+
+// writeFeedResponse writes a feed body with validators so that feed readers
+// can issue conditional requests instead of re-downloading unchanged feeds
+func writeFeedResponse(w http.ResponseWriter, r *http.Request, contentType string, body []byte, lastModified time.Time) {
+	etag := generateETag(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if feedNotModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// feedNotModified only trusts If-None-Match. Last-Modified is the newest
+// post update, which doesn't move when a post is unpublished or deleted or
+// the site title changes, so If-Modified-Since alone could keep a stale feed.
+func feedNotModified(r *http.Request, etag string) bool {
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(inm, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func insertTestPost(t *testing.T, app *App, title, content string, private bool) int64 {
+	t.Helper()
+	now := time.Now()
+	res, err := app.DB.Exec(`INSERT INTO posts(title, content, created_at, updated_at, is_private) VALUES(?, ?, ?, ?, ?)`,
+		title, content, now, now, private)
+	if err != nil {
+		t.Fatalf("insert post: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	if err := app.indexPost(id); err != nil {
+		t.Fatalf("index post: %v", err)
+	}
+	return id
+}
+
+func TestRSSFeed(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	insertTestPost(t, app, "Public Post", `<h1>Public Post</h1><p>Hello <img src="/api/uploads/a.png"></p>`, false)
+	insertTestPost(t, app, "Secret Post", `<h1>Secret Post</h1>`, true)
+
+	resp, err := http.Get(srv.URL + "/rss.xml")
+	if err != nil {
+		t.Fatalf("get feed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("feed status: %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	feed := string(body)
+	if !strings.Contains(feed, "<title>Public Post</title>") {
+		t.Fatalf("public post missing from feed: %s", feed)
+	}
+	if strings.Contains(feed, "Secret Post") {
+		t.Fatalf("private post leaked into feed")
+	}
+	if !strings.Contains(feed, `src="`+srv.URL+`/api/uploads/a.png"`) {
+		t.Fatalf("expected absolute image URL in feed content: %s", feed)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Last-Modified") == "" {
+		t.Fatalf("expected ETag and Last-Modified headers")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/rss.xml", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("conditional get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", resp.StatusCode)
+	}
+
+	// Unpublishing a post doesn't move Last-Modified, so a reader that only
+	// sends If-Modified-Since gets the whole feed
+	lastModified := resp.Header.Get("Last-Modified")
+	app.DB.Exec(`UPDATE posts SET is_private = 1`)
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/rss.xml", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("conditional get: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(body), "Public Post") {
+		t.Fatalf("expected the updated feed, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestAtomAndJSONFeeds(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	insertTestPost(t, app, "Pictures", `<h1>Pictures</h1><img src="/images/cat.png">`, false)
+
+	resp, err := http.Get(srv.URL + "/atom.xml")
+	if err != nil {
+		t.Fatalf("get atom: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("atom status: %d", resp.StatusCode)
+	}
+	atom := string(body)
+	if !strings.Contains(atom, `<title>Pictures</title>`) || !strings.Contains(atom, `rel="enclosure"`) {
+		t.Fatalf("unexpected atom feed: %s", atom)
+	}
+
+	resp, err = http.Get(srv.URL + "/feed.json")
+	if err != nil {
+		t.Fatalf("get json feed: %v", err)
+	}
+	defer resp.Body.Close()
+	var feed jsonFeed
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		t.Fatalf("decode json feed: %v", err)
+	}
+	if feed.Version != "https://jsonfeed.org/version/1.1" || len(feed.Items) != 1 {
+		t.Fatalf("unexpected json feed: %+v", feed)
+	}
+	item := feed.Items[0]
+	if len(item.Attachments) != 1 || item.Attachments[0].MimeType != "image/png" {
+		t.Fatalf("expected png attachment, got %+v", item.Attachments)
+	}
+	if item.Image != srv.URL+"/images/cat.png" {
+		t.Fatalf("unexpected image url %q", item.Image)
+	}
+}
+
+func TestEmptyAtomFeedIsStable(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/atom.xml")
+	if err != nil {
+		t.Fatalf("get atom: %v", err)
+	}
+	_ = resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("atom status %d, ETag %q", resp.StatusCode, etag)
+	}
+
+	// Across a second boundary, the empty feed must still match
+	time.Sleep(1100 * time.Millisecond)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/atom.xml", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("conditional get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 for an unchanged empty feed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// imageVariantWidths are the widths resized copies of uploads are made at;
+// images no wider than a width don't get that variant
+var imageVariantWidths = []int{480, 960, 1920}
+
+const (
+	// imageMaxPixels bounds decoded image size so a small file can't expand
+	// into gigabytes of pixels
+	imageMaxPixels = 50_000_000
+
+	imageJPEGQuality = 85
+
+	// imageSizes matches the width of the post column
+	imageSizes = "(max-width: 800px) 100vw, 800px"
+)
+
+var errInvalidImage = errors.New("file is not a supported image")
+
+// ImageVariant is a resized copy of an uploaded image
+type ImageVariant struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Size     int64  `json:"size"`
+}
+
+// encodedImage is image data ready to store
+type encodedImage struct {
+	data     []byte
+	mimeType string
+	ext      string
+	width    int
+	height   int
+}
+
+// processedImage is an upload with its metadata stripped, rotated upright,
+// along with its resized variants
+type processedImage struct {
+	encodedImage
+	variants []encodedImage
+}
+
+// processImage decodes an upload and re-encodes it without EXIF, GPS or
+// other metadata, applying the EXIF orientation. GIFs and animated WebPs
+// are kept as they are, apart from WebP metadata chunks, and get no
+// variants.
+func processImage(data []byte) (*processedImage, error) {
+	mimeType, err := sniffImage(data)
+	if err != nil {
+		return nil, err
+	}
+	// The decoder has to agree with the sniffed type
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != mimeType {
+		return nil, errInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > imageMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels is too large", errInvalidImage, cfg.Width, cfg.Height)
+	}
+	original := func(data []byte) *processedImage {
+		return &processedImage{encodedImage: encodedImage{
+			data: data, mimeType: mimeType, ext: imageExtensions[mimeType], width: cfg.Width, height: cfg.Height,
+		}}
+	}
+
+	var img image.Image
+	orientation := 1
+	switch format {
+	case "jpeg":
+		orientation = exifOrientation(jpegExif(data))
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "gif":
+		// Re-encoding would drop animation, and GIFs carry no EXIF
+		return original(data), nil
+	case "webp":
+		stripped, exif, animated, err := stripWebPMetadata(data)
+		if err != nil {
+			return nil, errInvalidImage
+		}
+		if animated {
+			return original(stripped), nil
+		}
+		if img, err = webp.Decode(bytes.NewReader(data)); err != nil {
+			return nil, errInvalidImage
+		}
+		// There is no WebP encoder, so upright images keep their original
+		// bytes and only rotated ones are converted
+		if orientation = exifOrientation(exif); orientation == 1 {
+			out := original(stripped)
+			out.variants, err = imageVariants(img, format)
+			return out, err
+		}
+	default:
+		return nil, errInvalidImage
+	}
+	if err != nil {
+		return nil, errInvalidImage
+	}
+
+	img = orientImage(img, orientation)
+	encoded, err := encodeImage(img, format)
+	if err != nil {
+		return nil, err
+	}
+	out := &processedImage{encodedImage: encoded}
+	out.variants, err = imageVariants(img, format)
+	return out, err
+}
+
+// encodeImage writes img as PNG when the source was a PNG or has
+// transparency, and as JPEG otherwise
+func encodeImage(img image.Image, sourceFormat string) (encodedImage, error) {
+	b := img.Bounds()
+	out := encodedImage{width: b.Dx(), height: b.Dy()}
+	var buf bytes.Buffer
+	opaque, ok := img.(interface{ Opaque() bool })
+	if sourceFormat == "png" || (sourceFormat != "jpeg" && (!ok || !opaque.Opaque())) {
+		if err := png.Encode(&buf, img); err != nil {
+			return out, fmt.Errorf("failed to encode image: %v", err)
+		}
+		out.mimeType = "image/png"
+	} else {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: imageJPEGQuality}); err != nil {
+			return out, fmt.Errorf("failed to encode image: %v", err)
+		}
+		out.mimeType = "image/jpeg"
+	}
+	out.data, out.ext = buf.Bytes(), imageExtensions[out.mimeType]
+	return out, nil
+}
+
+// imageVariants resizes img to each variant width narrower than it,
+// largest first so each step scales down from the previous one
+func imageVariants(img image.Image, sourceFormat string) ([]encodedImage, error) {
+	variants := []encodedImage{}
+	src := img
+	for i := len(imageVariantWidths) - 1; i >= 0; i-- {
+		w := imageVariantWidths[i]
+		b := img.Bounds()
+		if w >= b.Dx() {
+			continue
+		}
+		h := max(1, (b.Dy()*w+b.Dx()/2)/b.Dx())
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+		v, err := encodeImage(dst, sourceFormat)
+		if err != nil {
+			return nil, err
+		}
+		variants = append([]encodedImage{v}, variants...)
+		src = dst
+	}
+	return variants, nil
+}
+
+// orientImage returns img turned upright for an EXIF orientation value
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Source pixel shown at (x, y)
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// jpegExif returns the TIFF payload of a JPEG's EXIF segment, if any
+func jpegExif(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 || marker == 0xFF {
+			i++
+			continue
+		}
+		// Metadata segments all come before the image data
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i += 2 + size
+	}
+	return nil
+}
+
+// exifOrientation reads the orientation tag from IFD0 of a TIFF-structured
+// EXIF payload, defaulting to 1 (upright)
+func exifOrientation(tiff []byte) int {
+	tiff = bytes.TrimPrefix(tiff, []byte("Exif\x00\x00"))
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// Orientation is a SHORT stored inline in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// stripWebPMetadata removes EXIF and XMP chunks from a WebP file. It
+// returns the EXIF payload so its orientation can still be applied, and
+// whether the image is animated.
+func stripWebPMetadata(data []byte) (stripped, exif []byte, animated bool, err error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, nil, false, errInvalidImage
+	}
+	out := append([]byte{}, data[:12]...)
+	vp8x := -1
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, nil, false, errInvalidImage
+		}
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, nil, false, errInvalidImage
+		}
+		switch fourCC {
+		case "EXIF":
+			exif = data[i+8 : i+8+size]
+		case "XMP ":
+		default:
+			if fourCC == "VP8X" && size >= 10 {
+				vp8x = len(out)
+				animated = data[i+8]&0x02 != 0
+			}
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	if vp8x >= 0 {
+		out[vp8x+8] &^= 0x08 | 0x04 // EXIF and XMP flags
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, exif, animated, nil
+}
+
+// variantFilename names a resized copy after its original
+func variantFilename(filename string, width int, ext string) string {
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	return stem + "-" + strconv.Itoa(width) + ext
+}
+
+var (
+	imgTagRegex  = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	imgAttrRegex = regexp.MustCompile(`(?i)\s(src|srcset|width|height|sizes)\s*=\s*("[^"]*"|'[^']*')`)
+)
+
+// responsiveImages rewrites <img> tags that show uploads so browsers pick
+// a fitting variant and reserve space before the image loads
+func (a *App) responsiveImages(content string) string {
+	return imgTagRegex.ReplaceAllStringFunc(content, func(tag string) string {
+		attrs := map[string]string{}
+		for _, m := range imgAttrRegex.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2][1 : len(m[2])-1]
+		}
+		filename, ok := strings.CutPrefix(attrs["src"], "/api/uploads/")
+		if !ok || attrs["srcset"] != "" {
+			return tag
+		}
+		attachment, err := a.getAttachment(filename)
+		if err != nil || attachment.Width == 0 {
+			return tag
+		}
+
+		extra := ""
+		if len(attachment.Variants) > 0 {
+			candidates := []string{}
+			for _, v := range attachment.Variants {
+				candidates = append(candidates, "/api/uploads/"+v.Filename+" "+strconv.Itoa(v.Width)+"w")
+			}
+			candidates = append(candidates, "/api/uploads/"+attachment.Filename+" "+strconv.Itoa(attachment.Width)+"w")
+			extra += ` srcset="` + strings.Join(candidates, ", ") + `"`
+			if attrs["sizes"] == "" {
+				extra += ` sizes="` + imageSizes + `"`
+			}
+		}
+		// Images resized in the editor keep their size
+		if attrs["width"] == "" && attrs["height"] == "" {
+			extra += ` width="` + strconv.Itoa(attachment.Width) + `" height="` + strconv.Itoa(attachment.Height) + `"`
+		}
+		end := len(tag) - 1
+		if strings.HasSuffix(tag, "/>") {
+			end--
+		}
+		return strings.TrimRight(tag[:end], " ") + extra + tag[end:]
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// exifJPEG encodes img as a JPEG with an EXIF segment holding an
+// orientation and a GPS pointer
+func exifJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 2)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112) // orientation, SHORT
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x8825) // GPS IFD, LONG
+	tiff = binary.BigEndian.AppendUint16(tiff, 4)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint32(tiff, 0)
+	tiff = binary.BigEndian.AppendUint32(tiff, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// halves returns an image whose left half is red and right half blue
+func halves(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestProcessImageOrientsAndStripsMetadata(t *testing.T) {
+	data := exifJPEG(t, halves(40, 20), 6)
+	if exifOrientation(jpegExif(data)) != 6 {
+		t.Fatalf("test image has no orientation")
+	}
+
+	img, err := processImage(data)
+	if err != nil {
+		t.Fatalf("processImage: %v", err)
+	}
+	if img.width != 20 || img.height != 40 || img.mimeType != "image/jpeg" {
+		t.Fatalf("expected an upright 20x40 JPEG, got %dx%d %s", img.width, img.height, img.mimeType)
+	}
+	if bytes.Contains(img.data, []byte("Exif")) {
+		t.Fatalf("EXIF segment kept")
+	}
+	// Rotated clockwise, the red left half ends up on top
+	decoded, err := jpeg.Decode(bytes.NewReader(img.data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if r, _, b, _ := decoded.At(10, 5).RGBA(); r < b {
+		t.Fatalf("top of the image is not red")
+	}
+	if r, _, b, _ := decoded.At(10, 35).RGBA(); b < r {
+		t.Fatalf("bottom of the image is not blue")
+	}
+
+	if _, err := processImage([]byte("<svg xmlns='http://www.w3.org/2000/svg'/>")); !errors.Is(err, errInvalidImage) {
+		t.Fatalf("non-image accepted: %v", err)
+	}
+}
+
+func TestUploadVariantsAndResponsivePostImages(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	status, body := uploadTestFile(t, srv.URL, token, "wide.png", "image/png", testPNG(t, 1000, 500))
+	var uploaded struct {
+		URL      string         `json:"url"`
+		Width    int            `json:"width"`
+		Height   int            `json:"height"`
+		Variants []ImageVariant `json:"variants"`
+	}
+	_ = json.Unmarshal(body, &uploaded)
+	if status != http.StatusCreated || uploaded.Width != 1000 || uploaded.Height != 500 {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	if len(uploaded.Variants) != 2 || uploaded.Variants[0].Width != 480 || uploaded.Variants[0].Height != 240 ||
+		uploaded.Variants[1].Width != 960 {
+		t.Fatalf("unexpected variants: %+v", uploaded.Variants)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/uploads/" + uploaded.Variants[0].Filename)
+	if err != nil {
+		t.Fatalf("GET variant: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("variant: %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	id := insertTestPost(t, app, "Photos", `<h1>Photos</h1><p><img src="`+uploaded.URL+`" alt="wide"></p><p><img src="`+uploaded.URL+`" width="300"></p>`, false)
+	page := getBodyOK(t, srv.URL+"/posts/"+itoa(id))
+	srcset := `srcset="/api/uploads/` + uploaded.Variants[0].Filename + ` 480w, /api/uploads/` + uploaded.Variants[1].Filename + ` 960w, ` + uploaded.URL + ` 1000w"`
+	if !strings.Contains(page, `alt="wide" `+srcset+` sizes="`+imageSizes+`" width="1000" height="500">`) {
+		t.Fatalf("post image not made responsive:\n%s", page)
+	}
+	if !strings.Contains(page, `width="300" `+srcset+` sizes="`+imageSizes+`">`) {
+		t.Fatalf("editor-sized image changed:\n%s", page)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
@@ -28,7 +29,23 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to initialize app: %v", err)
 	}
+
+	// Administrative subcommands run against the database and exit
+	if len(os.Args) > 1 {
+		err := app.runCommand(os.Args[1:], os.Stdout)
+		if closeErr := app.Close(); closeErr != nil {
+			slog.Error("Error closing app", "error", closeErr)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	
+	// Background work such as scheduled publishing runs only when serving
+	app.StartScheduler()
+
 	// Setup graceful shutdown
 	defer func() {
 		if closeErr := app.Close(); closeErr != nil {
@@ -41,6 +58,7 @@ func main() {
 		Addr:    addr,
 		Handler: app.Handler(),
 	}
+	server.RegisterOnShutdown(app.ShutdownStreams)
 
 	// Start server in a goroutine
 	go func() {
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultPasswordMinLength  = 10
+	defaultPasswordMinClasses = 2
+	// bcrypt ignores everything after 72 bytes
+	passwordMaxBytes = 72
+
+	passwordResetTTL = time.Hour
+)
+
+var (
+	errWeakPassword         = errors.New("password does not meet the strength policy")
+	errWrongPassword        = errors.New("current password is incorrect")
+	errPasswordResetInvalid = errors.New("reset link is invalid or has expired")
+)
+
+// commonPasswords are rejected regardless of length and character classes
+var commonPasswords = map[string]bool{
+	"1234567890": true, "12345678910": true, "123456789012": true, "0987654321": true,
+	"qwertyuiop": true, "1q2w3e4r5t": true, "password123": true, "password1!": true,
+	"password1234": true, "iloveyou123": true, "letmein123": true, "welcome123": true,
+	"admin12345": true, "administrator": true, "changeme123": true, "qwerty12345": true,
+}
+
+// passwordPolicy is the minimum strength required for new passwords
+type passwordPolicy struct {
+	minLength  int
+	minClasses int
+}
+
+// loadPasswordPolicy reads NOET_PASSWORD_MIN_LENGTH and
+// NOET_PASSWORD_MIN_CLASSES
+func (a *App) loadPasswordPolicy() error {
+	policy := passwordPolicy{minLength: defaultPasswordMinLength, minClasses: defaultPasswordMinClasses}
+	if raw := strings.TrimSpace(os.Getenv("NOET_PASSWORD_MIN_LENGTH")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > passwordMaxBytes {
+			return fmt.Errorf("invalid NOET_PASSWORD_MIN_LENGTH: must be between 1 and %d", passwordMaxBytes)
+		}
+		policy.minLength = n
+	}
+	if raw := strings.TrimSpace(os.Getenv("NOET_PASSWORD_MIN_CLASSES")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 4 {
+			return fmt.Errorf("invalid NOET_PASSWORD_MIN_CLASSES: must be between 1 and 4")
+		}
+		policy.minClasses = n
+	}
+	a.passwordPolicy = policy
+	return nil
+}
+
+// check returns a descriptive errWeakPassword when password is too weak.
+// Character classes are lowercase, uppercase, digits and everything else.
+func (p passwordPolicy) check(username, password string) error {
+	if len([]rune(password)) < p.minLength {
+		return fmt.Errorf("%w: use at least %d characters", errWeakPassword, p.minLength)
+	}
+	if len(password) > passwordMaxBytes {
+		return fmt.Errorf("%w: use at most %d bytes", errWeakPassword, passwordMaxBytes)
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.minClasses {
+		return fmt.Errorf("%w: mix at least %d of lowercase, uppercase, digits and symbols", errWeakPassword, p.minClasses)
+	}
+
+	lowered := strings.ToLower(password)
+	if commonPasswords[lowered] {
+		return fmt.Errorf("%w: this password is too common", errWeakPassword)
+	}
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		return fmt.Errorf("%w: it must not contain the username", errWeakPassword)
+	}
+	return nil
+}
+
+// setPassword replaces a user's password and signs them out everywhere by
+// revoking all refresh tokens
+func setPassword(q sqlExecQueryer, userID int64, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, string(hash), userID); err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+	if _, err := q.Exec(`DELETE FROM refresh_tokens WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %v", err)
+	}
+	return nil
+}
+
+// changePassword verifies the current password before setting a new one
+func (a *App) changePassword(userID int64, current, next string) error {
+	var username, hash string
+	if err := a.DB.QueryRow(`SELECT username, password_hash FROM users WHERE id = ?`, userID).Scan(&username, &hash); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(current)) != nil {
+		return errWrongPassword
+	}
+	if err := a.passwordPolicy.check(username, next); err != nil {
+		return err
+	}
+	return setPassword(a.DB, userID, next)
+}
+
+// createPasswordReset stores a one-time reset token for username and
+// returns it; only the hash is kept, like invitations
+func (a *App) createPasswordReset(username string, ttl time.Duration) (*User, string, error) {
+	user := &User{}
+	err := a.DB.QueryRow(`SELECT id, username, role, created_at FROM users WHERE username = ? COLLATE NOCASE`, username).
+		Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	now := time.Now()
+	// Only the newest link works
+	if _, err := a.DB.Exec(`DELETE FROM password_resets WHERE user_id = ?`, user.ID); err != nil {
+		return nil, "", err
+	}
+	_, err = a.DB.Exec(`INSERT INTO password_resets (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		user.ID, hashInvitationToken(token), now.Add(ttl), now)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// resetPassword redeems a reset token. The token is consumed in the same
+// transaction as the password change, so it works exactly once.
+func (a *App) resetPassword(token, password string) (*User, error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	var user User
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+        SELECT u.id, u.username, u.role, u.created_at, r.expires_at
+        FROM password_resets r JOIN users u ON u.id = r.user_id
+        WHERE r.token_hash = ?`, hashInvitationToken(token)).
+		Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !expiresAt.After(time.Now())) {
+		return nil, errPasswordResetInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := a.passwordPolicy.check(user.Username, password); err != nil {
+		return nil, err
+	}
+
+	if err := setPassword(tx, user.ID, password); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to consume reset token: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return &user, nil
+}
+
+// writePasswordError maps password change failures to HTTP responses
+func (a *App) writePasswordError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errWeakPassword), errors.Is(err, errPasswordResetInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errWrongPassword):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		a.Logger.Error("Password change failed", "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+	}
+}
+
+// handleChangePassword changes the caller's password. Every session is
+// signed out; the caller gets a fresh token pair.
+func (a *App) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			CurrentPassword string `json:"currentPassword"`
+			NewPassword     string `json:"newPassword"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		userID := requestClaims(r).UserID
+		if err := a.changePassword(userID, payload.CurrentPassword, payload.NewPassword); err != nil {
+			a.writePasswordError(w, err)
+			return
+		}
+		user, err := a.getUser(userID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		a.Logger.Info("Password changed", "userID", userID)
+		a.writeAuthResponse(w, r, user)
+	})(w, r)
+}
+
+// handleResetPassword redeems a reset link from the reset-password command
+// and signs the user in
+func (a *App) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if payload.Token == "" {
+		http.Error(w, "reset token required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.resetPassword(payload.Token, payload.Password)
+	if err != nil {
+		a.writePasswordError(w, err)
+		return
+	}
+	a.Logger.Info("Password reset", "userID", user.ID, "username", user.Username)
+	// A reset link replaces the password, not the second factor
+	a.writeLoginResponse(w, r, user)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := passwordPolicy{minLength: 10, minClasses: 2}
+	cases := []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"ada", "short-1", false},
+		{"ada", "alllowercaseletters", false},
+		{"ada", "Password1234", false},
+		{"ada", "ada-lovelace-1815", false},
+		{"ada", "analytical-engine", true},
+		{"ada", "Difference9Engine", true},
+	}
+	for _, c := range cases {
+		err := policy.check(c.username, c.password)
+		if c.ok && err != nil {
+			t.Errorf("%q rejected: %v", c.password, err)
+		}
+		if !c.ok && !errors.Is(err, errWeakPassword) {
+			t.Errorf("%q accepted", c.password)
+		}
+	}
+}
+
+func TestChangePasswordRevokesSessions(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/setup/register", "", `{"username":"admin","password":"abc"}`); status != http.StatusBadRequest {
+		t.Fatalf("weak setup password accepted: %d", status)
+	}
+	status, body := doJSON(t, http.MethodPost, srv.URL+"/api/setup/register", "", `{"username":"admin","password":"secret-password"}`)
+	var auth struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	_ = json.Unmarshal(body, &auth)
+	if status != http.StatusOK || auth.RefreshToken == "" {
+		t.Fatalf("register: %d %s", status, body)
+	}
+
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/password", auth.Token,
+		`{"currentPassword":"wrong-password","newPassword":"fresh-password-2"}`); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for wrong current password, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/password", auth.Token,
+		`{"currentPassword":"secret-password","newPassword":"short"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for weak password, got %d", status)
+	}
+	status, body = doJSON(t, http.MethodPost, srv.URL+"/api/auth/password", auth.Token,
+		`{"currentPassword":"secret-password","newPassword":"fresh-password-2"}`)
+	if status != http.StatusOK {
+		t.Fatalf("change password: %d %s", status, body)
+	}
+
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/refresh", "",
+		`{"refreshToken":"`+auth.RefreshToken+`"}`); status != http.StatusUnauthorized {
+		t.Fatalf("old refresh token still valid: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login", "",
+		`{"username":"admin","password":"fresh-password-2"}`); status != http.StatusOK {
+		t.Fatalf("login with new password: %d", status)
+	}
+}
+
+func TestResetPasswordCommand(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	registerTestUser(t, srv.URL)
+
+	var out bytes.Buffer
+	if err := app.runCommand([]string{"reset-password", "nobody"}, &out); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+	app.baseURL = "https://blog.example.com"
+	if err := app.runCommand([]string{"reset-password", "ADMIN"}, &out); err != nil {
+		t.Fatalf("reset-password: %v", err)
+	}
+	m := regexp.MustCompile(`https://blog\.example\.com/reset-password\?token=(\S+)`).FindStringSubmatch(out.String())
+	if m == nil {
+		t.Fatalf("no reset link printed:\n%s", out.String())
+	}
+
+	reset := `{"token":"` + m[1] + `","password":"recovered-password"}`
+	if status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/reset", "", reset); status != http.StatusOK {
+		t.Fatalf("reset password: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/reset", "", reset); status != http.StatusBadRequest {
+		t.Fatalf("reset link worked twice: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login", "",
+		`{"username":"admin","password":"recovered-password"}`); status != http.StatusOK {
+		t.Fatalf("login after reset: %d", status)
+	}
+}
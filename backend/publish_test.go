@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublishEndpointsAreIdempotent(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	id := insertTestPost(t, app, "Draft", "<h1>Draft</h1>", true)
+	call := func(method, action string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+"/api/posts/"+itoa(id)+"/"+action, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, action, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: status %d", method, action, resp.StatusCode)
+		}
+		return resp
+	}
+
+	call(http.MethodPost, "publish")
+	first, _ := app.getPost(itoa(id))
+	if first.IsPrivate || first.PublishedAt == nil {
+		t.Fatalf("post not published: %+v", first)
+	}
+
+	// Repeating a publish must not flip the post back
+	call(http.MethodPost, "publish")
+	p, _ := app.getPost(itoa(id))
+	if p.IsPrivate {
+		t.Fatal("second publish unpublished the post")
+	}
+
+	call(http.MethodPost, "unpublish")
+	call(http.MethodPost, "unpublish")
+	if p, _ = app.getPost(itoa(id)); !p.IsPrivate {
+		t.Fatal("post still public after unpublish")
+	}
+
+	// Republishing keeps the original publication time
+	call(http.MethodPost, "publish")
+	p, _ = app.getPost(itoa(id))
+	if p.PublishedAt == nil || !p.PublishedAt.Equal(*first.PublishedAt) {
+		t.Fatalf("published_at changed on republish: %v -> %v", first.PublishedAt, p.PublishedAt)
+	}
+
+	resp := call(http.MethodPut, "publish")
+	if resp.Header.Get("Deprecation") == "" {
+		t.Fatal("legacy toggle route missing Deprecation header")
+	}
+	if p, _ = app.getPost(itoa(id)); !p.IsPrivate {
+		t.Fatal("legacy toggle did not unpublish the post")
+	}
+}
+
+func TestPublishBeforeScheduleUsesNow(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	id := insertTestPost(t, app, "Early", "<h1>Early</h1>", true)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, time.Now().Add(24*time.Hour).UTC(), id)
+
+	before := time.Now()
+	if status, body := doJSON(t, http.MethodPost, srv.URL+"/api/posts/"+itoa(id)+"/publish", token, ""); status != http.StatusOK {
+		t.Fatalf("publish: %d %s", status, body)
+	}
+	p, _ := app.getPost(itoa(id))
+	if p.IsPrivate || p.PublishAt != nil || p.PublishedAt == nil {
+		t.Fatalf("post not published: %+v", p)
+	}
+	if p.PublishedAt.After(time.Now()) || p.PublishedAt.Before(before.Add(-time.Second)) {
+		t.Fatalf("published_at should be the time of publishing, got %v", p.PublishedAt)
+	}
+
+	// Schedules stored with an offset are compared as times, not text
+	early := insertTestPost(t, app, "Early west", "<h1>Early west</h1>", true)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, time.Now().Add(time.Hour).In(time.FixedZone("west", -10*3600)), early)
+	late := insertTestPost(t, app, "Late east", "<h1>Late east</h1>", true)
+	lateAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, lateAt.In(time.FixedZone("east", 9*3600)), late)
+	for _, id := range []int64{early, late} {
+		if status, body := doJSON(t, http.MethodPost, srv.URL+"/api/posts/"+itoa(id)+"/publish", token, ""); status != http.StatusOK {
+			t.Fatalf("publish: %d %s", status, body)
+		}
+	}
+	if p, _ := app.getPost(itoa(early)); p.PublishedAt == nil || p.PublishedAt.After(time.Now()) {
+		t.Fatalf("early publish got a future date: %v", p.PublishedAt)
+	}
+	if p, _ := app.getPost(itoa(late)); p.PublishedAt == nil || !p.PublishedAt.Equal(lateAt) {
+		t.Fatalf("late publish should keep its schedule %v, got %v", lateAt, p.PublishedAt)
+	}
+}
+
+func TestPublicOrderFollowsPublishedAt(t *testing.T) {
+	app := newTestApp(t)
+
+	older := insertTestPost(t, app, "Older", "<h1>Older</h1>", false)
+	newer := insertTestPost(t, app, "Newer", "<h1>Newer</h1>", false)
+	now := time.Now().UTC()
+	app.DB.Exec(`UPDATE posts SET published_at = ?, updated_at = ? WHERE id = ?`, now.Add(-48*time.Hour), now, older)
+	app.DB.Exec(`UPDATE posts SET published_at = ?, updated_at = ? WHERE id = ?`, now.Add(-time.Hour), now.Add(-time.Hour), newer)
+
+	posts, err := app.getPostsWithPrivacy(false)
+	if err != nil {
+		t.Fatalf("list posts: %v", err)
+	}
+	if len(posts) != 2 || posts[0].ID != newer {
+		t.Fatalf("expected most recently published post first, got %+v", posts)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authFailureRetention is how long failed attempts stay in the audit table
+const authFailureRetention = 90 * 24 * time.Hour
+
+// limitPolicy throttles one kind of key. The first free failures cost
+// nothing, each further one doubles the wait starting at baseDelay, and
+// lockoutAfter failures lock the key out. Failures are forgotten after a
+// quiet window.
+type limitPolicy struct {
+	free         int
+	baseDelay    time.Duration
+	lockoutAfter int
+	lockout      time.Duration
+	window       time.Duration
+}
+
+// Usernames are locked out quickly; addresses may be shared behind NAT
+var (
+	usernameLimitPolicy = limitPolicy{free: 3, baseDelay: time.Second, lockoutAfter: 10, lockout: 15 * time.Minute, window: time.Hour}
+	ipLimitPolicy       = limitPolicy{free: 10, baseDelay: time.Second, lockoutAfter: 50, lockout: 15 * time.Minute, window: time.Hour}
+)
+
+// limitKey identifies what is being throttled: a client address or a
+// username
+type limitKey struct {
+	scope string
+	value string
+}
+
+func ipLimitKey(ip string) limitKey { return limitKey{scope: "ip", value: ip} }
+
+func usernameLimitKey(username string) limitKey {
+	return limitKey{scope: "username", value: strings.ToLower(strings.TrimSpace(username))}
+}
+
+func (k limitKey) policy() limitPolicy {
+	if k.scope == "username" {
+		return usernameLimitPolicy
+	}
+	return ipLimitPolicy
+}
+
+type limitEntry struct {
+	failures    int
+	lastFailure time.Time
+}
+
+// retryAt is when the key may try again; zero when it is not throttled
+func (e *limitEntry) retryAt(p limitPolicy) time.Time {
+	if e.failures < p.free {
+		return time.Time{}
+	}
+	if e.failures >= p.lockoutAfter {
+		return e.lastFailure.Add(p.lockout)
+	}
+	shift := e.failures - p.free
+	if shift > 30 {
+		shift = 30
+	}
+	delay := p.baseDelay << shift
+	if delay > p.lockout {
+		delay = p.lockout
+	}
+	return e.lastFailure.Add(delay)
+}
+
+// authLimiter tracks recent authentication failures in memory
+type authLimiter struct {
+	mu        sync.Mutex
+	entries   map[limitKey]*limitEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Lockout is a key that is currently throttled, as shown to admins
+type Lockout struct {
+	Scope    string    `json:"scope"`
+	Key      string    `json:"key"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+func newAuthLimiter() *authLimiter {
+	return &authLimiter{entries: make(map[limitKey]*limitEntry), now: time.Now}
+}
+
+// entry returns the live entry for key, dropping it once its window has
+// passed; the caller holds l.mu
+func (l *authLimiter) entry(key limitKey, now time.Time) *limitEntry {
+	e, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	p := key.policy()
+	if now.Sub(e.lastFailure) > p.window && !e.retryAt(p).After(now) {
+		delete(l.entries, key)
+		return nil
+	}
+	return e
+}
+
+// retryAfter returns how long the caller must wait before trying again,
+// the longest of all keys
+func (l *authLimiter) retryAfter(keys ...limitKey) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		if e := l.entry(key, now); e != nil {
+			if d := e.retryAt(key.policy()).Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// fail records a failed attempt for every key and reports the keys that
+// just got locked out
+func (l *authLimiter) fail(keys ...limitKey) []limitKey {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > time.Minute {
+		for key := range l.entries {
+			l.entry(key, now)
+		}
+		l.lastSweep = now
+	}
+
+	var locked []limitKey
+	for _, key := range keys {
+		e := l.entry(key, now)
+		if e == nil {
+			e = &limitEntry{}
+			l.entries[key] = e
+		}
+		e.failures++
+		e.lastFailure = now
+		if e.failures == key.policy().lockoutAfter {
+			locked = append(locked, key)
+		}
+	}
+	return locked
+}
+
+// reset forgets the failures of keys after a successful attempt
+func (l *authLimiter) reset(keys ...limitKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		delete(l.entries, key)
+	}
+}
+
+// lockouts lists the keys that are throttled right now
+func (l *authLimiter) lockouts() []Lockout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	out := []Lockout{}
+	for key := range l.entries {
+		e := l.entry(key, now)
+		if e == nil {
+			continue
+		}
+		if until := e.retryAt(key.policy()); until.After(now) {
+			out = append(out, Lockout{Scope: key.scope, Key: key.value, Failures: e.failures, Until: until})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.After(out[j].Until) })
+	return out
+}
+
+// throttle rejects the request with 429 and Retry-After while any of the
+// keys is backing off
+func (a *App) throttle(w http.ResponseWriter, keys ...limitKey) bool {
+	wait := a.limiter.retryAfter(keys...)
+	if wait <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "too many failed attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// recordAuthFailure counts a failed attempt against the client's address
+// and any extra keys, and adds it to the audit table
+func (a *App) recordAuthFailure(r *http.Request, kind, username, reason string, extra ...limitKey) {
+	ip := a.clientIP(r)
+	for _, key := range a.limiter.fail(append([]limitKey{ipLimitKey(ip)}, extra...)...) {
+		a.Logger.Warn("Authentication locked out after repeated failures", "scope", key.scope, "key", key.value)
+	}
+
+	now := time.Now()
+	_, _ = a.DB.Exec(`DELETE FROM auth_failures WHERE created_at < ?`, now.Add(-authFailureRetention))
+	if _, err := a.DB.Exec(`INSERT INTO auth_failures (kind, username, ip, user_agent, reason, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		kind, username, ip, sessionUserAgent(r), reason, now); err != nil {
+		a.Logger.Error("Failed to record authentication failure", "error", err.Error())
+	}
+}
+
+// AuthFailure is one row of the failed authentication audit log
+type AuthFailure struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	Username  string    `json:"username,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// listAuthFailures returns failed attempts newest first, optionally before
+// an ID and filtered by username or address
+func (a *App) listAuthFailures(before int64, username, ip string, limit int) ([]AuthFailure, error) {
+	query := `SELECT id, kind, username, ip, user_agent, reason, created_at FROM auth_failures WHERE 1=1`
+	var args []interface{}
+	if before > 0 {
+		query += ` AND id < ?`
+		args = append(args, before)
+	}
+	if username != "" {
+		query += ` AND username = ? COLLATE NOCASE`
+		args = append(args, username)
+	}
+	if ip != "" {
+		query += ` AND ip = ?`
+		args = append(args, ip)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := a.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list authentication failures: %v", err)
+	}
+	defer rows.Close()
+
+	failures := []AuthFailure{}
+	for rows.Next() {
+		var f AuthFailure
+		if err := rows.Scan(&f.ID, &f.Kind, &f.Username, &f.IP, &f.UserAgent, &f.Reason, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+// handleAuthFailures shows admins recent failed attempts and current
+// lockouts
+func (a *App) handleAuthFailures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit := 50
+		if raw := q.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, 200)
+		}
+		var before int64
+		if raw := q.Get("before"); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid before", http.StatusBadRequest)
+				return
+			}
+			before = n
+		}
+
+		failures, err := a.listAuthFailures(before, q.Get("username"), q.Get("ip"), limit)
+		if err != nil {
+			a.Logger.Error("Failed to list authentication failures", "error", err.Error())
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"failures": failures,
+			"lockouts": a.limiter.lockouts(),
+		})
+	})(w, r)
+}
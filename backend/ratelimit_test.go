@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postForRetry posts a JSON body and returns the status and Retry-After
+func postForRetry(t *testing.T, url, body string) (int, string) {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("Retry-After")
+}
+
+func TestLoginBackoffAndLockout(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	admin := registerTestUser(t, srv.URL)
+	clock := time.Now()
+	app.limiter.now = func() time.Time { return clock }
+
+	login := func(username, password string) (int, string) {
+		t.Helper()
+		return postForRetry(t, srv.URL+"/api/auth/login", `{"username":"`+username+`","password":"`+password+`"}`)
+	}
+
+	for i := 0; i < usernameLimitPolicy.free; i++ {
+		if status, _ := login("admin", "wrong-password"); status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d", i+1, status)
+		}
+	}
+	// Even the right password waits out the backoff
+	if status, retry := login("ADMIN", "secret-password"); status != http.StatusTooManyRequests || retry != "1" {
+		t.Fatalf("expected backoff, got %d Retry-After %q", status, retry)
+	}
+	// Other accounts from the same address are unaffected
+	if status, _ := login("nobody", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("other username throttled: %d", status)
+	}
+	clock = clock.Add(2 * time.Second)
+	if status, _ := login("admin", "secret-password"); status != http.StatusOK {
+		t.Fatalf("login after backoff: %d", status)
+	}
+
+	for i := 0; i < usernameLimitPolicy.lockoutAfter; i++ {
+		clock = clock.Add(5 * time.Minute)
+		if status, _ := login("admin", "wrong-password"); status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d after waiting: %d", i+1, status)
+		}
+	}
+	clock = clock.Add(10 * time.Minute)
+	if status, retry := login("admin", "secret-password"); status != http.StatusTooManyRequests || retry != "300" {
+		t.Fatalf("expected lockout, got %d Retry-After %q", status, retry)
+	}
+
+	status, body := doJSON(t, http.MethodGet, srv.URL+"/api/auth/failures?limit=5", admin, "")
+	var audit struct {
+		Failures []AuthFailure `json:"failures"`
+		Lockouts []Lockout     `json:"lockouts"`
+	}
+	_ = json.Unmarshal(body, &audit)
+	if status != http.StatusOK || len(audit.Failures) != 5 || audit.Failures[0].Reason != "wrong password" {
+		t.Fatalf("list failures: %d %s", status, body)
+	}
+	if len(audit.Lockouts) != 1 || audit.Lockouts[0].Key != "admin" {
+		t.Fatalf("expected admin to be locked out: %s", body)
+	}
+	_, body = doJSON(t, http.MethodGet, srv.URL+"/api/auth/failures?username=nobody", admin, "")
+	if !strings.Contains(string(body), `"reason":"unknown user"`) {
+		t.Fatalf("filter by username: %s", body)
+	}
+	viewer := createTestAccount(t, app, "viewer", roleViewer)
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/failures", viewer, ""); status != http.StatusForbidden {
+		t.Fatalf("non-admin read the audit log: %d", status)
+	}
+
+	clock = clock.Add(6 * time.Minute)
+	if status, _ := login("admin", "secret-password"); status != http.StatusOK {
+		t.Fatalf("login after lockout expired: %d", status)
+	}
+}
+
+func TestRefreshAndSetupShareAddressLimit(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	for i := 0; i < ipLimitPolicy.free; i++ {
+		if status, _ := postForRetry(t, srv.URL+"/api/auth/refresh", `{"refreshToken":"guess-`+itoa(int64(i))+`"}`); status != http.StatusUnauthorized {
+			t.Fatalf("refresh %d: %d", i+1, status)
+		}
+	}
+	if status, retry := postForRetry(t, srv.URL+"/api/auth/refresh", `{"refreshToken":"guess"}`); status != http.StatusTooManyRequests || retry == "" {
+		t.Fatalf("expected refresh to be throttled, got %d Retry-After %q", status, retry)
+	}
+	if status, _ := postForRetry(t, srv.URL+"/api/setup/register", `{"username":"admin","password":"secret-password"}`); status != http.StatusTooManyRequests {
+		t.Fatalf("expected setup to be throttled, got %d", status)
+	}
+}
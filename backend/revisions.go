@@ -0,0 +1,448 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// revisionIdleWindow merges auto-save writes that arrive within this
+	// interval of the previous write into the same revision
+	revisionIdleWindow = 2 * time.Minute
+	// revisionMaxSpan caps how long a single revision keeps absorbing writes so
+	// a long editing session still leaves restore points behind
+	revisionMaxSpan = 10 * time.Minute
+	// revisionDiffMaxCells bounds the LCS table used for diffs
+	revisionDiffMaxCells = 4_000_000
+)
+
+type PostRevision struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"postId"`
+	Title     *string   `json:"title,omitempty"`
+	Content   string    `json:"content,omitempty"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type diffOp struct {
+	Kind string `json:"kind"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+// recordRevision stores the new content of a post as a revision. Rapid
+// successive writes are coalesced into the latest revision unless coalesce is
+// false. Posts edited before revisions existed get a baseline revision of
+// their previous content first so that nothing is lost.
+func (a *App) recordRevision(postID int64, previous Post, title *string, content string, now time.Time, coalesce bool) error {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	var (
+		latestID      int64
+		latestCreated time.Time
+		latestUpdated time.Time
+	)
+	err = tx.QueryRow(`SELECT id, created_at, updated_at FROM post_revisions WHERE post_id = ? ORDER BY id DESC LIMIT 1`, postID).
+		Scan(&latestID, &latestCreated, &latestUpdated)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		latestID = 0
+		if previous.Content != "" {
+			baselineAt := previous.UpdatedAt
+			if baselineAt.IsZero() {
+				baselineAt = now
+			}
+			if _, err := tx.Exec(`INSERT INTO post_revisions (post_id, title, content, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+				postID, previous.Title, previous.Content, baselineAt, baselineAt); err != nil {
+				return fmt.Errorf("failed to store baseline revision: %v", err)
+			}
+			// Never coalesce into the baseline
+			coalesce = false
+		}
+	case err != nil:
+		return fmt.Errorf("failed to query latest revision: %v", err)
+	}
+
+	if coalesce && latestID != 0 && now.Sub(latestUpdated) < revisionIdleWindow && now.Sub(latestCreated) < revisionMaxSpan {
+		if _, err := tx.Exec(`UPDATE post_revisions SET title = ?, content = ?, updated_at = ? WHERE id = ?`,
+			title, content, now, latestID); err != nil {
+			return fmt.Errorf("failed to update revision: %v", err)
+		}
+	} else {
+		if _, err := tx.Exec(`INSERT INTO post_revisions (post_id, title, content, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			postID, title, content, now, now); err != nil {
+			return fmt.Errorf("failed to insert revision: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (a *App) getPostRevisions(postID int64) ([]PostRevision, error) {
+	rows, err := a.DB.Query(`
+        SELECT id, post_id, title, length(content), created_at, updated_at
+        FROM post_revisions
+        WHERE post_id = ?
+        ORDER BY id DESC
+    `, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		var title sql.NullString
+		if err := rows.Scan(&rev.ID, &rev.PostID, &title, &rev.Size, &rev.CreatedAt, &rev.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if title.Valid {
+			t := title.String
+			rev.Title = &t
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (a *App) getPostRevision(postID, revisionID int64) (PostRevision, error) {
+	var rev PostRevision
+	var title sql.NullString
+	err := a.DB.QueryRow(`
+        SELECT id, post_id, title, content, created_at, updated_at
+        FROM post_revisions
+        WHERE post_id = ? AND id = ?
+    `, postID, revisionID).Scan(&rev.ID, &rev.PostID, &title, &rev.Content, &rev.CreatedAt, &rev.UpdatedAt)
+	if err != nil {
+		return PostRevision{}, err
+	}
+	if title.Valid {
+		t := title.String
+		rev.Title = &t
+	}
+	rev.Size = len(rev.Content)
+	return rev, nil
+}
+
+// restoreRevision makes a revision the current content of its post. Unless
+// rawHTML is set the content is sanitized, as if the restorer had written it.
+func (a *App) restoreRevision(postID, revisionID int64, rawHTML bool) (Post, error) {
+	rev, err := a.getPostRevision(postID, revisionID)
+	if err != nil {
+		return Post{}, err
+	}
+	content := rev.Content
+	if !rawHTML {
+		content = sanitizeHTML(content)
+	}
+
+	idStr := strconv.FormatInt(postID, 10)
+	existing, err := a.getPost(idStr)
+	if err != nil {
+		return Post{}, err
+	}
+
+	title := strings.TrimSpace(extractTitleFromHTML(content))
+	var titlePtr *string
+	if title != "" {
+		titlePtr = &title
+	}
+
+	now := time.Now()
+	if _, err := a.DB.Exec(`UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE id = ?`, titlePtr, content, now, postID); err != nil {
+		return Post{}, fmt.Errorf("failed to restore revision: %v", err)
+	}
+
+	if err := a.recordRevision(postID, existing, titlePtr, content, now, false); err != nil {
+		a.Logger.Error("Failed to record restore revision", "postID", postID, "error", err)
+	}
+	if err := a.updatePostLinks(postID, content); err != nil {
+		a.Logger.Debug("Failed to update post links", "postID", postID, "error", err.Error())
+	}
+	if err := a.indexPost(postID); err != nil {
+		a.Logger.Error("Failed to update search index", "postID", postID, "error", err)
+	}
+	if err := a.updateContentTags(postID, content); err != nil {
+		a.Logger.Error("Failed to update post tags", "postID", postID, "error", err)
+	}
+
+	a.cacheInvalidatePattern("posts_list_")
+	a.cacheDelete(fmt.Sprintf("post_%s", idStr))
+
+	p, err := a.getPost(idStr)
+	if err != nil {
+		return Post{}, err
+	}
+	a.events.publish(postEventUpdated, p)
+	return p, nil
+}
+
+var diffBlockBoundaryRegex = regexp.MustCompile(`(?i)(</(?:p|h[1-6]|li|blockquote|pre|div|tr|ul|ol|table)>|<br\s*/?>|<hr\s*/?>)`)
+
+// diffBlocks splits HTML into block-level lines of plain text for diffing
+func diffBlocks(html string) []string {
+	marked := diffBlockBoundaryRegex.ReplaceAllString(html, "$1\n")
+	var lines []string
+	for _, chunk := range strings.Split(marked, "\n") {
+		if text := stripHTML(chunk); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return lines
+}
+
+// diffLines computes a line diff using the longest common subsequence
+func diffLines(from, to []string) []diffOp {
+	n, m := len(from), len(to)
+	if n*m > revisionDiffMaxCells {
+		ops := make([]diffOp, 0, n+m)
+		for _, l := range from {
+			ops = append(ops, diffOp{Kind: "delete", Text: l})
+		}
+		for _, l := range to {
+			ops = append(ops, diffOp{Kind: "insert", Text: l})
+		}
+		return ops
+	}
+
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case from[i] == to[j]:
+			ops = append(ops, diffOp{Kind: "equal", Text: from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{Kind: "delete", Text: from[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{Kind: "insert", Text: to[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{Kind: "delete", Text: from[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{Kind: "insert", Text: to[j]})
+	}
+	return ops
+}
+
+func renderDiffText(ops []diffOp) string {
+	var b strings.Builder
+	for _, op := range ops {
+		switch op.Kind {
+		case "insert":
+			b.WriteString("+ ")
+		case "delete":
+			b.WriteString("- ")
+		default:
+			b.WriteString("  ")
+		}
+		b.WriteString(op.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func renderDiffHTML(ops []diffOp) string {
+	var b strings.Builder
+	b.WriteString(`<div class="revision-diff">`)
+	for _, op := range ops {
+		text := template.HTMLEscapeString(op.Text)
+		switch op.Kind {
+		case "insert":
+			b.WriteString(`<ins class="diff-insert">` + text + `</ins>`)
+		case "delete":
+			b.WriteString(`<del class="diff-delete">` + text + `</del>`)
+		default:
+			b.WriteString(`<p class="diff-equal">` + text + `</p>`)
+		}
+	}
+	b.WriteString(`</div>`)
+	return b.String()
+}
+
+// handlePostRevisions serves /api/posts/{id}/revisions and its sub-paths:
+//
+//	GET  /api/posts/{id}/revisions                  list revisions
+//	GET  /api/posts/{id}/revisions/diff?from=&to=   diff two revisions ("current" for the live post)
+//	GET  /api/posts/{id}/revisions/{rev}            fetch a revision
+//	POST /api/posts/{id}/revisions/{rev}/restore    restore a revision
+func (a *App) handlePostRevisions(w http.ResponseWriter, r *http.Request, path string) {
+	idStr, rest, _ := strings.Cut(path, "/revisions")
+	postID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid post ID", http.StatusBadRequest)
+		return
+	}
+	rest = strings.Trim(rest, "/")
+
+	p, err := a.getPost(idStr)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "db error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch {
+	case rest == "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		revisions, err := a.getPostRevisions(postID)
+		if err != nil {
+			a.Logger.Error("Failed to list revisions", "postID", postID, "error", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(revisions)
+
+	case rest == "diff":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fromContent, err := a.revisionContent(postID, r.URL.Query().Get("from"))
+		if err != nil {
+			a.writeRevisionError(w, r, err)
+			return
+		}
+		toRef := r.URL.Query().Get("to")
+		if toRef == "" {
+			toRef = "current"
+		}
+		toContent, err := a.revisionContent(postID, toRef)
+		if err != nil {
+			a.writeRevisionError(w, r, err)
+			return
+		}
+
+		ops := diffLines(diffBlocks(fromContent), diffBlocks(toContent))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"from": r.URL.Query().Get("from"),
+			"to":   toRef,
+			"ops":  ops,
+			"html": renderDiffHTML(ops),
+			"text": renderDiffText(ops),
+		})
+
+	case strings.HasSuffix(rest, "/restore"):
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !canEditPost(requestClaims(r), p) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		revID, err := strconv.ParseInt(strings.TrimSuffix(rest, "/restore"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid revision ID", http.StatusBadRequest)
+			return
+		}
+		p, err := a.restoreRevision(postID, revID, trustsRawHTML(requestClaims(r).Role))
+		if err != nil {
+			a.writeRevisionError(w, r, err)
+			return
+		}
+		a.Logger.Info("Post revision restored", "postID", postID, "revisionID", revID)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p)
+
+	default:
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		revID, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid revision ID", http.StatusBadRequest)
+			return
+		}
+		rev, err := a.getPostRevision(postID, revID)
+		if err != nil {
+			a.writeRevisionError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(rev)
+	}
+}
+
+var errInvalidRevisionRef = errors.New("invalid revision reference")
+
+// revisionContent resolves a revision ID or "current" to post content
+func (a *App) revisionContent(postID int64, ref string) (string, error) {
+	if ref == "current" {
+		p, err := a.getPost(strconv.FormatInt(postID, 10))
+		if err != nil {
+			return "", err
+		}
+		return p.Content, nil
+	}
+	revID, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return "", errInvalidRevisionRef
+	}
+	rev, err := a.getPostRevision(postID, revID)
+	if err != nil {
+		return "", err
+	}
+	return rev.Content, nil
+}
+
+func (a *App) writeRevisionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+	case errors.Is(err, errInvalidRevisionRef):
+		http.Error(w, "invalid revision ID", http.StatusBadRequest)
+	default:
+		a.Logger.Error("Revision request failed", "path", r.URL.Path, "error", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	from := diffBlocks("<h1>Title</h1><p>One</p><p>Two</p>")
+	to := diffBlocks("<h1>Title</h1><p>Two</p><p>Three</p>")
+	text := renderDiffText(diffLines(from, to))
+	want := "  Title\n- One\n  Two\n+ Three\n"
+	if text != want {
+		t.Fatalf("diff mismatch:\n%s\nwant:\n%s", text, want)
+	}
+}
+
+func TestRevisionHistoryAndRestore(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	id := insertTestPost(t, app, "Original", "<h1>Original</h1><p>Hours of work</p>", false)
+	postURL := srv.URL + "/api/posts/" + itoa(id)
+
+	do := func(method, url, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: status %d", method, url, resp.StatusCode)
+		}
+		return resp
+	}
+
+	// Two rapid auto-saves coalesce into one revision after the baseline
+	do(http.MethodPut, postURL, `{"content":"<h1>Original</h1><p>Bad paste</p>"}`).Body.Close()
+	do(http.MethodPut, postURL, `{"content":"<h1>Original</h1><p>Worse paste</p>"}`).Body.Close()
+
+	resp := do(http.MethodGet, postURL+"/revisions", "")
+	var revisions []PostRevision
+	if err := json.NewDecoder(resp.Body).Decode(&revisions); err != nil {
+		t.Fatalf("decode revisions: %v", err)
+	}
+	resp.Body.Close()
+	if len(revisions) != 2 {
+		t.Fatalf("expected baseline plus one coalesced revision, got %d", len(revisions))
+	}
+	baseline := revisions[len(revisions)-1]
+
+	resp = do(http.MethodGet, postURL+"/revisions/diff?from="+itoa(baseline.ID)+"&to=current", "")
+	var diff struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&diff); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(diff.Text, "- Hours of work") || !strings.Contains(diff.Text, "+ Worse paste") {
+		t.Fatalf("unexpected diff: %s", diff.Text)
+	}
+
+	resp = do(http.MethodPost, postURL+"/revisions/"+itoa(baseline.ID)+"/restore", "")
+	var restored Post
+	if err := json.NewDecoder(resp.Body).Decode(&restored); err != nil {
+		t.Fatalf("decode restored: %v", err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(restored.Content, "Hours of work") {
+		t.Fatalf("restore did not bring back original content: %s", restored.Content)
+	}
+}
+
+func TestDeletePostRemovesDependentRows(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	id := insertTestPost(t, app, "Doomed", "<h1>Doomed</h1>", false)
+	title := "Doomed"
+	if _, err := app.ensurePostSlug(Post{ID: id, Title: &title}); err != nil {
+		t.Fatalf("ensure slug: %v", err)
+	}
+	// One edit leaves a revision, a tag and a redirect from the old slug
+	if status, body := doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(id), token,
+		`{"content":"<h1>Doomed</h1><p>Edited</p>","tags":["go"],"slug":"renamed"}`); status != http.StatusOK {
+		t.Fatalf("update: %d %s", status, body)
+	}
+
+	tables := []string{"post_revisions", "post_slug_redirects", "post_tags"}
+	count := func(table string) int {
+		var n int
+		app.DB.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE post_id = ?`, id).Scan(&n)
+		return n
+	}
+	for _, table := range tables {
+		if count(table) == 0 {
+			t.Fatalf("no %s rows to clean up", table)
+		}
+	}
+
+	// Cascades are per connection, so open several and check each one
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 5; i++ {
+		conn, err := app.DB.Conn(ctx)
+		if err != nil {
+			t.Fatalf("open connection: %v", err)
+		}
+		var on int
+		if err := conn.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&on); err != nil || on != 1 {
+			t.Fatalf("connection %d has foreign_keys=%d: %v", i, on, err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/posts/"+itoa(id), token, ""); status != http.StatusOK && status != http.StatusNoContent {
+		t.Fatalf("delete: %d", status)
+	}
+	for _, table := range tables {
+		if n := count(table); n != 0 {
+			t.Fatalf("%d rows left in %s", n, table)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// emptyPayloadHash is the SHA-256 of an empty body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// s3PresignExpiry is how long redirect URLs stay valid. Signing times are
+	// truncated to the hour so browsers can cache them in between.
+	s3PresignExpiry = 2 * time.Hour
+)
+
+// s3Store keeps blobs in an S3-compatible bucket using path-style requests,
+// which AWS, MinIO, R2 and most other implementations accept
+type s3Store struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	publicURL string
+	proxy     bool
+	signer    sigV4
+	client    *http.Client
+	now       func() time.Time
+}
+
+// newS3StoreFromEnv configures an s3Store from NOET_S3_* variables, falling
+// back to the standard AWS credential variables
+func newS3StoreFromEnv() (*s3Store, error) {
+	env := func(names ...string) string {
+		for _, name := range names {
+			if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	region := env("NOET_S3_REGION", "AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := env("NOET_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	bucket := env("NOET_S3_BUCKET")
+	accessKey := env("NOET_S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID")
+	secretKey := env("NOET_S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY")
+	if bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("NOET_STORAGE=s3 requires NOET_S3_BUCKET, NOET_S3_ACCESS_KEY_ID and NOET_S3_SECRET_ACCESS_KEY")
+	}
+	proxy := false
+	if v := env("NOET_S3_PROXY"); v != "" {
+		var err error
+		if proxy, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid NOET_S3_PROXY: %v", err)
+		}
+	}
+	return newS3Store(endpoint, bucket, env("NOET_S3_PREFIX"), region, accessKey, secretKey, env("NOET_S3_PUBLIC_URL"), proxy)
+}
+
+func newS3Store(endpoint, bucket, prefix, region, accessKey, secretKey, publicURL string, proxy bool) (*s3Store, error) {
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Store{
+		endpoint:  u,
+		bucket:    bucket,
+		prefix:    prefix,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		proxy:     proxy,
+		signer:    sigV4{accessKey: accessKey, secretKey: secretKey, region: region, service: "s3"},
+		client:    &http.Client{Timeout: 2 * time.Minute},
+		now:       time.Now,
+	}, nil
+}
+
+// objectURL returns the path-style URL of a key
+func (s *s3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.bucket + "/" + s.prefix + key
+	u.RawPath = ""
+	return &u
+}
+
+// do signs and sends a request for key
+func (s *s3Store) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+		req.ContentLength = int64(len(body))
+	} else {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signer.sign(req, payloadHash, s.now())
+	return s.client.Do(req)
+}
+
+// s3Error turns an unexpected response into an error, keeping the start of
+// the XML error body for the logs
+func s3Error(op, key string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// Put uploads a blob. The body is buffered to sign its hash; uploads are
+// small enough for that.
+func (s *s3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) (int64, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload: %v", err)
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return 0, fmt.Errorf("s3 put %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, s3Error("put", key, resp)
+	}
+	return int64(len(data)), nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, blobInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, blobInfo{}, fmt.Errorf("s3 get %s: %v", key, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, blobInfo{}, errBlobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, blobInfo{}, s3Error("get", key, resp)
+	}
+	info := blobInfo{size: resp.ContentLength}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = t
+	}
+	return resp.Body, info, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return fmt.Errorf("s3 delete %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s3Error("delete", key, resp)
+}
+
+// RedirectURL points clients at NOET_S3_PUBLIC_URL when the bucket is
+// public, or at a presigned URL otherwise. With NOET_S3_PROXY set, blobs
+// are streamed through the server instead.
+func (s *s3Store) RedirectURL(key string) (string, error) {
+	if s.proxy {
+		return "", nil
+	}
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	if s.publicURL != "" {
+		return s.publicURL + "/" + uriEncode(s.prefix+key, false), nil
+	}
+	return s.signer.presign(http.MethodGet, s.objectURL(key), s.now().UTC().Truncate(time.Hour), s3PresignExpiry), nil
+}
+
+// sigV4 signs requests with AWS Signature Version 4
+type sigV4 struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// scope returns the credential scope for a signing date
+func (s sigV4) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signature signs a canonical request made at t
+func (s sigV4) signature(canonical string, t time.Time) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + s.scope(t) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	for _, part := range []string{s.region, s.service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// sign adds date, payload hash and authorization headers to req
+func (s sigV4) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" || lower == "range" {
+			headers[lower] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+	canonical, signed := canonicalRequest(req.Method, req.URL.Path, req.URL.Query(), headers, payloadHash)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+s.scope(t)+
+		", SignedHeaders="+signed+", Signature="+s.signature(canonical, t))
+}
+
+// presign returns u with query string authentication valid for expires
+func (s sigV4) presign(method string, u *url.URL, t time.Time, expires time.Duration) string {
+	t = t.UTC()
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical, _ := canonicalRequest(method, u.Path, query, map[string]string{"host": u.Host}, "UNSIGNED-PAYLOAD")
+	signed := *u
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + s.signature(canonical, t)
+	return signed.String()
+}
+
+// canonicalRequest builds the SigV4 canonical request and the list of
+// signed headers
+func canonicalRequest(method, path string, query url.Values, headers map[string]string, payloadHash string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	if path == "" {
+		path = "/"
+	}
+	signed := strings.Join(names, ";")
+	return strings.Join([]string{
+		method,
+		uriEncode(path, false),
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n"), signed
+}
+
+// canonicalQuery encodes a query string sorted by key, as SigV4 requires
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but RFC 3986 unreserved characters,
+// and slashes unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
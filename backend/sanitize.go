@@ -0,0 +1,49 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// htmlPolicy is the allowlist applied to HTML from accounts that may not
+// write raw HTML: the formatting, links, images, tables and math the editor
+// produces, without scripts, event handlers, frames or forms
+var htmlPolicy = newHTMLPolicy()
+
+func newHTMLPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// Authors' own links are endorsed, unlike comments
+	p.RequireNoFollowOnLinks(false)
+	p.AllowAttrs("target").Matching(regexp.MustCompile(`^_blank$`)).OnElements("a")
+	p.AllowAttrs("rel").Matching(bluemonday.SpaceSeparatedTokens).OnElements("a")
+	// Editor markup: mentions, highlighted code, math and image sizing
+	p.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).Globally()
+	p.AllowDataAttributes()
+	p.AllowStyles("width", "height", "max-width", "text-align").Globally()
+	return p
+}
+
+// sanitizeHTML strips anything outside htmlPolicy
+func sanitizeHTML(content string) string {
+	return htmlPolicy.Sanitize(content)
+}
+
+// trustsRawHTML reports whether a role's post HTML is published as written.
+// Editors and admins can already change any post and the site itself;
+// authors' content is sanitized so they can't run script as other users.
+func trustsRawHTML(role string) bool {
+	return roleAtLeast(role, roleEditor)
+}
+
+// postContentHTML returns a post's content as it may be rendered on the
+// site. Only posts whose author is still an editor or admin are trusted;
+// posts left without an author, e.g. after the account was deleted, are
+// sanitized like an author's. Posts from before accounts had roles were
+// given to the first account by the migration that added authors.
+func (a *App) postContentHTML(p Post) string {
+	if profile, ok := a.postAuthorProfile(p); ok && trustsRawHTML(profile.Role) {
+		return p.Content
+	}
+	return sanitizeHTML(p.Content)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthorPostHTMLIsSanitized(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	registerTestUser(t, srv.URL)
+	author := createTestAccount(t, app, "author", roleAuthor)
+	editor := createTestAccount(t, app, "editor", roleEditor)
+
+	_, body := doJSON(t, http.MethodPost, srv.URL+"/api/posts", author, "")
+	var p Post
+	_ = json.Unmarshal(body, &p)
+
+	unsafe := `<h1>Hi</h1><p><a class="mention" href="/posts/1" data-mention-id="1">Intro</a></p>` +
+		`<img src="/api/uploads/a.png" onerror="alert(1)"><script>alert(2)</script>` +
+		`<a href="javascript:alert(3)">x</a><iframe src="https://evil.example"></iframe>`
+	update, _ := json.Marshal(map[string]string{"content": unsafe})
+	if status, body := doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(p.ID), author, string(update)); status != http.StatusOK {
+		t.Fatalf("update: %d %s", status, body)
+	}
+	saved, _ := app.getPost(itoa(p.ID))
+	for _, bad := range []string{"<script", "onerror", "javascript:", "<iframe"} {
+		if strings.Contains(saved.Content, bad) {
+			t.Fatalf("author content kept %q: %s", bad, saved.Content)
+		}
+	}
+	for _, kept := range []string{"<h1>Hi</h1>", `class="mention"`, `data-mention-id="1"`, `<img src="/api/uploads/a.png">`} {
+		if !strings.Contains(saved.Content, kept) {
+			t.Fatalf("author content lost %q: %s", kept, saved.Content)
+		}
+	}
+
+	// Editors are trusted with raw HTML, e.g. embeds
+	embed, _ := json.Marshal(map[string]string{"content": `<h1>Video</h1><iframe src="https://www.youtube.com/embed/x"></iframe>`})
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(p.ID), editor, string(embed)); status != http.StatusOK {
+		t.Fatalf("editor update: %d", status)
+	}
+	if saved, _ = app.getPost(itoa(p.ID)); !strings.Contains(saved.Content, "<iframe") {
+		t.Fatalf("editor content sanitized: %s", saved.Content)
+	}
+
+	// Content already stored for an author, e.g. before a demotion, is
+	// sanitized when the page is rendered
+	app.DB.Exec(`UPDATE posts SET content = ?, is_private = 0 WHERE id = ?`, `<h1>Old</h1><script>alert(4)</script>`, p.ID)
+	page := getBodyOK(t, srv.URL+"/posts/"+itoa(p.ID))
+	if strings.Contains(page, "alert(4)") || !strings.Contains(page, "<h1>Old</h1>") {
+		t.Fatalf("author script rendered:\n%s", page)
+	}
+	for _, feed := range []string{"/rss.xml", "/atom.xml", "/feed.json"} {
+		if body := getBodyOK(t, srv.URL+feed); strings.Contains(body, "alert(4)") || !strings.Contains(body, "Old") {
+			t.Fatalf("author script in %s:\n%s", feed, body)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// schedulerIdleInterval is how long the scheduler sleeps when nothing is
+// scheduled; it is also an upper bound so clock jumps are picked up
+const schedulerIdleInterval = time.Hour
+
+// publishScheduler makes posts public once their publish_at time passes.
+// All schedule state lives in the posts table, so nothing is lost on restart.
+type publishScheduler struct {
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started bool
+}
+
+func newPublishScheduler() *publishScheduler {
+	return &publishScheduler{
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// poke asks the scheduler to re-read the schedule, e.g. after it changed
+func (s *publishScheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// shutdown stops the scheduler loop and waits for it to exit
+func (s *publishScheduler) shutdown() {
+	s.once.Do(func() { close(s.stop) })
+	if s.started {
+		<-s.done
+	}
+}
+
+// StartScheduler publishes anything that came due while the server was down
+// and then keeps watching the schedule in the background. Only the server
+// runs it, so one-off commands never publish posts or delete uploads. Upload
+// collection first runs one interval after start, not on every restart.
+func (a *App) StartScheduler() {
+	if _, err := a.publishDuePosts(time.Now()); err != nil {
+		a.Logger.Error("Failed to catch up on scheduled posts", "error", err)
+	}
+	a.uploadLimits.lastGC = time.Now()
+	a.scheduler.started = true
+	go a.runScheduler()
+}
+
+func (a *App) runScheduler() {
+	s := a.scheduler
+	defer close(s.done)
+
+	for {
+		wait := schedulerIdleInterval
+		next, err := a.publishDuePosts(time.Now())
+		if err != nil {
+			a.Logger.Error("Scheduled publishing failed", "error", err)
+		} else if !next.IsZero() {
+			wait = min(max(time.Until(next), 0), schedulerIdleInterval)
+		}
+		a.maybeCollectUploads(time.Now())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// publishDuePosts publishes every scheduled post whose time has come and
+// returns the next pending publish time, or the zero time if there is none
+func (a *App) publishDuePosts(now time.Time) (time.Time, error) {
+	// Compare in Go: stored timestamps are not guaranteed to sort as text
+	rows, err := a.DB.Query(`SELECT id, publish_at FROM posts WHERE publish_at IS NOT NULL`)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query scheduled posts: %v", err)
+	}
+	var due []int64
+	var next time.Time
+	for rows.Next() {
+		var id int64
+		var publishAt time.Time
+		if err := rows.Scan(&id, &publishAt); err != nil {
+			rows.Close()
+			return time.Time{}, fmt.Errorf("failed to scan scheduled post: %v", err)
+		}
+		if !publishAt.After(now) {
+			due = append(due, id)
+		} else if next.IsZero() || publishAt.Before(next) {
+			next = publishAt
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	for _, id := range due {
+		published, err := a.publishScheduledPost(id, now)
+		if err != nil {
+			a.Logger.Error("Failed to publish scheduled post", "postID", id, "error", err)
+			continue
+		}
+		if published {
+			a.Logger.Info("Published scheduled post", "postID", id)
+		}
+	}
+	return next, nil
+}
+
+// publishScheduledPost publishes a post only if it is still scheduled for
+// now or earlier, so an unpublish or reschedule made after publishDuePosts
+// read the schedule wins. It reports whether the post was published.
+func (a *App) publishScheduledPost(id int64, now time.Time) (bool, error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Compare in Go, like publishDuePosts
+	publishAt, scheduled, err := scheduledPublishAt(tx, id)
+	if err != nil || !scheduled || publishAt.After(now) {
+		return false, err
+	}
+	if _, err := tx.Exec(`UPDATE posts SET is_private = 0, publish_at = NULL, published_at = COALESCE(published_at, ?) WHERE id = ?`,
+		publishAt.UTC(), id); err != nil {
+		return false, fmt.Errorf("failed to publish scheduled post: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to publish scheduled post: %v", err)
+	}
+	if _, err := a.postPrivacyChanged(strconv.FormatInt(id, 10), false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// scheduledPublishAt reads a post's pending publish time; scheduled is false
+// when it has none
+func scheduledPublishAt(tx *sql.Tx, id any) (publishAt time.Time, scheduled bool, err error) {
+	var at sql.NullTime
+	if err := tx.QueryRow(`SELECT publish_at FROM posts WHERE id = ?`, id).Scan(&at); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, fmt.Errorf("failed to read post schedule: %v", err)
+	}
+	return at.Time, at.Valid, nil
+}
+
+// setPostPrivacy makes a post public or private right away, clearing any
+// pending schedule, and notifies caches and live subscribers
+func (a *App) setPostPrivacy(idStr string, private bool) (Post, error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return Post{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	query := `UPDATE posts SET is_private = 1, publish_at = NULL WHERE id = ?`
+	args := []any{idStr}
+	if !private {
+		// Only the first publication sets published_at; a scheduled post that
+		// is caught up late still counts as published at its scheduled time,
+		// but one published early never gets a date in the future
+		now := time.Now()
+		publishAt, scheduled, err := scheduledPublishAt(tx, idStr)
+		if err != nil {
+			return Post{}, err
+		}
+		publishedAt := now
+		if scheduled && !publishAt.After(now) {
+			publishedAt = publishAt
+		}
+		query = `UPDATE posts SET is_private = 0, publish_at = NULL, published_at = COALESCE(published_at, ?) WHERE id = ?`
+		args = []any{publishedAt.UTC(), idStr}
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return Post{}, fmt.Errorf("failed to update post privacy: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Post{}, fmt.Errorf("failed to update post privacy: %v", err)
+	}
+	return a.postPrivacyChanged(idStr, private)
+}
+
+// postPrivacyChanged assigns a slug to newly public posts and notifies
+// caches and live subscribers of the change
+func (a *App) postPrivacyChanged(idStr string, private bool) (Post, error) {
+	p, err := a.getPost(idStr)
+	if err != nil {
+		return Post{}, err
+	}
+
+	// Published posts get a stable, human-readable URL
+	if !private && p.Slug == "" {
+		if slug, err := a.ensurePostSlug(p); err != nil {
+			a.Logger.Error("Failed to assign slug on publish", "postID", idStr, "error", err.Error())
+		} else {
+			p.Slug = slug
+		}
+	}
+
+	// Invalidate posts cache and any cached render of this post
+	a.cacheInvalidatePattern("posts_list_")
+	a.cacheDelete(fmt.Sprintf("post_%s", idStr))
+	a.events.publish(postEventPrivacy, p)
+	return p, nil
+}
+
+// handlePostSchedule sets (PUT) or cancels (DELETE) the future publication
+// of a private post
+func (a *App) handlePostSchedule(w http.ResponseWriter, r *http.Request, idStr string) {
+	p, err := a.getPost(idStr)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "db error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if !canEditPost(requestClaims(r), p) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var publishAt any
+	switch r.Method {
+	case http.MethodPut:
+		var payload struct {
+			PublishAt time.Time `json:"publishAt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if !payload.PublishAt.After(time.Now()) {
+			http.Error(w, "publishAt must be in the future", http.StatusBadRequest)
+			return
+		}
+		if !p.IsPrivate {
+			http.Error(w, "post is already published", http.StatusConflict)
+			return
+		}
+		publishAt = payload.PublishAt.UTC()
+	case http.MethodDelete:
+		publishAt = nil
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := a.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, publishAt, idStr); err != nil {
+		a.Logger.Error("Failed to update post schedule", "postID", idStr, "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	a.scheduler.poke()
+
+	p, err = a.getPost(idStr)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	a.Logger.Info("Post schedule updated", "postID", idStr, "publishAt", p.PublishAt)
+	a.cacheInvalidatePattern("posts_list_")
+	a.events.publish(postEventUpdated, p)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
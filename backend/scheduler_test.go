@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublishDuePostsCatchesUp(t *testing.T) {
+	app := newTestApp(t)
+
+	missed := insertTestPost(t, app, "Missed", "<h1>Missed</h1>", true)
+	future := insertTestPost(t, app, "Future", "<h1>Future</h1>", true)
+	now := time.Now()
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, now.Add(-time.Hour).UTC(), missed)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, now.Add(time.Hour).UTC(), future)
+
+	next, err := app.publishDuePosts(now)
+	if err != nil {
+		t.Fatalf("publishDuePosts: %v", err)
+	}
+	if next.IsZero() || next.Sub(now.Add(time.Hour)).Abs() > time.Second {
+		t.Fatalf("expected next run at the future post, got %v", next)
+	}
+
+	p, _ := app.getPost(itoa(missed))
+	if p.IsPrivate || p.PublishAt != nil || p.Slug != "missed" {
+		t.Fatalf("missed post not published: %+v", p)
+	}
+	p, _ = app.getPost(itoa(future))
+	if !p.IsPrivate || p.PublishAt == nil {
+		t.Fatalf("future post published early: %+v", p)
+	}
+}
+
+// A schedule cancelled or moved after publishDuePosts read it must win
+func TestPublishScheduledPostRechecksSchedule(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Now()
+
+	cancelled := insertTestPost(t, app, "Cancelled", "<h1>Cancelled</h1>", true)
+	moved := insertTestPost(t, app, "Moved", "<h1>Moved</h1>", true)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, now.Add(time.Hour).UTC(), moved)
+	for _, id := range []int64{cancelled, moved} {
+		published, err := app.publishScheduledPost(id, now)
+		if err != nil || published {
+			t.Fatalf("post %d published: %v %v", id, published, err)
+		}
+		if p, _ := app.getPost(itoa(id)); !p.IsPrivate || p.PublishedAt != nil {
+			t.Fatalf("post %d made public: %+v", id, p)
+		}
+	}
+
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, now.Add(-time.Minute).UTC(), moved)
+	if published, err := app.publishScheduledPost(moved, now); err != nil || !published {
+		t.Fatalf("due post not published: %v %v", published, err)
+	}
+
+	// Times stored with an offset don't sort as text against UTC
+	east, west := time.FixedZone("east", 9*3600), time.FixedZone("west", -10*3600)
+	due := insertTestPost(t, app, "Due", "<h1>Due</h1>", true)
+	later := insertTestPost(t, app, "Later", "<h1>Later</h1>", true)
+	dueAt := now.Add(-time.Minute).Truncate(time.Second)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, dueAt.In(east), due)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, now.Add(time.Minute).In(west), later)
+	if published, err := app.publishScheduledPost(due, now); err != nil || !published {
+		t.Fatalf("due post stored with an offset not published: %v %v", published, err)
+	}
+	if p, _ := app.getPost(itoa(due)); p.PublishedAt == nil || !p.PublishedAt.Equal(dueAt) {
+		t.Fatalf("published_at = %v, want the scheduled %v", p.PublishedAt, dueAt)
+	}
+	if published, err := app.publishScheduledPost(later, now); err != nil || published {
+		t.Fatalf("future post stored with an offset published: %v %v", published, err)
+	}
+}
+
+func TestScheduledPostPublishesInBackground(t *testing.T) {
+	app := newTestApp(t)
+	app.StartScheduler()
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	id := insertTestPost(t, app, "Soon", "<h1>Soon</h1>", true)
+	schedule := func(body string) int {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/posts/"+itoa(id)+"/schedule", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("schedule: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := schedule(`{"publishAt":"2001-01-01T00:00:00Z"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for past publishAt, got %d", status)
+	}
+	at := time.Now().Add(300 * time.Millisecond).UTC().Format(time.RFC3339Nano)
+	if status := schedule(`{"publishAt":"` + at + `"}`); status != http.StatusOK {
+		t.Fatalf("schedule status %d", status)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if p, err := app.getPost(itoa(id)); err == nil && !p.IsPrivate {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("scheduled post was not published")
+}
+
+// Opening the database, as the CLI commands do, must not publish posts
+func TestSchedulerOnlyRunsWhenStarted(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	app, err := NewApp(dbPath)
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	id := insertTestPost(t, app, "Due", "<h1>Due</h1>", true)
+	app.DB.Exec(`UPDATE posts SET publish_at = ? WHERE id = ?`, time.Now().Add(-time.Hour).UTC(), id)
+	app.Close()
+
+	app, err = NewApp(dbPath)
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	defer app.Close()
+	if err := app.runCommand([]string{"help"}, io.Discard); err != nil {
+		t.Fatalf("help: %v", err)
+	}
+	if p, _ := app.getPost(itoa(id)); !p.IsPrivate {
+		t.Fatal("opening the app published a scheduled post")
+	}
+
+	app.StartScheduler()
+	if p, _ := app.getPost(itoa(id)); p.IsPrivate {
+		t.Fatal("starting the scheduler did not catch up on the due post")
+	}
+}
+
+func TestUploadGCWaitsAnIntervalAfterStart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	app, err := NewApp(dbPath)
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	srv := httptest.NewServer(app.Mux)
+	token := registerTestUser(t, srv.URL)
+	status, body := uploadTestFile(t, srv.URL, token, "orphan.png", "image/png", testPNG(t, 20, 10))
+	srv.Close()
+	var att Attachment
+	if status != http.StatusCreated || json.Unmarshal(body, &att) != nil {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	app.DB.Exec(`UPDATE attachments SET created_at = ?`, time.Now().Add(-2*uploadGCGrace))
+
+	// The loop runs once before Close stops it
+	app.uploadLimits.gcInterval = time.Hour
+	app.StartScheduler()
+	app.Close()
+
+	app, err = NewApp(dbPath)
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	defer app.Close()
+	if _, _, err := app.getUpload(att.Filename); err != nil {
+		t.Fatalf("starting the scheduler collected uploads right away: %v", err)
+	}
+
+	start := time.Now()
+	app.uploadLimits.gcInterval = time.Hour
+	app.uploadLimits.lastGC = start
+	app.maybeCollectUploads(start.Add(time.Hour))
+	if _, _, err := app.getUpload(att.Filename); err == nil {
+		t.Fatal("unused upload kept after the interval passed")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	searchDefaultLimit  = 20
+	searchMaxLimit      = 50
+	searchMaxTerms      = 16
+	searchSnippetTokens = 24
+
+	// Snippet highlight markers; control characters never survive
+	// searchableText so they cannot be forged by post content
+	searchMarkOpen  = "\x02"
+	searchMarkClose = "\x03"
+)
+
+type SearchResult struct {
+	ID          int64      `json:"id"`
+	Title       *string    `json:"title,omitempty"`
+	Slug        string     `json:"slug,omitempty"`
+	Path        string     `json:"path"`
+	Snippet     string     `json:"snippet"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	IsPrivate   bool       `json:"isPrivate"`
+}
+
+var searchPageTemplate = template.Must(template.New("search_ssr").Parse(`
+<div class="home-container">
+  <header class="site-header ssr-header">
+    <div class="site-header-content">
+      <div class="site-title">{{.SiteTitle}}</div>
+      <nav class="header-actions ssr-nav" aria-label="Primary">
+        <a class="header-button" href="/">Home</a>
+        <a class="header-button" href="/archive">Archive</a>
+        {{if .AboutEnabled}}<a class="header-button" href="/about">About Me</a>{{end}}
+        <a class="header-button" href="/search">Search</a>
+        <a class="header-button" href="/rss.xml">RSS</a>
+      </nav>
+    </div>
+  </header>
+  <main class="home-content">
+    <h1>Search</h1>
+    <form class="search-container" action="/search" method="get" role="search">
+      <input class="search-input" type="search" name="q" value="{{.Query}}" placeholder="Search posts...">
+    </form>
+    {{if .Results}}
+    <ul class="post-list search-results">
+      {{range .Results}}
+      <li>
+        <a class="post-link" href="{{.Path}}">
+          <span class="post-title">{{.Title}}</span>
+          <span class="post-meta"> — {{.Date}}</span>
+        </a>
+        <p class="search-snippet">{{.Snippet}}</p>
+      </li>
+      {{end}}
+    </ul>
+    {{else if .Query}}
+    <p>No posts match your search.</p>
+    {{end}}
+  </main>
+</div>`))
+
+// searchableText flattens post HTML into the plain text stored in the index
+func searchableText(content string) string {
+	// Pad tag boundaries so adjacent blocks do not run together
+	text := html.UnescapeString(stripHTML(strings.ReplaceAll(content, ">", "> ")))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// indexPost refreshes the search index entry for a post, removing it when
+// the post no longer exists
+func (a *App) indexPost(postID int64) error {
+	var title sql.NullString
+	var content string
+	err := a.DB.QueryRow(`SELECT title, content FROM posts WHERE id = ?`, postID).Scan(&title, &content)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to load post for indexing: %v", err)
+	}
+	found := err == nil
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if _, err := tx.Exec(`DELETE FROM posts_fts WHERE rowid = ?`, postID); err != nil {
+		return fmt.Errorf("failed to clear search entry: %v", err)
+	}
+	if found {
+		if _, err := tx.Exec(`INSERT INTO posts_fts(rowid, title, body) VALUES (?, ?, ?)`,
+			postID, title.String, searchableText(content)); err != nil {
+			return fmt.Errorf("failed to index post: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// rebuildSearchIndex repopulates posts_fts from scratch so the index always
+// matches the posts table after startup, whatever happened to the database
+// while the server was down
+func rebuildSearchIndex(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, title, content FROM posts`)
+	if err != nil {
+		return fmt.Errorf("failed to query posts for search index: %v", err)
+	}
+	type entry struct {
+		id    int64
+		title string
+		body  string
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		var title sql.NullString
+		var content string
+		if err := rows.Scan(&e.id, &title, &content); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan post for search index: %v", err)
+		}
+		e.title = title.String
+		e.body = searchableText(content)
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if _, err := tx.Exec(`DELETE FROM posts_fts`); err != nil {
+		return fmt.Errorf("failed to clear search index: %v", err)
+	}
+	for _, e := range entries {
+		if _, err := tx.Exec(`INSERT INTO posts_fts(rowid, title, body) VALUES (?, ?, ?)`, e.id, e.title, e.body); err != nil {
+			return fmt.Errorf("failed to index post %d: %v", e.id, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ftsQuery turns free-form user input into a safe FTS5 query: every word is
+// quoted so operators are taken literally, and the last word matches as a
+// prefix to support search-as-you-type
+func ftsQuery(raw string) string {
+	terms := strings.FieldsFunc(raw, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) > searchMaxTerms {
+		terms = terms[:searchMaxTerms]
+	}
+	for i, term := range terms {
+		terms[i] = `"` + term + `"`
+	}
+	if len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlightSnippet escapes an index snippet and turns the match markers
+// into <mark> elements
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, searchMarkOpen, "<mark>")
+	return strings.ReplaceAll(escaped, searchMarkClose, "</mark>")
+}
+
+// searchPosts runs a ranked full-text query. Title matches weigh more than
+// body matches; private posts are only returned to authenticated callers.
+func (a *App) searchPosts(query string, isAuthenticated bool, limit, offset int) ([]SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return []SearchResult{}, nil
+	}
+
+	rows, err := a.DB.Query(`
+SELECT p.id, p.title, COALESCE(p.slug, ''), p.created_at, p.updated_at, p.published_at, p.is_private,
+       snippet(posts_fts, -1, ?, ?, '…', ?)
+FROM posts_fts
+JOIN posts p ON p.id = posts_fts.rowid
+WHERE posts_fts MATCH ? AND (? OR p.is_private = 0)
+ORDER BY bm25(posts_fts, 10.0, 1.0), p.updated_at DESC
+LIMIT ? OFFSET ?`,
+		searchMarkOpen, searchMarkClose, searchSnippetTokens, match, isAuthenticated, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var res SearchResult
+		var title sql.NullString
+		var publishedAt sql.NullTime
+		var snippet string
+		if err := rows.Scan(&res.ID, &title, &res.Slug, &res.CreatedAt, &res.UpdatedAt, &publishedAt, &res.IsPrivate, &snippet); err != nil {
+			return nil, err
+		}
+		if publishedAt.Valid {
+			res.PublishedAt = &publishedAt.Time
+		}
+		if title.Valid {
+			t := title.String
+			res.Title = &t
+		}
+		res.Path = postPath(Post{ID: res.ID, Slug: res.Slug})
+		res.Snippet = highlightSnippet(snippet)
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "missing q parameter", http.StatusBadRequest)
+		return
+	}
+
+	limit := searchDefaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, searchMaxLimit)
+	}
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	results, err := a.searchPosts(query, a.isAuthenticated(r), limit, offset)
+	if err != nil {
+		a.Logger.Error("Search query failed", "query", query, "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   query,
+		"results": results,
+	})
+}
+
+func (a *App) renderSearchPage(currentURL, siteBase, query string, isAuthenticated bool) (pageRender, error) {
+	settings, err := a.getPublicSettings()
+	if err != nil {
+		return pageRender{}, err
+	}
+
+	query = strings.TrimSpace(query)
+	results := []SearchResult{}
+	if query != "" {
+		results, err = a.searchPosts(query, isAuthenticated, searchDefaultLimit, 0)
+		if err != nil {
+			return pageRender{}, err
+		}
+	}
+
+	type resultItem struct {
+		Path    string
+		Title   string
+		Date    string
+		Snippet template.HTML
+	}
+	items := make([]resultItem, 0, len(results))
+	for _, res := range results {
+		items = append(items, resultItem{
+			Path:    res.Path,
+			Title:   defaultPostTitle(res.Title, res.ID),
+			Date:    displayDate(Post{CreatedAt: res.CreatedAt, UpdatedAt: res.UpdatedAt, PublishedAt: res.PublishedAt}),
+			Snippet: template.HTML(res.Snippet),
+		})
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		SiteTitle    string
+		AboutEnabled bool
+		Query        string
+		Results      []resultItem
+	}{
+		SiteTitle:    settings.SiteTitle,
+		AboutEnabled: settings.AboutEnabled,
+		Query:        query,
+		Results:      items,
+	}
+	if err := searchPageTemplate.Execute(&buf, data); err != nil {
+		return pageRender{}, err
+	}
+
+	pageTitle := "Search"
+	if query != "" {
+		pageTitle = fmt.Sprintf("Search: %s", query)
+	}
+	meta := pageMeta{
+		title:       buildPageTitle(pageTitle, settings.SiteTitle),
+		description: "Search posts on " + strings.TrimSpace(settings.SiteTitle),
+		canonical:   strings.TrimRight(siteBase, "/") + "/search",
+	}
+	metaTags := []metaTag{
+		// Result pages are endless permutations; keep them out of indexes
+		{Name: "robots", Content: "noindex,follow"},
+		{Property: "og:title", Content: meta.title},
+		{Property: "og:type", Content: "website"},
+		{Property: "og:url", Content: currentURL},
+	}
+
+	return pageRender{
+		body:   buf.String(),
+		meta:   meta,
+		status: http.StatusOK,
+		hydrate: map[string]any{
+			"route":    "/search",
+			"settings": settings,
+		},
+		metaTags: metaTags,
+		linkTags: feedLinkTags(siteBase, settings.SiteTitle),
+	}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFTSQueryQuotesInput(t *testing.T) {
+	cases := map[string]string{
+		"quiet craft":       `"quiet" "craft"*`,
+		`NEAR("a" OR b) -c`: `"NEAR" "a" "OR" "b" "c"*`,
+		"  ***  ":           "",
+	}
+	for in, want := range cases {
+		if got := ftsQuery(in); got != want {
+			t.Errorf("ftsQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSearchRespectsPrivacy(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	insertTestPost(t, app, "Gardening Notes", "<h1>Gardening Notes</h1><p>Tomatoes need <b>sun</b> &amp; water.</p>", false)
+	insertTestPost(t, app, "Private Diary", "<h1>Private Diary</h1><p>Tomatoes again</p>", true)
+
+	search := func(q, token string) []SearchResult {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/search?q="+url.QueryEscape(q), nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("search status %d", resp.StatusCode)
+		}
+		var body struct {
+			Results []SearchResult `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body.Results
+	}
+
+	public := search("tomato", "")
+	if len(public) != 1 || public[0].Title == nil || *public[0].Title != "Gardening Notes" {
+		t.Fatalf("unexpected anonymous results: %+v", public)
+	}
+	if !strings.Contains(public[0].Snippet, "<mark>Tomatoes</mark>") || !strings.Contains(public[0].Snippet, "&amp;") {
+		t.Fatalf("snippet not highlighted/escaped: %q", public[0].Snippet)
+	}
+
+	if private := search("tomato", token); len(private) != 2 {
+		t.Fatalf("expected private post for authenticated search, got %d results", len(private))
+	}
+
+	resp, err := http.Get(srv.URL + "/search?q=tomatoes")
+	if err != nil {
+		t.Fatalf("get search page: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("search page status %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(page), "Gardening Notes") || strings.Contains(string(page), "Private Diary") {
+		t.Fatalf("search page results wrong: %s", page)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// refreshTokenTTL is how long a session survives without being refreshed
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// sessionUserAgentMax bounds the stored User-Agent header
+const sessionUserAgentMax = 512
+
+var errSessionRevoked = errors.New("session revoked")
+
+// Session is a signed-in device, backed by one refresh_tokens row whose
+// token rotates on every refresh
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"`
+}
+
+// newRefreshToken returns a random refresh token and the hash stored for it
+func newRefreshToken() (string, string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", "", err
+	}
+	token := base64.URLEncoding.EncodeToString(tokenBytes)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// sessionUserAgent returns the request's User-Agent, truncated for storage
+func sessionUserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) <= sessionUserAgentMax {
+		return ua
+	}
+	ua = ua[:sessionUserAgentMax]
+	for !utf8.ValidString(ua) {
+		ua = ua[:len(ua)-1]
+	}
+	return ua
+}
+
+// rotateRefreshToken replaces a session's refresh token and extends it. The
+// old token must still match, so a token can only be redeemed once.
+func (a *App) rotateRefreshToken(sessionID int64, oldToken string, r *http.Request) (string, error) {
+	refreshToken, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	res, err := a.DB.Exec(`
+        UPDATE refresh_tokens
+        SET token_hash = ?, expires_at = ?, last_used_at = ?, user_agent = ?, ip = ?
+        WHERE id = ? AND token_hash = ?`,
+		tokenHash, now.Add(refreshTokenTTL), now, sessionUserAgent(r), a.clientIP(r),
+		sessionID, hashRefreshToken(oldToken))
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", errSessionRevoked
+	}
+	return refreshToken, nil
+}
+
+// sessionActive reports whether an access token's session still exists
+func (a *App) sessionActive(userID, sessionID int64) (bool, error) {
+	if sessionID == 0 {
+		return false, nil
+	}
+	var active bool
+	err := a.DB.QueryRow(`SELECT COUNT(*) > 0 FROM refresh_tokens WHERE id = ? AND user_id = ? AND expires_at > ?`,
+		sessionID, userID, time.Now()).Scan(&active)
+	return active, err
+}
+
+// listSessions returns a user's unexpired sessions, most recently used first
+func (a *App) listSessions(userID, currentID int64) ([]Session, error) {
+	rows, err := a.DB.Query(`
+        SELECT id, created_at, last_used_at, expires_at, user_agent, ip
+        FROM refresh_tokens
+        WHERE user_id = ? AND expires_at > ?
+        ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&s.ID, &s.CreatedAt, &lastUsed, &s.ExpiresAt, &s.UserAgent, &s.IP); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			s.LastUsedAt = &lastUsed.Time
+		}
+		s.Current = s.ID == currentID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// revokeSession ends one of a user's sessions; sql.ErrNoRows means the
+// session does not exist or belongs to someone else
+func (a *App) revokeSession(userID, sessionID int64) error {
+	res, err := a.DB.Exec(`DELETE FROM refresh_tokens WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// handleLogout ends the current session. The refresh token in the body is
+// enough, so clients can log out after their access token expired.
+func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	// The body is optional
+	_ = json.NewDecoder(r.Body).Decode(&payload)
+
+	if payload.RefreshToken != "" {
+		if err := a.revokeRefreshToken(payload.RefreshToken); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		claims := requestClaims(r)
+		if err := a.revokeSession(claims.UserID, claims.SessionID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		a.Logger.Info("Logged out", "userID", claims.UserID, "sessionID", claims.SessionID)
+		w.WriteHeader(http.StatusNoContent)
+	})(w, r)
+}
+
+// handleSessions lists the caller's sessions (GET) or logs out everywhere
+// (DELETE)
+func (a *App) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			claims := requestClaims(r)
+			sessions, err := a.listSessions(claims.UserID, claims.SessionID)
+			if err != nil {
+				a.Logger.Error("Failed to list sessions", "userID", claims.UserID, "error", err.Error())
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			_ = json.NewEncoder(w).Encode(sessions)
+		})(w, r)
+	case http.MethodDelete:
+		a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			userID := requestClaims(r).UserID
+			if _, err := a.DB.Exec(`DELETE FROM refresh_tokens WHERE user_id = ?`, userID); err != nil {
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			a.Logger.Info("Logged out everywhere", "userID", userID)
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSession revokes one of the caller's sessions
+func (a *App) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid session id", http.StatusBadRequest)
+			return
+		}
+		userID := requestClaims(r).UserID
+		if err := a.revokeSession(userID, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "session not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		a.Logger.Info("Session revoked", "userID", userID, "sessionID", id)
+		w.WriteHeader(http.StatusNoContent)
+	})(w, r)
+}
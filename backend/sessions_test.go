@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testSession struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// loginAs signs in with the test password from a named device
+func loginAs(t *testing.T, baseURL, username, userAgent string) testSession {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/auth/login",
+		strings.NewReader(`{"username":"`+username+`","password":"secret-password"}`))
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	defer resp.Body.Close()
+	var s testSession
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("login status %d: %v", resp.StatusCode, err)
+	}
+	return s
+}
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	registerTestUser(t, srv.URL)
+	laptop := loginAs(t, srv.URL, "admin", "laptop")
+	phone := loginAs(t, srv.URL, "admin", "phone")
+
+	status, body := doJSON(t, http.MethodGet, srv.URL+"/api/auth/sessions", laptop.Token, "")
+	var sessions []Session
+	_ = json.Unmarshal(body, &sessions)
+	if status != http.StatusOK || len(sessions) != 3 {
+		t.Fatalf("list sessions: %d %s", status, body)
+	}
+	var phoneID int64
+	for _, s := range sessions {
+		if s.UserAgent == "phone" {
+			phoneID = s.ID
+		}
+		if s.Current != (s.UserAgent == "laptop") || s.IP == "" {
+			t.Fatalf("unexpected session %+v", s)
+		}
+	}
+
+	// Refreshing rotates the token but keeps the session
+	status, body = doJSON(t, http.MethodPost, srv.URL+"/api/auth/refresh", "", `{"refreshToken":"`+phone.RefreshToken+`"}`)
+	var refreshed testSession
+	_ = json.Unmarshal(body, &refreshed)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/refresh", "", `{"refreshToken":"`+phone.RefreshToken+`"}`); status != http.StatusUnauthorized {
+		t.Fatalf("refresh token reused: %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/auth/sessions/"+itoa(phoneID), laptop.Token, ""); status != http.StatusNoContent {
+		t.Fatalf("revoke session: %d", status)
+	}
+	for _, token := range []string{phone.Token, refreshed.Token} {
+		if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", token, ""); status != http.StatusUnauthorized {
+			t.Fatalf("access token of revoked session still valid: %d", status)
+		}
+	}
+
+	// Logging out kills the current session only
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/logout", laptop.Token, ""); status != http.StatusNoContent {
+		t.Fatalf("logout: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", laptop.Token, ""); status != http.StatusUnauthorized {
+		t.Fatalf("token valid after logout: %d", status)
+	}
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	registerTestUser(t, srv.URL)
+	first := loginAs(t, srv.URL, "admin", "first")
+	second := loginAs(t, srv.URL, "admin", "second")
+	other := createTestAccount(t, app, "other", roleAuthor)
+
+	// Sessions of other users cannot be revoked
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/auth/sessions/1", other, ""); status != http.StatusNotFound {
+		t.Fatalf("revoked another user's session: %d", status)
+	}
+
+	// A refresh token alone is enough to log out
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/logout", "", `{"refreshToken":"`+second.RefreshToken+`"}`); status != http.StatusNoContent {
+		t.Fatalf("logout with refresh token: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", second.Token, ""); status != http.StatusUnauthorized {
+		t.Fatalf("token valid after logout: %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/auth/sessions", first.Token, ""); status != http.StatusNoContent {
+		t.Fatalf("log out everywhere: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", first.Token, ""); status != http.StatusUnauthorized {
+		t.Fatalf("token valid after logging out everywhere: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", other, ""); status != http.StatusOK {
+		t.Fatalf("other user's session was revoked: %d", status)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+type settingVisibility int
+
+const (
+	// settingPublic values are readable by anyone, including anonymous readers
+	settingPublic settingVisibility = iota
+	// settingPrivate values are only returned to authenticated callers
+	settingPrivate
+	// settingSecret values are write-only; reads only report whether they are set
+	settingSecret
+	// settingInternal values are managed by the server and never exposed
+	settingInternal
+)
+
+type settingKind int
+
+const (
+	settingString settingKind = iota
+	settingText
+	settingBool
+	settingURL
+	settingEnum
+	settingBaseURL
+)
+
+type settingDef struct {
+	visibility settingVisibility
+	kind       settingKind
+	maxLength  int
+	options    []string
+}
+
+// settingsRegistry lists every key that may live in the settings table.
+// Keys missing from the registry are rejected by PUT /api/settings and never
+// returned by GET /api/settings.
+var settingsRegistry = map[string]settingDef{
+	"siteTitle":      {visibility: settingPublic, kind: settingString, maxLength: 200},
+	"introText":      {visibility: settingPublic, kind: settingText, maxLength: 2000},
+	"heroImage":      {visibility: settingPublic, kind: settingURL, maxLength: 2048},
+	"aboutEnabled":   {visibility: settingPublic, kind: settingBool},
+	"aboutContent":   {visibility: settingPublic, kind: settingText, maxLength: 1 << 20},
+	"authorName":     {visibility: settingPublic, kind: settingString, maxLength: 200},
+	"robotsTxt":      {visibility: settingPublic, kind: settingText, maxLength: 16 << 10},
+	"site_url":       {visibility: settingPublic, kind: settingBaseURL, maxLength: 2048},
+	"ai_enabled":     {visibility: settingPublic, kind: settingBool},
+	"log_level":      {visibility: settingPrivate, kind: settingEnum, options: []string{"DEBUG", "INFO"}},
+	"openai_api_key": {visibility: settingSecret, kind: settingString, maxLength: 512},
+	"jwt_secret":     {visibility: settingInternal},
+}
+
+// secretConfiguredSuffix is appended to secret keys in GET responses to report
+// whether a value has been stored without revealing it
+const secretConfiguredSuffix = "_configured"
+
+func lookupSetting(key string) (settingDef, bool) {
+	def, ok := settingsRegistry[key]
+	return def, ok
+}
+
+// readableBy reports whether the setting value may be returned to the caller
+func (d settingDef) readableBy(isAuthenticated bool) bool {
+	switch d.visibility {
+	case settingPublic:
+		return true
+	case settingPrivate:
+		return isAuthenticated
+	}
+	return false
+}
+
+// normalize validates a value for the setting type and returns the form that
+// should be stored
+func (d settingDef) normalize(value string) (string, error) {
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("value must be valid UTF-8")
+	}
+	if d.maxLength > 0 && len(value) > d.maxLength {
+		return "", fmt.Errorf("value must be at most %d bytes", d.maxLength)
+	}
+
+	switch d.kind {
+	case settingString:
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("value must be a single line")
+		}
+		return strings.TrimSpace(value), nil
+	case settingText:
+		return value, nil
+	case settingBool:
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "true":
+			return "true", nil
+		case "false", "":
+			return "false", nil
+		}
+		return "", fmt.Errorf("value must be true or false")
+	case settingURL:
+		value = strings.TrimSpace(value)
+		if value == "" || (strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//")) {
+			return value, nil
+		}
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", fmt.Errorf("value must be a site-relative path or an http(s) URL")
+		}
+		return value, nil
+	case settingBaseURL:
+		return normalizeBaseURL(value)
+	case settingEnum:
+		upper := strings.ToUpper(strings.TrimSpace(value))
+		for _, opt := range d.options {
+			if upper == opt {
+				return opt, nil
+			}
+		}
+		return "", fmt.Errorf("value must be one of %s", strings.Join(d.options, ", "))
+	}
+	return "", fmt.Errorf("unsupported setting type")
+}
+
+// readSettings returns the settings visible to the caller. Secret keys are
+// reported only as "<key>_configured" flags for authenticated callers.
+func (a *App) readSettings(isAuthenticated bool) (map[string]string, error) {
+	rows, err := a.DB.Query(`SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		stored[k] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string)
+	for key, def := range settingsRegistry {
+		value, ok := stored[key]
+		switch {
+		case def.visibility == settingSecret:
+			if isAuthenticated {
+				settings[key+secretConfiguredSuffix] = fmt.Sprintf("%t", ok && value != "")
+			}
+		case def.readableBy(isAuthenticated) && ok:
+			settings[key] = value
+		}
+	}
+	return settings, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func putSetting(t *testing.T, baseURL, token, key, value string) int {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"key": key, "value": value})
+	req, _ := http.NewRequest(http.MethodPut, baseURL+"/api/settings", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("put setting: %v", err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func getSettings(t *testing.T, baseURL, token string) map[string]string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/api/settings", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get settings: %v", err)
+	}
+	defer resp.Body.Close()
+	settings := map[string]string{}
+	if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+		t.Fatalf("decode settings: %v", err)
+	}
+	return settings
+}
+
+func TestSettingsDoNotLeakSecrets(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	if status := putSetting(t, srv.URL, token, "openai_api_key", "sk-test"); status != http.StatusOK {
+		t.Fatalf("put secret status: %d", status)
+	}
+	if status := putSetting(t, srv.URL, token, "siteTitle", "My Blog"); status != http.StatusOK {
+		t.Fatalf("put title status: %d", status)
+	}
+
+	public := getSettings(t, srv.URL, "")
+	if public["siteTitle"] != "My Blog" {
+		t.Fatalf("expected public siteTitle, got %v", public)
+	}
+	for _, key := range []string{"jwt_secret", "openai_api_key", "openai_api_key_configured", "log_level"} {
+		if _, ok := public[key]; ok {
+			t.Fatalf("anonymous settings must not include %s", key)
+		}
+	}
+
+	private := getSettings(t, srv.URL, token)
+	if _, ok := private["openai_api_key"]; ok {
+		t.Fatalf("secret value returned to authenticated caller")
+	}
+	if private["openai_api_key_configured"] != "true" {
+		t.Fatalf("expected configured flag, got %v", private)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/settings?key=jwt_secret")
+	if err != nil {
+		t.Fatalf("get jwt_secret: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for jwt_secret, got %d", resp.StatusCode)
+	}
+}
+
+func TestSettingsRejectInvalidWrites(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	cases := []struct{ key, value string }{
+		{"jwt_secret", "hijacked"},
+		{"not_a_setting", "x"},
+		{"aboutEnabled", "maybe"},
+		{"heroImage", "javascript:alert(1)"},
+		{"log_level", "TRACE"},
+	}
+	for _, c := range cases {
+		if status := putSetting(t, srv.URL, token, c.key, c.value); status != http.StatusBadRequest {
+			t.Fatalf("PUT %s=%q: expected 400, got %d", c.key, c.value, status)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// sitemapPageSize is the most URLs listed in one sitemap file; larger sites
+// are split behind a sitemap index. 50,000 is the protocol limit.
+const sitemapPageSize = 50000
+
+// defaultRobotsTxt is served when the robotsTxt setting is empty
+const defaultRobotsTxt = `User-agent: *
+Disallow: /api/
+Allow: /api/uploads/
+Disallow: /admin
+Disallow: /settings
+`
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	XMLNS    string         `xml:"xmlns,attr"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapPage is a site-relative URL with its last modification time
+type sitemapPage struct {
+	path    string
+	lastMod time.Time
+}
+
+// sitemapPages lists every public page in a stable order: home, archive,
+// about (when enabled) and then posts by id, so page boundaries of a split
+// sitemap only move when posts are added or removed
+func (a *App) sitemapPages() ([]sitemapPage, error) {
+	settings, err := a.getPublicSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := a.DB.Query(`SELECT id, COALESCE(slug, ''), updated_at FROM posts WHERE is_private = 0 ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts for sitemap: %v", err)
+	}
+	defer rows.Close()
+
+	var posts []sitemapPage
+	var latest time.Time
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.Slug, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan post for sitemap: %v", err)
+		}
+		if p.UpdatedAt.After(latest) {
+			latest = p.UpdatedAt
+		}
+		posts = append(posts, sitemapPage{path: postPath(p), lastMod: p.UpdatedAt})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pages := []sitemapPage{{path: "/", lastMod: latest}, {path: "/archive", lastMod: latest}}
+	if settings.AboutEnabled {
+		aboutMod, err := a.settingsLastModified("aboutContent", "aboutEnabled")
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, sitemapPage{path: "/about", lastMod: aboutMod})
+	}
+	return append(pages, posts...), nil
+}
+
+// settingsLastModified returns the most recent update time of the given keys
+func (a *App) settingsLastModified(keys ...string) (time.Time, error) {
+	var latest time.Time
+	for _, key := range keys {
+		var updated time.Time
+		err := a.DB.QueryRow(`SELECT updated_at FROM settings WHERE key = ?`, key).Scan(&updated)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, err
+		}
+		if updated.After(latest) {
+			latest = updated
+		}
+	}
+	return latest, nil
+}
+
+// sitemapLoc turns a site-relative path into an escaped absolute URL
+func sitemapLoc(siteBase, p string) string {
+	return strings.TrimRight(siteBase, "/") + (&url.URL{Path: p}).EscapedPath()
+}
+
+func sitemapDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func latestSitemapMod(pages []sitemapPage) time.Time {
+	var latest time.Time
+	for _, p := range pages {
+		if p.lastMod.After(latest) {
+			latest = p.lastMod
+		}
+	}
+	return latest
+}
+
+func buildSitemapURLSet(pages []sitemapPage, siteBase string) ([]byte, error) {
+	set := sitemapURLSet{XMLNS: sitemapNS}
+	for _, p := range pages {
+		set.URLs = append(set.URLs, sitemapURL{Loc: sitemapLoc(siteBase, p.path), LastMod: sitemapDate(p.lastMod)})
+	}
+	return marshalSitemap(set)
+}
+
+func marshalSitemap(v any) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// sitemapChunk returns the pages listed in the n-th (1-based) split sitemap
+// of size pages each
+func sitemapChunk(pages []sitemapPage, n, size int) []sitemapPage {
+	start := (n - 1) * size
+	if n < 1 || start >= len(pages) {
+		return nil
+	}
+	return pages[start:min(start+size, len(pages))]
+}
+
+// handleSitemap serves /sitemap.xml: a plain URL set for most blogs, or a
+// sitemap index pointing at /sitemaps/{n}.xml once the site outgrows one file
+func (a *App) handleSitemap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pages, err := a.sitemapPages()
+	if err != nil {
+		a.Logger.Error("Failed to load sitemap pages", "error", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	siteBase := a.requestSiteBase(r)
+	var body []byte
+	if len(pages) <= a.sitemapPageSize {
+		body, err = buildSitemapURLSet(pages, siteBase)
+	} else {
+		index := sitemapIndex{XMLNS: sitemapNS}
+		for n := 1; len(sitemapChunk(pages, n, a.sitemapPageSize)) > 0; n++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapEntry{
+				Loc:     fmt.Sprintf("%s/sitemaps/%d.xml", strings.TrimRight(siteBase, "/"), n),
+				LastMod: sitemapDate(latestSitemapMod(sitemapChunk(pages, n, a.sitemapPageSize))),
+			})
+		}
+		body, err = marshalSitemap(index)
+	}
+	if err != nil {
+		a.Logger.Error("Failed to render sitemap", "error", err)
+		http.Error(w, "failed to render sitemap", http.StatusInternalServerError)
+		return
+	}
+
+	writeFeedResponse(w, r, "application/xml; charset=utf-8", body, latestSitemapMod(pages))
+}
+
+// handleSitemapPage serves one file of a split sitemap
+func (a *App) handleSitemapPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".xml")
+	n, err := strconv.Atoi(name)
+	if !ok || err != nil || n < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	pages, err := a.sitemapPages()
+	if err != nil {
+		a.Logger.Error("Failed to load sitemap pages", "error", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	chunk := sitemapChunk(pages, n, a.sitemapPageSize)
+	if len(chunk) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := buildSitemapURLSet(chunk, a.requestSiteBase(r))
+	if err != nil {
+		a.Logger.Error("Failed to render sitemap", "error", err)
+		http.Error(w, "failed to render sitemap", http.StatusInternalServerError)
+		return
+	}
+
+	writeFeedResponse(w, r, "application/xml; charset=utf-8", body, latestSitemapMod(chunk))
+}
+
+// handleRobots serves robots.txt from the robotsTxt setting, falling back to
+// defaultRobotsTxt, and points crawlers at the sitemap
+func (a *App) handleRobots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var rules string
+	err := a.DB.QueryRow(`SELECT value FROM settings WHERE key = 'robotsTxt'`).Scan(&rules)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		a.Logger.Error("Failed to load robots.txt setting", "error", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if strings.TrimSpace(rules) == "" {
+		rules = defaultRobotsTxt
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.TrimRight(strings.ReplaceAll(rules, "\r\n", "\n"), "\n"))
+	buf.WriteString("\n")
+	if !hasSitemapDirective(rules) {
+		fmt.Fprintf(&buf, "\nSitemap: %s/sitemap.xml\n", strings.TrimRight(a.requestSiteBase(r), "/"))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// hasSitemapDirective reports whether custom rules already name a sitemap
+func hasSitemapDirective(rules string) bool {
+	for _, line := range strings.Split(rules, "\n") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "sitemap:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getBodyOK(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("get %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return string(body)
+}
+
+func TestSitemapListsPublicPages(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	public := insertTestPost(t, app, "Public", "<h1>Public</h1>", false)
+	app.DB.Exec(`UPDATE posts SET slug = 'public' WHERE id = ?`, public)
+	insertTestPost(t, app, "Secret", "<h1>Secret</h1>", true)
+
+	body := getBodyOK(t, srv.URL+"/sitemap.xml")
+	var set sitemapURLSet
+	if err := xml.Unmarshal([]byte(body), &set); err != nil {
+		t.Fatalf("parse sitemap: %v\n%s", err, body)
+	}
+	locs := make(map[string]string)
+	for _, u := range set.URLs {
+		locs[u.Loc] = u.LastMod
+	}
+	for _, want := range []string{srv.URL + "/", srv.URL + "/archive", srv.URL + "/posts/public"} {
+		if _, ok := locs[want]; !ok {
+			t.Errorf("sitemap missing %s:\n%s", want, body)
+		}
+	}
+	if locs[srv.URL+"/posts/public"] == "" {
+		t.Error("post entry has no lastmod")
+	}
+	if _, ok := locs[srv.URL+"/about"]; ok {
+		t.Error("disabled about page listed in sitemap")
+	}
+	if strings.Contains(body, "Secret") || len(set.URLs) != 3 {
+		t.Errorf("unexpected sitemap entries:\n%s", body)
+	}
+}
+
+func TestSitemapSplitsIntoIndex(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	app.sitemapPageSize = 2
+	for _, title := range []string{"One", "Two", "Three"} {
+		insertTestPost(t, app, title, "<h1>"+title+"</h1>", false)
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal([]byte(getBodyOK(t, srv.URL+"/sitemap.xml")), &index); err != nil {
+		t.Fatalf("parse sitemap index: %v", err)
+	}
+	// Home, archive and three posts make five URLs, so three files
+	if len(index.Sitemaps) != 3 || index.Sitemaps[2].Loc != srv.URL+"/sitemaps/3.xml" {
+		t.Fatalf("unexpected sitemap index: %+v", index.Sitemaps)
+	}
+
+	var last sitemapURLSet
+	if err := xml.Unmarshal([]byte(getBodyOK(t, index.Sitemaps[2].Loc)), &last); err != nil {
+		t.Fatalf("parse sitemap page: %v", err)
+	}
+	if len(last.URLs) != 1 {
+		t.Fatalf("expected one URL on the last page, got %+v", last.URLs)
+	}
+
+	resp, err := http.Get(srv.URL + "/sitemaps/4.xml")
+	if err != nil {
+		t.Fatalf("get missing page: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 past the last page, got %d", resp.StatusCode)
+	}
+}
+
+func TestRobotsTxt(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+
+	app.baseURL = "https://blog.example.com"
+	body := []byte(getBodyOK(t, srv.URL+"/robots.txt"))
+	if !strings.Contains(string(body), "Disallow: /api/") ||
+		!strings.Contains(string(body), "Sitemap: https://blog.example.com/sitemap.xml") {
+		t.Fatalf("unexpected default robots.txt:\n%s", body)
+	}
+
+	app.baseURL = ""
+	custom := "User-agent: *\nDisallow: /drafts\n"
+	app.DB.Exec(`INSERT INTO settings(key, value, updated_at) VALUES('robotsTxt', ?, CURRENT_TIMESTAMP)`, custom)
+	body = []byte(getBodyOK(t, srv.URL+"/robots.txt"))
+	if !strings.HasPrefix(string(body), custom) || strings.Contains(string(body), "/api/") ||
+		!strings.Contains(string(body), "Sitemap: "+srv.URL+"/sitemap.xml") {
+		t.Fatalf("custom robots.txt not served:\n%s", body)
+	}
+}
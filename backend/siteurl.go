@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// siteURLSettingKey stores the public base URL when NOET_BASE_URL is unset
+const siteURLSettingKey = "site_url"
+
+// normalizeBaseURL validates a public base URL and returns it as a bare
+// origin without a trailing slash, e.g. "https://blog.example.com"
+func normalizeBaseURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("value must be an http(s) URL such as https://example.com")
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.Trim(u.Path, "/") != "" {
+		return "", fmt.Errorf("value must be a bare origin without path, query or credentials")
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host), nil
+}
+
+// parseTrustedProxies parses a comma separated list of IP addresses and CIDR
+// ranges whose X-Forwarded-* headers may be believed
+func parseTrustedProxies(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %v", field, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", field, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// loadSiteURLConfig reads NOET_BASE_URL and NOET_TRUSTED_PROXIES
+func (a *App) loadSiteURLConfig() error {
+	base, err := normalizeBaseURL(os.Getenv("NOET_BASE_URL"))
+	if err != nil {
+		return fmt.Errorf("invalid NOET_BASE_URL: %v", err)
+	}
+	proxies, err := parseTrustedProxies(os.Getenv("NOET_TRUSTED_PROXIES"))
+	if err != nil {
+		return fmt.Errorf("invalid NOET_TRUSTED_PROXIES: %v", err)
+	}
+	a.baseURL = base
+	a.trustedProxies = proxies
+	return nil
+}
+
+// isTrustedProxy reports whether the request arrived directly from a
+// configured reverse proxy
+func (a *App) isTrustedProxy(r *http.Request) bool {
+	if len(a.trustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return a.isTrustedAddr(addr.Unmap())
+}
+
+// isTrustedAddr reports whether addr belongs to a configured reverse proxy
+func (a *App) isTrustedAddr(addr netip.Addr) bool {
+	for _, prefix := range a.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client. Behind trusted proxies it is
+// the right-most X-Forwarded-For entry that is not itself a trusted proxy.
+func (a *App) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !a.isTrustedProxy(r) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = addr.Unmap()
+		if !a.isTrustedAddr(addr) {
+			return addr.String()
+		}
+		host = addr.String()
+	}
+	return host
+}
+
+// configuredBaseURL returns the operator-configured public base URL:
+// NOET_BASE_URL wins over the site_url setting. It is "" when neither is set.
+func (a *App) configuredBaseURL() string {
+	if a.baseURL != "" {
+		return a.baseURL
+	}
+
+	cacheKey := "setting_" + siteURLSettingKey
+	if cached, ok := a.cacheGet(cacheKey); ok {
+		if base, ok := cached.(string); ok {
+			return base
+		}
+	}
+
+	var raw string
+	_ = a.DB.QueryRow(`SELECT value FROM settings WHERE key = ?`, siteURLSettingKey).Scan(&raw)
+	base, err := normalizeBaseURL(raw)
+	if err != nil {
+		a.Logger.Warn("Ignoring invalid site_url setting", "value", raw, "error", err.Error())
+		base = ""
+	}
+	a.cacheSet(cacheKey, base, 30*time.Second)
+	return base
+}
+
+// firstForwardedValue returns the left-most entry of a forwarded header,
+// which is the value set by the proxy closest to the client
+func firstForwardedValue(v string) string {
+	first, _, _ := strings.Cut(v, ",")
+	return strings.TrimSpace(first)
+}
+
+// requestSiteBase derives the absolute site origin (scheme://host) used for
+// canonical links, feeds and sitemaps. A configured base URL is the single
+// source of truth; otherwise the request is used, and X-Forwarded-Proto /
+// X-Forwarded-Host are only honored when sent by a trusted proxy.
+func (a *App) requestSiteBase(r *http.Request) string {
+	if base := a.configuredBaseURL(); base != "" {
+		return base
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if a.isTrustedProxy(r) {
+		if proto := strings.ToLower(firstForwardedValue(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost := firstForwardedValue(r.Header.Get("X-Forwarded-Host")); fwdHost != "" && !strings.ContainsAny(fwdHost, "/\\@ ") {
+			host = fwdHost
+		}
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s", scheme, host)
+}
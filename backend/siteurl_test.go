@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeBaseURL(t *testing.T) {
+	valid := map[string]string{
+		"":                          "",
+		"https://Blog.Example.com/": "https://blog.example.com",
+		" http://localhost:8081 ":   "http://localhost:8081",
+	}
+	for in, want := range valid {
+		got, err := normalizeBaseURL(in)
+		if err != nil || got != want {
+			t.Errorf("normalizeBaseURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"blog.example.com", "ftp://example.com", "https://example.com/blog", "https://u:p@example.com", "https://example.com/?x=1"} {
+		if _, err := normalizeBaseURL(in); err == nil {
+			t.Errorf("normalizeBaseURL(%q) should fail", in)
+		}
+	}
+}
+
+func TestRequestSiteBaseForwardedHeaders(t *testing.T) {
+	app := newTestApp(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "noet.internal:8081"
+	req.RemoteAddr = "10.0.0.5:40000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "evil.example")
+
+	if got := app.requestSiteBase(req); got != "http://noet.internal:8081" {
+		t.Fatalf("untrusted forwarded headers honored: %s", got)
+	}
+
+	proxies, err := parseTrustedProxies("127.0.0.1, 10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("parse proxies: %v", err)
+	}
+	app.trustedProxies = proxies
+	if got := app.requestSiteBase(req); got != "https://evil.example" {
+		t.Fatalf("trusted proxy headers ignored: %s", got)
+	}
+
+	// A configured site_url overrides whatever the request says
+	if _, err := app.DB.Exec(`INSERT INTO settings(key, value, updated_at) VALUES('site_url', 'https://blog.example.com', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("insert setting: %v", err)
+	}
+	app.cacheDelete("setting_site_url")
+	if got := app.requestSiteBase(req); got != "https://blog.example.com" {
+		t.Fatalf("site_url setting not used: %s", got)
+	}
+
+	app.baseURL = "https://env.example.com"
+	if got := app.requestSiteBase(req); got != "https://env.example.com" {
+		t.Fatalf("NOET_BASE_URL should win over site_url: %s", got)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// slugMaxLength bounds generated slugs so URLs stay readable
+const slugMaxLength = 80
+
+var (
+	errSlugTaken   = errors.New("slug already in use")
+	errSlugInvalid = errors.New("slug must contain at least one letter or digit")
+)
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx
+type sqlQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// slugify turns a title into a lowercase, hyphen-separated URL segment.
+// Purely numeric results are prefixed so they never shadow post IDs.
+func slugify(title string) string {
+	slug := slugSegment(title, slugMaxLength)
+	if slug != "" && isNumericRef(slug) {
+		slug = "post-" + slug
+	}
+	return slug
+}
+
+// slugSegment lowercases s into hyphen-separated runs of letters and digits
+// no longer than maxLen bytes
+func slugSegment(s string, maxLen int) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+		case r == '\'' || r == '’':
+			// Drop apostrophes so "don't" becomes "dont"
+		default:
+			pendingHyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > maxLen {
+		slug = slug[:maxLen]
+		// Avoid cutting through a multi-byte rune or leaving a trailing hyphen
+		for len(slug) > 0 && !isSlugBoundary(slug) {
+			slug = slug[:len(slug)-1]
+		}
+		slug = strings.TrimRight(slug, "-")
+	}
+	return slug
+}
+
+func isSlugBoundary(s string) bool {
+	return strings.ToValidUTF8(s, "") == s
+}
+
+func isNumericRef(ref string) bool {
+	_, err := strconv.ParseInt(ref, 10, 64)
+	return err == nil
+}
+
+// postPath returns the canonical site-relative URL of a post
+func postPath(p Post) string {
+	if p.Slug != "" {
+		return "/posts/" + p.Slug
+	}
+	return fmt.Sprintf("/posts/%d", p.ID)
+}
+
+// slugOwner returns the post that currently owns a slug, either as its live
+// slug or as a redirect left behind by a rename
+func slugOwner(q sqlQueryer, slug string) (postID int64, redirect bool, err error) {
+	err = q.QueryRow(`SELECT id FROM posts WHERE slug = ?`, slug).Scan(&postID)
+	if err == nil {
+		return postID, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+	err = q.QueryRow(`SELECT post_id FROM post_slug_redirects WHERE slug = ?`, slug).Scan(&postID)
+	if err != nil {
+		return 0, false, err
+	}
+	return postID, true, nil
+}
+
+// uniquePostSlug derives a slug from base that no other post uses, appending
+// a numeric suffix on collision
+func uniquePostSlug(q sqlQueryer, base string, postID int64) (string, error) {
+	if base == "" {
+		return "", nil
+	}
+	candidate := base
+	for n := 2; ; n++ {
+		owner, _, err := slugOwner(q, candidate)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && owner == postID) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		suffix := fmt.Sprintf("-%d", n)
+		trimmed := base
+		if len(trimmed)+len(suffix) > slugMaxLength {
+			trimmed = strings.TrimRight(trimmed[:slugMaxLength-len(suffix)], "-")
+		}
+		candidate = trimmed + suffix
+	}
+}
+
+// setPostSlug changes a post's slug. When keepRedirect is set the previous
+// slug keeps pointing at the post so shared links answer with a 301.
+func (a *App) setPostSlug(postID int64, oldSlug, newSlug string, keepRedirect bool) error {
+	if oldSlug == newSlug {
+		return nil
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	var slugValue any
+	if newSlug != "" {
+		slugValue = newSlug
+		// The post may be reclaiming one of its own previous slugs
+		if _, err := tx.Exec(`DELETE FROM post_slug_redirects WHERE slug = ? AND post_id = ?`, newSlug, postID); err != nil {
+			return fmt.Errorf("failed to clear redirect: %v", err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE posts SET slug = ? WHERE id = ?`, slugValue, postID); err != nil {
+		return fmt.Errorf("failed to update slug: %v", err)
+	}
+	if keepRedirect && oldSlug != "" {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO post_slug_redirects (slug, post_id, created_at) VALUES (?, ?, ?)`,
+			oldSlug, postID, time.Now()); err != nil {
+			return fmt.Errorf("failed to store slug redirect: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// requestedSlug validates a slug supplied through the API for a post
+func (a *App) requestedSlug(postID int64, raw string) (string, error) {
+	slug := slugify(raw)
+	if slug == "" {
+		return "", errSlugInvalid
+	}
+	owner, _, err := slugOwner(a.DB, slug)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return slug, nil
+	case err != nil:
+		return "", err
+	case owner != postID:
+		return "", errSlugTaken
+	}
+	return slug, nil
+}
+
+// ensurePostSlug gives a titled post a slug if it does not have one yet
+func (a *App) ensurePostSlug(p Post) (string, error) {
+	if p.Slug != "" || p.Title == nil {
+		return p.Slug, nil
+	}
+	slug, err := uniquePostSlug(a.DB, slugify(*p.Title), p.ID)
+	if err != nil || slug == "" {
+		return "", err
+	}
+	if err := a.setPostSlug(p.ID, "", slug, false); err != nil {
+		return "", err
+	}
+	return slug, nil
+}
+
+// resolvePostRef looks a post up by numeric ID, current slug or a previous
+// slug. redirected reports that ref is an old slug of the returned post.
+func (a *App) resolvePostRef(ref string) (p Post, redirected bool, err error) {
+	if isNumericRef(ref) {
+		p, err = a.getPost(ref)
+		return p, false, err
+	}
+
+	postID, redirected, err := slugOwner(a.DB, ref)
+	if err != nil {
+		return Post{}, false, err
+	}
+	p, err = a.getPost(strconv.FormatInt(postID, 10))
+	return p, redirected, err
+}
+
+// resolvePostIDRef maps the leading post reference of an API path to the
+// numeric ID so handlers can keep working with IDs
+func (a *App) resolvePostIDRef(path string) (string, error) {
+	ref, rest, hasRest := strings.Cut(path, "/")
+	if isNumericRef(ref) {
+		return path, nil
+	}
+	postID, _, err := slugOwner(a.DB, ref)
+	if err != nil {
+		return "", err
+	}
+	resolved := strconv.FormatInt(postID, 10)
+	if hasRest {
+		resolved += "/" + rest
+	}
+	return resolved, nil
+}
+
+var (
+	mentionSlugRegex        = regexp.MustCompile(`<a[^>]*class="[^"]*mention[^"]*"[^>]*href="/posts/([^"/?#]+)"[^>]*>`)
+	mentionSlugReverseRegex = regexp.MustCompile(`<a[^>]*href="/posts/([^"/?#]+)"[^>]*class="[^"]*mention[^"]*"[^>]*>`)
+)
+
+// extractMentionSlugsFromHTML returns slugs referenced by mention links that
+// point at /posts/{slug} rather than a numeric ID
+func extractMentionSlugsFromHTML(htmlStr string) []string {
+	var slugs []string
+	seen := make(map[string]bool)
+	for _, re := range []*regexp.Regexp{mentionSlugRegex, mentionSlugReverseRegex} {
+		for _, match := range re.FindAllStringSubmatch(htmlStr, -1) {
+			if len(match) < 2 || isNumericRef(match[1]) || seen[match[1]] {
+				continue
+			}
+			seen[match[1]] = true
+			slugs = append(slugs, match[1])
+		}
+	}
+	return slugs
+}
+
+// backfillPostSlugs assigns slugs to titled posts created before slugs existed
+func backfillPostSlugs(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, title FROM posts WHERE slug IS NULL AND title IS NOT NULL AND title != '' ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to query posts for slug backfill: %v", err)
+	}
+	type pending struct {
+		id    int64
+		title string
+	}
+	var posts []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.title); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan post for slug backfill: %v", err)
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		slug, err := uniquePostSlug(db, slugify(p.title), p.id)
+		if err != nil {
+			return err
+		}
+		if slug == "" {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE posts SET slug = ? WHERE id = ?`, slug, p.id); err != nil {
+			return fmt.Errorf("failed to backfill slug for post %d: %v", p.id, err)
+		}
+	}
+
+	if len(posts) > 0 {
+		fmt.Printf("Migration: Backfilled slugs for %d posts\n", len(posts))
+	}
+	return nil
+}
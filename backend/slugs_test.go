@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Hello, World!":         "hello-world",
+		"  Don't Panic  ":       "dont-panic",
+		"Ünïcode Títles":        "ünïcode-títles",
+		"2024":                  "post-2024",
+		"---":                   "",
+		"Systems & Quiet Craft": "systems-quiet-craft",
+	}
+	for in, want := range cases {
+		if got := slugify(in); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := slugify(strings.Repeat("word ", 40)); len(got) > slugMaxLength || strings.HasSuffix(got, "-") {
+		t.Errorf("long slug not trimmed cleanly: %q", got)
+	}
+}
+
+func TestSlugRenameRedirects(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	id := insertTestPost(t, app, "First Title", "<h1>First Title</h1><p>Body</p>", false)
+	title := "First Title"
+	if _, err := app.ensurePostSlug(Post{ID: id, Title: &title}); err != nil {
+		t.Fatalf("ensure slug: %v", err)
+	}
+
+	put := func(body string) (*http.Response, Post) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/posts/first-title", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("put post: %v", err)
+		}
+		defer resp.Body.Close()
+		var p Post
+		if resp.StatusCode == http.StatusOK {
+			_ = json.NewDecoder(resp.Body).Decode(&p)
+		}
+		return resp, p
+	}
+
+	resp, updated := put(`{"slug":"Better Title"}`)
+	if resp.StatusCode != http.StatusOK || updated.Slug != "better-title" {
+		t.Fatalf("rename: status %d slug %q", resp.StatusCode, updated.Slug)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(srv.URL + "/posts/first-title")
+	if err != nil {
+		t.Fatalf("get old slug: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/posts/better-title" {
+		t.Fatalf("expected 301 to new slug, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	for _, path := range []string{"/posts/better-title", "/posts/" + itoa(id)} {
+		resp, err = client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+		}
+	}
+
+	other := insertTestPost(t, app, "Other", "<h1>Other</h1>", false)
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/posts/"+itoa(other), strings.NewReader(`{"slug":"better-title"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("put conflicting slug: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for taken slug, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var errBlobNotFound = errors.New("blob not found")
+
+// blobInfo describes a stored blob
+type blobInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+// blobStore keeps uploaded files. Keys are attachment filenames.
+type blobStore interface {
+	// Put stores a blob and returns the number of bytes written
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (int64, error)
+	// Get opens a blob for streaming; the reader may also be an io.Seeker
+	Get(ctx context.Context, key string) (io.ReadCloser, blobInfo, error)
+	// Delete removes a blob; missing blobs are not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// blobRedirecter is implemented by stores whose blobs clients can fetch
+// directly. An empty URL means the blob has to be streamed instead.
+type blobRedirecter interface {
+	RedirectURL(key string) (string, error)
+}
+
+// validBlobKey rejects keys that could escape the store
+func validBlobKey(key string) bool {
+	return key != "" && key != "." && key != ".." && !strings.ContainsAny(key, `/\`) && !strings.ContainsRune(key, 0)
+}
+
+// localStore keeps blobs as files in one directory
+type localStore struct {
+	dir string
+}
+
+func newLocalStore(dir string) (*localStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create uploads directory: %v", err)
+	}
+	return &localStore{dir: dir}, nil
+}
+
+// Put writes to a temporary file first so readers never see partial files
+func (s *localStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (int64, error) {
+	if !validBlobKey(key) {
+		return 0, fmt.Errorf("invalid blob key %q", key)
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	n, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to save file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, key)); err != nil {
+		return 0, fmt.Errorf("failed to save file: %v", err)
+	}
+	return n, nil
+}
+
+func (s *localStore) Get(ctx context.Context, key string) (io.ReadCloser, blobInfo, error) {
+	if !validBlobKey(key) {
+		return nil, blobInfo{}, errBlobNotFound
+	}
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, blobInfo{}, errBlobNotFound
+	}
+	if err != nil {
+		return nil, blobInfo{}, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, blobInfo{}, err
+	}
+	return f, blobInfo{size: st.Size(), modTime: st.ModTime()}, nil
+}
+
+func (s *localStore) Delete(ctx context.Context, key string) error {
+	if !validBlobKey(key) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// loadBlobStore configures upload storage from NOET_STORAGE: "local" (the
+// default) keeps files in NOET_UPLOADS_DIR, "s3" in an S3-compatible bucket
+func (a *App) loadBlobStore(dbPath string) error {
+	switch kind := strings.ToLower(strings.TrimSpace(os.Getenv("NOET_STORAGE"))); kind {
+	case "", "local":
+		dir, err := a.uploadsDir(dbPath)
+		if err != nil {
+			return err
+		}
+		store, err := newLocalStore(dir)
+		if err != nil {
+			return err
+		}
+		a.blobs = store
+	case "s3":
+		store, err := newS3StoreFromEnv()
+		if err != nil {
+			return err
+		}
+		a.blobs = store
+	default:
+		return fmt.Errorf("invalid NOET_STORAGE %q: must be local or s3", kind)
+	}
+	return nil
+}
+
+// uploadsDir returns NOET_UPLOADS_DIR, defaulting to an uploads directory
+// next to the database. Older versions used ./uploads in the working
+// directory; it is kept when it holds files and the new location does not.
+func (a *App) uploadsDir(dbPath string) (string, error) {
+	if dir := strings.TrimSpace(os.Getenv("NOET_UPLOADS_DIR")); dir != "" {
+		return filepath.Abs(dir)
+	}
+	dir, err := filepath.Abs(filepath.Join(filepath.Dir(dbPath), "uploads"))
+	if err != nil {
+		return "", err
+	}
+	legacy, err := filepath.Abs("uploads")
+	if err != nil || legacy == dir {
+		return dir, nil
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if entries, err := os.ReadDir(legacy); err == nil && len(entries) > 0 {
+			a.Logger.Warn("Using uploads directory in the working directory; move it next to the database or set NOET_UPLOADS_DIR",
+				"dir", legacy, "expected", dir)
+			return legacy, nil
+		}
+	}
+	return dir, nil
+}
+
+// serveBlob sends an upload to the client, redirecting when the store
+// serves blobs directly and streaming otherwise
+func (a *App) serveBlob(w http.ResponseWriter, r *http.Request, key string) {
+	if rd, ok := a.blobs.(blobRedirecter); ok {
+		target, err := rd.RedirectURL(key)
+		if err != nil {
+			a.Logger.Error("Failed to sign upload URL", "filename", key, "error", err.Error())
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+		if target != "" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+	}
+
+	body, info, err := a.blobs.Get(r.Context(), key)
+	if errors.Is(err, errBlobNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		a.Logger.Error("Failed to read upload", "filename", key, "error", err.Error())
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	// Seekable blobs get range and conditional request support
+	if rs, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, info.modTime, rs)
+		return
+	}
+	if !info.modTime.IsZero() {
+		w.Header().Set("Last-Modified", info.modTime.UTC().Format(http.TimeFormat))
+	}
+	if info.size >= 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(info.size))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		a.Logger.Debug("Upload stream interrupted", "filename", key, "error", err.Error())
+	}
+}
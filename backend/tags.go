@@ -0,0 +1,395 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// tagMaxLength bounds normalized tag names
+	tagMaxLength = 64
+	// tagMaxPerPost limits explicit tags supplied through the API
+	tagMaxPerPost = 32
+
+	tagSourceExplicit = "explicit"
+	tagSourceContent  = "content"
+)
+
+var errTooManyTags = fmt.Errorf("a post can have at most %d tags", tagMaxPerPost)
+
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+var (
+	// Hashtag nodes carry their tag in a data attribute...
+	hashtagAttrRegex = regexp.MustCompile(`<(?:a|span)\b[^>]*\bdata-(?:hashtag|tag)="([^"]+)"[^>]*>`)
+	// ...or as "#name" text inside an element with the hashtag class
+	hashtagNodeRegex = regexp.MustCompile(`<(?:a|span)\b[^>]*\bclass="[^"]*\bhashtag\b[^"]*"[^>]*>\s*#([^<]+?)\s*</(?:a|span)>`)
+	// Whole hashtag nodes and code, whose text is not read for plain hashtags
+	hashtagElementRegex = regexp.MustCompile(`(?is)<(?:a|span)\b[^>]*\b(?:data-(?:hashtag|tag)="[^"]*"|class="[^"]*\bhashtag\b[^"]*")[^>]*>.*?</(?:a|span)>`)
+	codeElementRegex    = regexp.MustCompile(`(?is)<(?:pre|code)\b.*?</(?:pre|code)>`)
+	// Plain hashtags typed in the editor: "#" starting a word, then a letter
+	plainHashtagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])#(\p{L}[\p{L}\p{N}_-]*)`)
+)
+
+// normalizeTag maps user input such as "#Go Lang" to its canonical name
+// ("go-lang"). It returns "" when nothing usable remains.
+func normalizeTag(raw string) string {
+	return slugSegment(strings.TrimLeft(strings.TrimSpace(raw), "#"), tagMaxLength)
+}
+
+// normalizeTags normalizes and de-duplicates a list of tags, keeping order
+func normalizeTags(raw []string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, r := range raw {
+		tag := normalizeTag(r)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// extractTagsFromHTML extracts hashtag nodes and plain "#word" hashtags
+// from HTML content, skipping code and URLs.
+// Returns normalized tag names, hashtag nodes first
+func extractTagsFromHTML(htmlStr string) []string {
+	var raw []string
+	for _, re := range []*regexp.Regexp{hashtagAttrRegex, hashtagNodeRegex} {
+		for _, match := range re.FindAllStringSubmatch(htmlStr, -1) {
+			if len(match) > 1 {
+				raw = append(raw, html.UnescapeString(match[1]))
+			}
+		}
+	}
+
+	text := hashtagElementRegex.ReplaceAllString(htmlStr, " ")
+	text = codeElementRegex.ReplaceAllString(text, " ")
+	for _, word := range strings.Fields(searchableText(text)) {
+		// Fragments such as example.com/#section are not tags
+		if strings.Contains(word, "://") || strings.HasPrefix(strings.ToLower(word), "www.") {
+			continue
+		}
+		for _, match := range plainHashtagRegex.FindAllStringSubmatch(word, -1) {
+			raw = append(raw, match[1])
+		}
+	}
+	return normalizeTags(raw)
+}
+
+// replacePostTags swaps the tags a post gets from one source (explicit API
+// input or content hashtags) and drops tags no post uses anymore
+func replacePostTags(db *sql.DB, postID int64, source string, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if _, err := tx.Exec(`DELETE FROM post_tags WHERE post_id = ? AND source = ?`, postID, source); err != nil {
+		return fmt.Errorf("failed to delete existing tags: %v", err)
+	}
+
+	now := time.Now()
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name, created_at) VALUES (?, ?)`, tag, now); err != nil {
+			return fmt.Errorf("failed to insert tag: %v", err)
+		}
+		if _, err := tx.Exec(`
+            INSERT OR IGNORE INTO post_tags (post_id, tag_id, source)
+            SELECT ?, id, ? FROM tags WHERE name = ?
+        `, postID, source, tag); err != nil {
+			return fmt.Errorf("failed to tag post: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM post_tags)`); err != nil {
+		return fmt.Errorf("failed to prune unused tags: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// updateContentTags re-derives a post's hashtag tags from its content
+func (a *App) updateContentTags(postID int64, htmlContent string) error {
+	return replacePostTags(a.DB, postID, tagSourceContent, extractTagsFromHTML(htmlContent))
+}
+
+// setExplicitTags replaces the tags assigned to a post through the API
+func (a *App) setExplicitTags(postID int64, raw []string) error {
+	tags := normalizeTags(raw)
+	if len(tags) > tagMaxPerPost {
+		return errTooManyTags
+	}
+	return replacePostTags(a.DB, postID, tagSourceExplicit, tags)
+}
+
+// getPostTags returns the tag names of a post from any source
+func (a *App) getPostTags(postID int64) ([]string, error) {
+	rows, err := a.DB.Query(`
+        SELECT DISTINCT t.name FROM post_tags pt
+        JOIN tags t ON t.id = pt.tag_id
+        WHERE pt.post_id = ?
+        ORDER BY t.name
+    `, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// attachPostTags fills in Tags for a list of posts with a single query
+func (a *App) attachPostTags(posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	rows, err := a.DB.Query(`
+        SELECT DISTINCT pt.post_id, t.name FROM post_tags pt
+        JOIN tags t ON t.id = pt.tag_id
+        ORDER BY t.name
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byPost := make(map[int64][]string)
+	for rows.Next() {
+		var postID int64
+		var tag string
+		if err := rows.Scan(&postID, &tag); err != nil {
+			return err
+		}
+		byPost[postID] = append(byPost[postID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Tags = byPost[posts[i].ID]
+	}
+	return nil
+}
+
+// getPostsByTag lists posts carrying a tag, honouring privacy like
+// getPostsWithPrivacy
+func (a *App) getPostsByTag(tag string, isAuthenticated bool) ([]Post, error) {
+	order := publicPostOrder
+	if isAuthenticated {
+		order = `ORDER BY updated_at DESC, created_at DESC`
+	}
+	rows, err := a.DB.Query(`
+        SELECT `+postColumns+` FROM posts
+        WHERE (? OR is_private = 0)
+          AND id IN (
+            SELECT pt.post_id FROM post_tags pt
+            JOIN tags t ON t.id = pt.tag_id
+            WHERE t.name = ?
+          )
+        `+order, isAuthenticated, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := a.attachPostTags(posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// getTagCounts returns every tag with the number of posts visible to the
+// caller, most used first
+func (a *App) getTagCounts(isAuthenticated bool) ([]TagCount, error) {
+	rows, err := a.DB.Query(`
+        SELECT t.name, COUNT(DISTINCT pt.post_id) AS post_count
+        FROM tags t
+        JOIN post_tags pt ON pt.tag_id = t.id
+        JOIN posts p ON p.id = pt.post_id
+        WHERE (? OR p.is_private = 0)
+        GROUP BY t.id
+        ORDER BY post_count DESC, t.name
+    `, isAuthenticated)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Name, &tc.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, tc)
+	}
+	return counts, rows.Err()
+}
+
+// tagPath returns the site-relative URL of a tag page
+func tagPath(tag string) string {
+	return "/tags/" + tag
+}
+
+func (a *App) handleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	counts, err := a.getTagCounts(a.isAuthenticated(r))
+	if err != nil {
+		a.Logger.Error("Failed to load tag counts", "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(counts)
+}
+
+// handleTagFeed serves the RSS feed of public posts carrying a tag
+func (a *App) handleTagFeed(w http.ResponseWriter, r *http.Request) {
+	tag := normalizeTag(r.PathValue("tag"))
+	if tag == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	posts, err := a.getPostsByTag(tag, false)
+	if err != nil {
+		a.Logger.Error("Failed to load tagged posts", "tag", tag, "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	// Unknown tags are a 404 rather than an empty feed
+	if len(posts) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	load := func() (feedSource, error) {
+		src, err := a.newFeedSource(posts)
+		if err != nil {
+			return feedSource{}, err
+		}
+		src.title = tagFeedTitle(src.settings.SiteTitle, tag)
+		src.homePath = tagPath(tag)
+		src.rssPath = tagPath(tag) + "/rss.xml"
+		return src, nil
+	}
+	a.serveFeed(w, r, "application/rss+xml; charset=utf-8", load, a.buildRSSFeed)
+}
+
+func tagFeedTitle(siteTitle, tag string) string {
+	return buildPageTitle("#"+tag, strings.TrimSpace(siteTitle))
+}
+
+// populateExistingPostTags derives hashtag tags for posts written before
+// tags existed
+func populateExistingPostTags(db *sql.DB) error {
+	rows, err := db.Query(`
+        SELECT id, content FROM posts
+        WHERE content LIKE '%#%'
+          AND id NOT IN (SELECT post_id FROM post_tags)
+    `)
+	if err != nil {
+		return fmt.Errorf("failed to query posts for tags: %v", err)
+	}
+	type pending struct {
+		id      int64
+		content string
+	}
+	var posts []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.content); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan post for tags: %v", err)
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		if err := replacePostTags(db, p.id, tagSourceContent, extractTagsFromHTML(p.content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderTagPage lists the public posts carrying a tag. Non-canonical
+// spellings redirect to the normalized tag URL.
+func (a *App) renderTagPage(ref, currentURL, siteBase string) (pageRender, bool, error) {
+	tag := normalizeTag(ref)
+	if tag == "" || strings.Contains(ref, "/") {
+		return pageRender{}, false, nil
+	}
+	if tag != ref {
+		return pageRender{redirect: tagPath(tag)}, true, nil
+	}
+
+	posts, err := a.getPostsByTag(tag, false)
+	if err != nil {
+		return pageRender{}, false, err
+	}
+	if len(posts) == 0 {
+		return pageRender{}, false, nil
+	}
+
+	settings, err := a.getPublicSettings()
+	if err != nil {
+		return pageRender{}, false, err
+	}
+
+	page, err := a.renderPostListPage(postListPage{
+		heading:  "#" + tag,
+		route:    tagPath(tag),
+		posts:    posts,
+		feedPath: tagPath(tag) + "/rss.xml",
+		feedName: tagFeedTitle(settings.SiteTitle, tag),
+		partial:  true,
+	}, currentURL, siteBase)
+	return page, err == nil, err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractTagsFromHTML(t *testing.T) {
+	content := `<p>Notes on <span class="hashtag">#Go</span> and ` +
+		`<a class="hashtag" data-tag="Systems Design" href="/tags/systems-design">#Systems Design</a> ` +
+		`plus <span data-hashtag="go">#go</span> again. Plain #text counts too.</p>`
+	got := extractTagsFromHTML(content)
+	want := []string{"systems-design", "go", "text"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("extractTagsFromHTML = %v, want %v", got, want)
+	}
+
+	// Hashtags as the editor saves them: plain text, possibly formatted,
+	// but not in code, links' URLs, anchors or numbers
+	content = `<h1>Week notes</h1><p>Learning <strong>#GoLang</strong> and #web_dev (#Rust).</p>` +
+		`<p>See https://example.com/page#section, <a href="/posts/2#intro">example.com/#top</a> and issue #42.</p>` +
+		`<pre><code class="language-bash"># comment #notatag</code></pre><p>Inline <code>#fff</code> and a#b or &amp;#39;</p>`
+	got = extractTagsFromHTML(content)
+	want = []string{"golang", "web-dev", "rust"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("extractTagsFromHTML = %v, want %v", got, want)
+	}
+}
+
+func TestTagsFromContentAndAPI(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	public := insertTestPost(t, app, "Public", "<h1>Public</h1>", false)
+	private := insertTestPost(t, app, "Private", "<h1>Private</h1>", true)
+
+	put := func(id int64, body string) Post {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/posts/"+itoa(id), strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("put post: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("put post status %d", resp.StatusCode)
+		}
+		var p Post
+		_ = json.NewDecoder(resp.Body).Decode(&p)
+		return p
+	}
+
+	p := put(public, `{"content":"<h1>Public</h1><p>Notes on #golang</p>","tags":["Web"]}`)
+	if !reflect.DeepEqual(p.Tags, []string{"golang", "web"}) {
+		t.Fatalf("unexpected tags after update: %v", p.Tags)
+	}
+	put(private, `{"tags":["golang","secret"]}`)
+
+	resp, err := http.Get(srv.URL + "/api/tags")
+	if err != nil {
+		t.Fatalf("get tags: %v", err)
+	}
+	var counts []TagCount
+	_ = json.NewDecoder(resp.Body).Decode(&counts)
+	resp.Body.Close()
+	if !reflect.DeepEqual(counts, []TagCount{{"golang", 1}, {"web", 1}}) {
+		t.Fatalf("unexpected anonymous tag counts: %v", counts)
+	}
+
+	resp, err = http.Get(srv.URL + "/tags/golang")
+	if err != nil {
+		t.Fatalf("get tag page: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "Public") || strings.Contains(string(page), "Private") {
+		t.Fatalf("tag page wrong (status %d): %s", resp.StatusCode, page)
+	}
+
+	resp, err = http.Get(srv.URL + "/tags/golang/rss.xml")
+	if err != nil {
+		t.Fatalf("get tag feed: %v", err)
+	}
+	feed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(feed), "/tags/golang/rss.xml") {
+		t.Fatalf("tag feed wrong (status %d): %s", resp.StatusCode, feed)
+	}
+
+	resp, err = http.Get(srv.URL + "/tags/secret")
+	if err != nil {
+		t.Fatalf("get private tag page: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for tag with only private posts, got %d", resp.StatusCode)
+	}
+}
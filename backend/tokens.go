@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	jwtIssuer   = "noet"
+	jwtAudience = "noet-api"
+
+	defaultAccessTokenTTL = 15 * time.Minute
+	defaultJWTRotation    = 30 * 24 * time.Hour
+	defaultJWTKeyGrace    = 24 * time.Hour
+
+	// jwtKeyReload bounds how long keys rotated by another process go unseen
+	jwtKeyReload = 30 * time.Second
+)
+
+var errUnknownJWTKey = errors.New("unknown signing key")
+
+// tokenConfig controls access token lifetime and signing key rotation
+type tokenConfig struct {
+	accessTTL   time.Duration
+	rotateAfter time.Duration // 0 disables automatic rotation
+	keyGrace    time.Duration // how long retired keys still verify tokens
+}
+
+// jwtKey is an HS256 secret identified by the kid token header
+type jwtKey struct {
+	id        string
+	secret    []byte
+	createdAt time.Time
+}
+
+// jwtKeyring caches the signing key and the keys that still verify tokens
+type jwtKeyring struct {
+	mu       sync.Mutex
+	current  jwtKey
+	keys     map[string]jwtKey
+	loadedAt time.Time
+}
+
+// parseDurationEnv reads a duration such as "15m" from the environment
+func parseDurationEnv(name string, def time.Duration) (time.Duration, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s: must be a duration such as 15m or 720h", name)
+	}
+	return d, nil
+}
+
+// loadTokenConfig reads NOET_ACCESS_TOKEN_TTL, NOET_JWT_ROTATION and
+// NOET_JWT_KEY_GRACE
+func (a *App) loadTokenConfig() error {
+	cfg := tokenConfig{}
+	var err error
+	if cfg.accessTTL, err = parseDurationEnv("NOET_ACCESS_TOKEN_TTL", defaultAccessTokenTTL); err != nil {
+		return err
+	}
+	if cfg.rotateAfter, err = parseDurationEnv("NOET_JWT_ROTATION", defaultJWTRotation); err != nil {
+		return err
+	}
+	if cfg.keyGrace, err = parseDurationEnv("NOET_JWT_KEY_GRACE", defaultJWTKeyGrace); err != nil {
+		return err
+	}
+	if cfg.accessTTL < time.Minute {
+		return fmt.Errorf("invalid NOET_ACCESS_TOKEN_TTL: must be at least 1m")
+	}
+	// Tokens signed just before a rotation must outlive it
+	if cfg.keyGrace < cfg.accessTTL {
+		return fmt.Errorf("invalid NOET_JWT_KEY_GRACE: must be at least NOET_ACCESS_TOKEN_TTL (%s)", cfg.accessTTL)
+	}
+	a.tokens = cfg
+	return nil
+}
+
+// getOrCreateJWTSecret returns the current signing key, generating a new
+// one when none exists or the current key is older than rotateAfter. A
+// secret from before key rotation existed is adopted as the first key.
+func getOrCreateJWTSecret(db *sql.DB, rotateAfter, grace time.Duration) (jwtKey, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM jwt_keys`).Scan(&count); err != nil {
+		return jwtKey{}, err
+	}
+	if count == 0 {
+		var legacy string
+		err := db.QueryRow(`SELECT value FROM settings WHERE key = 'jwt_secret'`).Scan(&legacy)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return jwtKey{}, err
+		}
+		if legacy != "" {
+			if _, err := db.Exec(`INSERT INTO jwt_keys (kid, secret, created_at) VALUES (?, ?, ?)`,
+				newJWTKeyID(), legacy, time.Now()); err != nil {
+				return jwtKey{}, fmt.Errorf("failed to adopt existing JWT secret: %v", err)
+			}
+			if _, err := db.Exec(`DELETE FROM settings WHERE key = 'jwt_secret'`); err != nil {
+				return jwtKey{}, err
+			}
+		}
+	}
+
+	var key jwtKey
+	var secret string
+	err := db.QueryRow(`SELECT kid, secret, created_at FROM jwt_keys WHERE retired_at IS NULL ORDER BY created_at DESC LIMIT 1`).
+		Scan(&key.id, &secret, &key.createdAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && rotateAfter > 0 && time.Since(key.createdAt) > rotateAfter) {
+		return rotateJWTKey(db, grace)
+	}
+	if err != nil {
+		return jwtKey{}, err
+	}
+	if key.secret, err = base64.StdEncoding.DecodeString(secret); err != nil {
+		return jwtKey{}, fmt.Errorf("failed to decode JWT secret: %v", err)
+	}
+	return key, nil
+}
+
+func newJWTKeyID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// rotateJWTKey retires the current signing key in favour of a new one.
+// Retired keys keep verifying tokens for the grace window, then are pruned.
+func rotateJWTKey(db *sql.DB, grace time.Duration) (jwtKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return jwtKey{}, err
+	}
+	key := jwtKey{id: newJWTKeyID(), secret: secret, createdAt: time.Now()}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return jwtKey{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if _, err := tx.Exec(`UPDATE jwt_keys SET retired_at = ? WHERE retired_at IS NULL`, key.createdAt); err != nil {
+		return jwtKey{}, fmt.Errorf("failed to retire JWT key: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM jwt_keys WHERE retired_at < ?`, key.createdAt.Add(-grace)); err != nil {
+		return jwtKey{}, fmt.Errorf("failed to prune JWT keys: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO jwt_keys (kid, secret, created_at) VALUES (?, ?, ?)`,
+		key.id, base64.StdEncoding.EncodeToString(key.secret), key.createdAt); err != nil {
+		return jwtKey{}, fmt.Errorf("failed to store JWT key: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return jwtKey{}, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return key, nil
+}
+
+// reloadJWTKeys refreshes the keyring from the database; the caller holds
+// a.jwtKeys.mu
+func (a *App) reloadJWTKeys() error {
+	rows, err := a.DB.Query(`
+        SELECT kid, secret, created_at, retired_at IS NULL FROM jwt_keys
+        WHERE retired_at IS NULL OR retired_at > ?
+        ORDER BY created_at DESC`, time.Now().Add(-a.tokens.keyGrace))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current jwtKey
+	keys := make(map[string]jwtKey)
+	for rows.Next() {
+		var key jwtKey
+		var secret string
+		var active bool
+		if err := rows.Scan(&key.id, &secret, &key.createdAt, &active); err != nil {
+			return err
+		}
+		if key.secret, err = base64.StdEncoding.DecodeString(secret); err != nil {
+			return fmt.Errorf("failed to decode JWT secret %s: %v", key.id, err)
+		}
+		keys[key.id] = key
+		if active && current.id == "" {
+			current = key
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current.id == "" {
+		return errors.New("no active JWT signing key")
+	}
+
+	a.jwtKeys.current = current
+	a.jwtKeys.keys = keys
+	a.jwtKeys.loadedAt = time.Now()
+	return nil
+}
+
+// initJWTKeys makes sure a signing key exists and loads the keyring
+func (a *App) initJWTKeys() error {
+	if _, err := getOrCreateJWTSecret(a.DB, a.tokens.rotateAfter, a.tokens.keyGrace); err != nil {
+		return err
+	}
+	a.jwtKeys.mu.Lock()
+	defer a.jwtKeys.mu.Unlock()
+	return a.reloadJWTKeys()
+}
+
+// signingKey returns the key new tokens are signed with, rotating it once
+// it is older than the configured rotation interval
+func (a *App) signingKey() (jwtKey, error) {
+	a.jwtKeys.mu.Lock()
+	defer a.jwtKeys.mu.Unlock()
+
+	if time.Since(a.jwtKeys.loadedAt) > jwtKeyReload {
+		if err := a.reloadJWTKeys(); err != nil {
+			return jwtKey{}, err
+		}
+	}
+	if a.tokens.rotateAfter > 0 && time.Since(a.jwtKeys.current.createdAt) > a.tokens.rotateAfter {
+		key, err := getOrCreateJWTSecret(a.DB, a.tokens.rotateAfter, a.tokens.keyGrace)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		a.Logger.Info("JWT signing key rotated", "kid", key.id)
+		if err := a.reloadJWTKeys(); err != nil {
+			return jwtKey{}, err
+		}
+	}
+	return a.jwtKeys.current, nil
+}
+
+// verificationKey looks up a signing key by ID, reloading the keyring when
+// another process may have rotated it
+func (a *App) verificationKey(kid string) ([]byte, error) {
+	a.jwtKeys.mu.Lock()
+	defer a.jwtKeys.mu.Unlock()
+
+	key, ok := a.jwtKeys.keys[kid]
+	stale := time.Since(a.jwtKeys.loadedAt) > jwtKeyReload
+	// Forged key IDs can trigger at most one reload per second
+	if stale || (!ok && time.Since(a.jwtKeys.loadedAt) > time.Second) {
+		if err := a.reloadJWTKeys(); err != nil {
+			return nil, err
+		}
+		key, ok = a.jwtKeys.keys[kid]
+	}
+	if !ok {
+		return nil, errUnknownJWTKey
+	}
+	return key.secret, nil
+}
+
+// jwtKeyFunc resolves the verification key from the kid header
+func (a *App) jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errUnknownJWTKey
+	}
+	return a.verificationKey(kid)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateJWTRejectsForgedTokens(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	valid := registerTestUser(t, srv.URL)
+
+	parsed, err := app.validateJWT(valid)
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if ttl := parsed.ExpiresAt.Sub(parsed.IssuedAt.Time); ttl != defaultAccessTokenTTL {
+		t.Fatalf("expected %s access tokens, got %s", defaultAccessTokenTTL, ttl)
+	}
+
+	key, err := app.signingKey()
+	if err != nil {
+		t.Fatalf("signing key: %v", err)
+	}
+	sign := func(method jwt.SigningMethod, kid string, mutate func(*Claims)) string {
+		claims := *parsed
+		mutate(&claims)
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		var secret interface{} = key.secret
+		if method == jwt.SigningMethodNone {
+			secret = jwt.UnsafeAllowNoneSignatureType
+		}
+		s, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+	unchanged := func(*Claims) {}
+	forged := map[string]string{
+		"HS512":       sign(jwt.SigningMethodHS512, key.id, unchanged),
+		"unsigned":    sign(jwt.SigningMethodNone, key.id, unchanged),
+		"unknown kid": sign(jwt.SigningMethodHS256, "nope", unchanged),
+		"issuer":      sign(jwt.SigningMethodHS256, key.id, func(c *Claims) { c.Issuer = "elsewhere" }),
+		"audience":    sign(jwt.SigningMethodHS256, key.id, func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }),
+		"expired":     sign(jwt.SigningMethodHS256, key.id, func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }),
+		"no expiry":   sign(jwt.SigningMethodHS256, key.id, func(c *Claims) { c.ExpiresAt = nil }),
+	}
+	for name, token := range forged {
+		if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", token, ""); status != http.StatusUnauthorized {
+			t.Errorf("%s token accepted: %d", name, status)
+		}
+	}
+}
+
+func TestJWTKeyRotationGraceWindow(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	before := registerTestUser(t, srv.URL)
+	oldKey, _ := app.signingKey()
+
+	if err := app.runCommand([]string{"rotate-jwt-key"}, &testWriter{t}); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	// Signing picks the new key up on the next reload
+	app.jwtKeys.loadedAt = time.Time{}
+	newKey, _ := app.signingKey()
+	if newKey.id == oldKey.id {
+		t.Fatal("signing key not rotated")
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", before, ""); status != http.StatusOK {
+		t.Fatalf("token signed with retired key rejected during grace window: %d", status)
+	}
+
+	// Past the grace window the retired key is gone
+	app.DB.Exec(`UPDATE jwt_keys SET retired_at = ? WHERE kid = ?`, time.Now().Add(-2*app.tokens.keyGrace), oldKey.id)
+	app.jwtKeys.loadedAt = time.Time{}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", before, ""); status != http.StatusUnauthorized {
+		t.Fatalf("token signed with expired key accepted: %d", status)
+	}
+}
+
+// testWriter sends command output to the test log
+type testWriter struct{ t *testing.T }
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RFC 6238 parameters understood by every authenticator app
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew accepts codes one step either side of now for clock drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+)
+
+var (
+	errTOTPInvalidCode      = errors.New("invalid authentication code")
+	errTOTPAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	errTOTPNotEnrolled      = errors.New("start two-factor setup first")
+	errTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+	errLoginChallengeFailed = errors.New("login challenge is invalid or has expired")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode computes the HOTP value (RFC 4226) for a time step
+func totpCode(secret []byte, step uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], step)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// verifyTOTP checks code against the steps around now and returns the
+// matching step. Steps at or before lastStep were already used and are
+// rejected, so a code cannot be replayed.
+func verifyTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep || step < 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// otpauthURI builds the key URI that authenticator apps import
+func otpauthURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// normalizeRecoveryCode makes recovery codes case and dash insensitive
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// newRecoveryCodes returns fresh codes formatted as xxxxx-xxxxx
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+	}
+	return codes, nil
+}
+
+// totpState is a user's two-factor configuration
+type totpState struct {
+	secret   []byte
+	enabled  bool
+	lastStep int64
+}
+
+func (a *App) getTOTPState(q sqlExecQueryer, userID int64) (totpState, error) {
+	var st totpState
+	var secret string
+	err := q.QueryRow(`SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?`, userID).
+		Scan(&secret, &st.enabled, &st.lastStep)
+	if err != nil {
+		return st, err
+	}
+	if secret != "" {
+		if st.secret, err = totpEncoding.DecodeString(secret); err != nil {
+			return st, fmt.Errorf("failed to decode TOTP secret: %v", err)
+		}
+	}
+	return st, nil
+}
+
+// beginTOTPEnrollment stores a new pending secret and returns it base32
+// encoded; it only takes effect once confirmed with a code
+func (a *App) beginTOTPEnrollment(userID int64) (string, error) {
+	st, err := a.getTOTPState(a.DB, userID)
+	if err != nil {
+		return "", err
+	}
+	if st.enabled {
+		return "", errTOTPAlreadyEnabled
+	}
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	encoded := totpEncoding.EncodeToString(secret)
+	if _, err := a.DB.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?`, encoded, userID); err != nil {
+		return "", err
+	}
+	return encoded, nil
+}
+
+// replaceRecoveryCodes invalidates a user's recovery codes and issues new ones
+func replaceRecoveryCodes(q sqlExecQueryer, userID int64) ([]string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := q.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, code := range codes {
+		if _, err := q.Exec(`INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, hashInvitationToken(normalizeRecoveryCode(code)), now); err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %v", err)
+		}
+	}
+	return codes, nil
+}
+
+// useTOTPCode verifies a code for an account and records its step
+func (a *App) useTOTPCode(q sqlExecQueryer, userID int64, st totpState, code string) error {
+	step, ok := verifyTOTP(st.secret, code, time.Now(), st.lastStep)
+	if !ok {
+		return errTOTPInvalidCode
+	}
+	_, err := q.Exec(`UPDATE users SET totp_last_step = ? WHERE id = ?`, step, userID)
+	return err
+}
+
+// useRecoveryCode consumes one of a user's recovery codes
+func useRecoveryCode(q sqlExecQueryer, userID int64, code string) error {
+	res, err := q.Exec(`UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		time.Now(), userID, hashInvitationToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTOTPInvalidCode
+	}
+	return nil
+}
+
+// enableTOTP confirms enrollment with a code from the authenticator and
+// returns the recovery codes
+func (a *App) enableTOTP(userID int64, code string) ([]string, error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	st, err := a.getTOTPState(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if st.enabled {
+		return nil, errTOTPAlreadyEnabled
+	}
+	if st.secret == nil {
+		return nil, errTOTPNotEnrolled
+	}
+	if err := a.useTOTPCode(tx, userID, st, code); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE users SET totp_enabled = 1 WHERE id = ?`, userID); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return codes, nil
+}
+
+// disableTOTP turns two-factor authentication off after re-checking the
+// password and a current code or recovery code
+func (a *App) disableTOTP(userID int64, password, code string) error {
+	var hash string
+	if err := a.DB.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, userID).Scan(&hash); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return errWrongPassword
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	st, err := a.getTOTPState(tx, userID)
+	if err != nil {
+		return err
+	}
+	if !st.enabled {
+		return errTOTPNotEnabled
+	}
+	if err := a.useTOTPCode(tx, userID, st, code); err != nil {
+		if err := useRecoveryCode(tx, userID, code); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0 WHERE id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createLoginChallenge records that user passed the password check and
+// returns the token for the second step
+func (a *App) createLoginChallenge(userID int64) (string, error) {
+	token, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, _ = a.DB.Exec(`DELETE FROM login_challenges WHERE expires_at < ?`, now)
+	_, err = a.DB.Exec(`INSERT INTO login_challenges (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		userID, tokenHash, now.Add(loginChallengeTTL), now)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// loginChallengeUsername returns the account a challenge token was issued
+// for, so failed codes count against that username
+func (a *App) loginChallengeUsername(token string) (string, error) {
+	var username string
+	err := a.DB.QueryRow(`SELECT u.username FROM login_challenges c JOIN users u ON u.id = c.user_id WHERE c.token_hash = ?`,
+		hashRefreshToken(token)).Scan(&username)
+	return username, err
+}
+
+// completeLoginChallenge redeems a challenge with a TOTP or recovery code.
+// Each challenge allows a few attempts and succeeds at most once.
+func (a *App) completeLoginChallenge(token, code, recoveryCode string) (*User, error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	var challengeID, userID int64
+	var attempts int
+	var expiresAt time.Time
+	err = tx.QueryRow(`SELECT id, user_id, attempts, expires_at FROM login_challenges WHERE token_hash = ?`,
+		hashRefreshToken(token)).Scan(&challengeID, &userID, &attempts, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (!expiresAt.After(time.Now()) || attempts >= loginChallengeMaxAttempts)) {
+		return nil, errLoginChallengeFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := a.getTOTPState(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if recoveryCode != "" {
+		err = useRecoveryCode(tx, userID, recoveryCode)
+	} else {
+		err = a.useTOTPCode(tx, userID, st, code)
+	}
+	if errors.Is(err, errTOTPInvalidCode) {
+		// Count the failure outside the rolled back transaction
+		tx.Rollback()
+		_, _ = a.DB.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?`, challengeID)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM login_challenges WHERE id = ?`, challengeID); err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := tx.QueryRow(`SELECT id, username, role, created_at FROM users WHERE id = ?`, userID).
+		Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return &user, nil
+}
+
+// writeLoginResponse finishes a password login: accounts with two-factor
+// authentication get a challenge token instead of a session. Failed attempts
+// against the username are only forgiven once the whole login succeeds.
+func (a *App) writeLoginResponse(w http.ResponseWriter, r *http.Request, user *User) {
+	st, err := a.getTOTPState(a.DB, user.ID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !st.enabled {
+		a.limiter.reset(usernameLimitKey(user.Username))
+		a.writeAuthResponse(w, r, user)
+		return
+	}
+
+	challenge, err := a.createLoginChallenge(user.ID)
+	if err != nil {
+		a.Logger.Error("Failed to create login challenge", "userID", user.ID, "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"twoFactorRequired": true,
+		"challengeToken":    challenge,
+		"expiresIn":         int(loginChallengeTTL.Seconds()),
+	})
+}
+
+// writeTOTPError maps two-factor failures to HTTP responses
+func (a *App) writeTOTPError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTOTPInvalidCode), errors.Is(err, errTOTPNotEnrolled):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errTOTPAlreadyEnabled), errors.Is(err, errTOTPNotEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errWrongPassword):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errLoginChallengeFailed):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		a.Logger.Error("Two-factor authentication failed", "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+	}
+}
+
+// handleTOTP reports whether the caller has two-factor authentication on
+func (a *App) handleTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		userID := requestClaims(r).UserID
+		st, err := a.getTOTPState(a.DB, userID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		var remaining int
+		_ = a.DB.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&remaining)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":                st.enabled,
+			"recoveryCodesRemaining": remaining,
+		})
+	})(w, r)
+}
+
+// handleTOTPSetup starts enrollment and returns the secret as an otpauth URI
+func (a *App) handleTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		claims := requestClaims(r)
+		secret, err := a.beginTOTPEnrollment(claims.UserID)
+		if err != nil {
+			a.writeTOTPError(w, err)
+			return
+		}
+
+		issuer := "Noet"
+		if settings, err := a.getPublicSettings(); err == nil && strings.TrimSpace(settings.SiteTitle) != "" {
+			issuer = strings.TrimSpace(settings.SiteTitle)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"secret": secret,
+			"uri":    otpauthURI(issuer, claims.Username, secret),
+		})
+	})(w, r)
+}
+
+// handleTOTPEnable confirms enrollment and returns the recovery codes once
+func (a *App) handleTOTPEnable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		userID := requestClaims(r).UserID
+		codes, err := a.enableTOTP(userID, payload.Code)
+		if err != nil {
+			a.writeTOTPError(w, err)
+			return
+		}
+		a.Logger.Info("Two-factor authentication enabled", "userID", userID)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"recoveryCodes": codes,
+		})
+	})(w, r)
+}
+
+// handleTOTPDisable turns two-factor authentication off
+func (a *App) handleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		userID := requestClaims(r).UserID
+		if err := a.disableTOTP(userID, payload.Password, payload.Code); err != nil {
+			a.writeTOTPError(w, err)
+			return
+		}
+		a.Logger.Info("Two-factor authentication disabled", "userID", userID)
+		w.WriteHeader(http.StatusNoContent)
+	})(w, r)
+}
+
+// handleLoginTOTP is the second login step: it trades a challenge token and
+// a TOTP or recovery code for a session
+func (a *App) handleLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if payload.ChallengeToken == "" {
+		http.Error(w, "challenge token required", http.StatusBadRequest)
+		return
+	}
+
+	// Failures count against the username too, so fresh challenges from new
+	// addresses don't give unlimited guesses
+	limitKeys := []limitKey{ipLimitKey(a.clientIP(r))}
+	username, err := a.loginChallengeUsername(payload.ChallengeToken)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if username != "" {
+		limitKeys = append(limitKeys, usernameLimitKey(username))
+	}
+	if a.throttle(w, limitKeys...) {
+		return
+	}
+
+	user, err := a.completeLoginChallenge(payload.ChallengeToken, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		if errors.Is(err, errTOTPInvalidCode) || errors.Is(err, errLoginChallengeFailed) {
+			a.recordAuthFailure(r, "totp", username, err.Error(), limitKeys[1:]...)
+		}
+		if errors.Is(err, errTOTPInvalidCode) {
+			a.Logger.Info("Two-factor login failed", "error", err.Error())
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		a.writeTOTPError(w, err)
+		return
+	}
+	a.limiter.reset(usernameLimitKey(user.Username))
+	if payload.RecoveryCode != "" {
+		a.Logger.Warn("Recovery code used to log in", "userID", user.ID, "username", user.Username)
+	}
+	a.Logger.Info("Login successful", "username", user.Username, "userID", user.ID)
+	a.writeAuthResponse(w, r, user)
+}
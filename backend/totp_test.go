@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPMatchesRFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		if got := totpCode(secret, uint64(unix/totpPeriod)); got != want {
+			t.Errorf("T=%d: got %s, want %s", unix, got, want)
+		}
+	}
+
+	now := time.Unix(1234567890, 0)
+	if _, ok := verifyTOTP(secret, "005924", now, 0); !ok {
+		t.Error("current code rejected")
+	}
+	if _, ok := verifyTOTP(secret, "005924", now, now.Unix()/totpPeriod); ok {
+		t.Error("replayed code accepted")
+	}
+}
+
+func TestTOTPLogin(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+	clock := time.Now()
+	app.limiter.now = func() time.Time { return clock }
+
+	status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/totp/setup", token, "")
+	var setup struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	_ = json.Unmarshal(body, &setup)
+	if status != http.StatusOK || !strings.HasPrefix(setup.URI, "otpauth://totp/") {
+		t.Fatalf("setup: %d %s", status, body)
+	}
+	if u, _ := url.Parse(setup.URI); u.Query().Get("secret") != setup.Secret {
+		t.Fatalf("URI does not carry the secret: %s", setup.URI)
+	}
+	secret, _ := totpEncoding.DecodeString(setup.Secret)
+	step := time.Now().Unix() / totpPeriod
+	code := totpCode(secret, uint64(step))
+
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/totp/enable", token, `{"code":"000000x"}`); status != http.StatusBadRequest {
+		t.Fatalf("enabled with a bad code: %d", status)
+	}
+	status, body = doJSON(t, http.MethodPost, srv.URL+"/api/auth/totp/enable", token, `{"code":"`+code+`"}`)
+	var enabled struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	_ = json.Unmarshal(body, &enabled)
+	if status != http.StatusOK || len(enabled.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("enable: %d %s", status, body)
+	}
+
+	login := func() string {
+		t.Helper()
+		status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login", "", `{"username":"admin","password":"secret-password"}`)
+		var out struct {
+			Token             string `json:"token"`
+			TwoFactorRequired bool   `json:"twoFactorRequired"`
+			ChallengeToken    string `json:"challengeToken"`
+		}
+		_ = json.Unmarshal(body, &out)
+		if status != http.StatusOK || !out.TwoFactorRequired || out.Token != "" || out.ChallengeToken == "" {
+			t.Fatalf("expected a login challenge: %d %s", status, body)
+		}
+		return out.ChallengeToken
+	}
+	second := func(challenge, field, value string) int {
+		t.Helper()
+		status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login/totp", "",
+			`{"challengeToken":"`+challenge+`","`+field+`":"`+value+`"}`)
+		return status
+	}
+
+	challenge := login()
+	// The code that confirmed enrollment cannot be replayed
+	if status := second(challenge, "code", code); status != http.StatusUnauthorized {
+		t.Fatalf("replayed code accepted: %d", status)
+	}
+	if status := second(challenge, "code", totpCode(secret, uint64(step+1))); status != http.StatusOK {
+		t.Fatalf("valid code rejected: %d", status)
+	}
+	if status := second(challenge, "code", totpCode(secret, uint64(step+1))); status != http.StatusUnauthorized {
+		t.Fatalf("challenge redeemed twice: %d", status)
+	}
+
+	challenge = login()
+	if status := second(challenge, "recoveryCode", strings.ToUpper(enabled.RecoveryCodes[0])); status != http.StatusOK {
+		t.Fatalf("recovery code rejected: %d", status)
+	}
+	challenge = login()
+	if status := second(challenge, "recoveryCode", enabled.RecoveryCodes[0]); status != http.StatusUnauthorized {
+		t.Fatalf("recovery code used twice: %d", status)
+	}
+	// Failed codes also back off the username, so wait between guesses
+	for i := 1; i < loginChallengeMaxAttempts; i++ {
+		clock = clock.Add(time.Minute)
+		second(challenge, "code", "000000")
+	}
+	clock = clock.Add(time.Minute)
+	if status := second(challenge, "recoveryCode", enabled.RecoveryCodes[1]); status != http.StatusUnauthorized {
+		t.Fatalf("challenge usable after too many attempts: %d", status)
+	}
+}
+
+func TestTOTPFailuresCountAgainstUsername(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+	clock := time.Now()
+	app.limiter.now = func() time.Time { return clock }
+
+	_, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/totp/setup", token, "")
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	_ = json.Unmarshal(body, &setup)
+	secret, _ := totpEncoding.DecodeString(setup.Secret)
+	step := time.Now().Unix() / totpPeriod
+	if status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/totp/enable", token,
+		`{"code":"`+totpCode(secret, uint64(step))+`"}`); status != http.StatusOK {
+		t.Fatalf("enable: %d %s", status, body)
+	}
+
+	login := func() (int, string) {
+		t.Helper()
+		status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login", "", `{"username":"admin","password":"secret-password"}`)
+		var out struct {
+			ChallengeToken string `json:"challengeToken"`
+		}
+		_ = json.Unmarshal(body, &out)
+		return status, out.ChallengeToken
+	}
+	second := func(challenge, code string) int {
+		t.Helper()
+		status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login/totp", "",
+			`{"challengeToken":"`+challenge+`","code":"`+code+`"}`)
+		return status
+	}
+
+	// Each password login gets a fresh challenge, but wrong codes add up
+	// against the account
+	for i := 0; i < usernameLimitPolicy.free; i++ {
+		status, challenge := login()
+		if status != http.StatusOK {
+			t.Fatalf("login %d: %d", i+1, status)
+		}
+		if status := second(challenge, "000000"); status != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: %d", i+1, status)
+		}
+	}
+	if status, _ := login(); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the username to back off after wrong codes, got %d", status)
+	}
+
+	// The right password alone doesn't forgive earlier failures
+	clock = clock.Add(2 * time.Second)
+	status, challenge := login()
+	if status != http.StatusOK {
+		t.Fatalf("login after backoff: %d", status)
+	}
+	if status := second(challenge, "000000"); status != http.StatusUnauthorized {
+		t.Fatalf("wrong code: %d", status)
+	}
+	if status, _ := login(); status != http.StatusTooManyRequests {
+		t.Fatalf("password login reset the username limit: %d", status)
+	}
+
+	// A completed login does
+	clock = clock.Add(time.Minute)
+	if _, challenge = login(); second(challenge, totpCode(secret, uint64(step+1))) != http.StatusOK {
+		t.Fatal("valid code rejected")
+	}
+	if status, _ := login(); status != http.StatusOK {
+		t.Fatalf("username still throttled after a full login: %d", status)
+	}
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultUploadMaxSize = 10 << 20
+
+	// uploadFormOverhead allows for multipart headers around the file
+	uploadFormOverhead = 1 << 20
+)
+
+// imageExtensions maps the image types uploads may have to the extension
+// stored files get
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var (
+	errUploadTooLarge    = errors.New("file is too large")
+	errUploadQuotaFull   = errors.New("upload storage quota exceeded")
+	errUploadHasMarkup   = fmt.Errorf("%w: file contains HTML or SVG markup", errInvalidImage)
+	errUploadTypeUnknown = fmt.Errorf("%w: only JPEG, PNG, GIF and WebP images are allowed", errInvalidImage)
+)
+
+// uploadLimits bounds the size of single uploads and of all stored files,
+// originals and variants together. A zero quota means no limit. Unused
+// uploads are garbage collected every gcInterval when it is set.
+type uploadLimits struct {
+	maxFileSize int64
+	quota       int64
+	gcInterval  time.Duration
+	lastGC      time.Time
+}
+
+// loadUploadLimits reads NOET_UPLOAD_MAX_SIZE, NOET_UPLOAD_QUOTA and
+// NOET_UPLOAD_GC_INTERVAL
+func (a *App) loadUploadLimits() error {
+	limits := uploadLimits{maxFileSize: defaultUploadMaxSize}
+	if raw := strings.TrimSpace(os.Getenv("NOET_UPLOAD_MAX_SIZE")); raw != "" {
+		n, err := parseByteSize(raw)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid NOET_UPLOAD_MAX_SIZE: use a size such as 10MB")
+		}
+		limits.maxFileSize = n
+	}
+	if raw := strings.TrimSpace(os.Getenv("NOET_UPLOAD_QUOTA")); raw != "" {
+		n, err := parseByteSize(raw)
+		if err != nil {
+			return fmt.Errorf("invalid NOET_UPLOAD_QUOTA: use a size such as 5GB, or 0 for no limit")
+		}
+		limits.quota = n
+	}
+	if raw := strings.TrimSpace(os.Getenv("NOET_UPLOAD_GC_INTERVAL")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid NOET_UPLOAD_GC_INTERVAL: use a duration such as 24h, or 0 to disable")
+		}
+		limits.gcInterval = d
+	}
+	a.uploadLimits = limits
+	return nil
+}
+
+// parseByteSize parses a byte count with an optional KB, MB or GB suffix
+// (powers of 1024)
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/multiplier {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// formatByteSize renders a byte count for error messages
+func formatByteSize(n int64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", n>>30)
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// markupRegex finds tags a browser would act on if an upload were ever
+// rendered as HTML or SVG. Requiring a delimiter after the name keeps
+// compressed pixel data from matching by chance.
+var markupRegex = regexp.MustCompile(`(?i)<(?:html|!doctype|\?xml|svg|script|body|iframe|object|embed|meta)[\s/>]`)
+
+// sniffImage detects an upload's type from its bytes, ignoring what the
+// client claims, and rejects files that also carry markup
+func sniffImage(data []byte) (string, error) {
+	mimeType := http.DetectContentType(data)
+	if _, ok := imageExtensions[mimeType]; !ok {
+		return "", errUploadTypeUnknown
+	}
+	if markupRegex.Match(data) {
+		return "", errUploadHasMarkup
+	}
+	return mimeType, nil
+}
+
+// storageUsage returns the bytes taken by all uploads and their variants
+func (a *App) storageUsage() (int64, error) {
+	var originals, variants int64
+	err := a.DB.QueryRow(`
+        SELECT COALESCE(SUM(size), 0),
+               COALESCE((SELECT SUM(json_extract(v.value, '$.size')) FROM attachments, json_each(attachments.variants) v), 0)
+        FROM attachments`).Scan(&originals, &variants)
+	return originals + variants, err
+}
+
+// checkUploadQuota fails when storing size more bytes would exceed the quota
+func (a *App) checkUploadQuota(size int64) error {
+	if a.uploadLimits.quota <= 0 {
+		return nil
+	}
+	used, err := a.storageUsage()
+	if err != nil {
+		return fmt.Errorf("failed to check storage usage: %v", err)
+	}
+	if used+size > a.uploadLimits.quota {
+		return fmt.Errorf("%w: %s of %s used", errUploadQuotaFull, formatByteSize(used), formatByteSize(a.uploadLimits.quota))
+	}
+	return nil
+}
+
+// handleUploads lists uploads on GET and stores an uploaded image on POST
+func (a *App) handleUploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		a.handleUploadList(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Protect upload endpoint
+	a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
+		maxSize := a.uploadLimits.maxFileSize
+		tooLarge := fmt.Sprintf("file is too large - the limit is %s", formatByteSize(maxSize))
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+uploadFormOverhead)
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "failed to parse form", http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, handler, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "no file provided", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if handler.Size > maxSize {
+			http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		attachment, err := a.saveAttachment(file, handler.Filename)
+		switch {
+		case errors.Is(err, errUploadTooLarge):
+			http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		case errors.Is(err, errUploadQuotaFull):
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		case errors.Is(err, errInvalidImage):
+			a.Logger.Info("Rejected upload", "filename", handler.Filename,
+				"declaredType", handler.Header.Get("Content-Type"), "reason", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Return attachment info with URL
+		response := map[string]interface{}{
+			"id":           attachment.ID,
+			"filename":     attachment.Filename,
+			"originalName": attachment.OriginalName,
+			"mimeType":     attachment.MimeType,
+			"size":         attachment.Size,
+			"width":        attachment.Width,
+			"height":       attachment.Height,
+			"variants":     attachment.Variants,
+			"url":          fmt.Sprintf("/api/uploads/%s", attachment.Filename),
+			"createdAt":    attachment.CreatedAt,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(response)
+	})(w, r)
+}
+
+// uploadGCGrace keeps new uploads out of garbage collection, since images
+// are uploaded before the post that uses them is saved
+const uploadGCGrace = 24 * time.Hour
+
+// uploadURLRegex finds uploads referenced from HTML or settings, by
+// relative or absolute URL
+var uploadURLRegex = regexp.MustCompile(`/api/uploads/([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// UploadRef is a place an upload is used
+type UploadRef struct {
+	Kind     string `json:"kind"` // post, revision, about, hero, intro or avatar
+	PostID   int64  `json:"postId,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// UploadInfo is an attachment as listed in the upload library
+type UploadInfo struct {
+	*Attachment
+	URL        string      `json:"url"`
+	TotalSize  int64       `json:"totalSize"`
+	References []UploadRef `json:"references"`
+}
+
+// UploadGCReport lists unused uploads and what removing them freed
+type UploadGCReport struct {
+	Orphans    []UploadInfo `json:"orphans"`
+	Removed    int          `json:"removed"`
+	FreedBytes int64        `json:"freedBytes"`
+	DryRun     bool         `json:"dryRun"`
+}
+
+// totalSize counts an attachment together with its variants
+func (att *Attachment) totalSize() int64 {
+	total := att.Size
+	for _, v := range att.Variants {
+		total += v.Size
+	}
+	return total
+}
+
+// uploadReferences scans posts and their revisions, the about page, site
+// settings and author avatars for upload URLs and returns where each file is
+// used. Revisions count so restoring one never brings back broken images.
+func (a *App) uploadReferences() (map[string][]UploadRef, error) {
+	refs := map[string][]UploadRef{}
+	add := func(text string, ref UploadRef) {
+		seen := map[string]bool{}
+		for _, m := range uploadURLRegex.FindAllStringSubmatch(text, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				refs[m[1]] = append(refs[m[1]], ref)
+			}
+		}
+	}
+
+	rows, err := a.DB.Query(`SELECT id, title, content FROM posts WHERE content LIKE '%/api/uploads/%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var title *string
+		var content string
+		if err := rows.Scan(&id, &title, &content); err != nil {
+			return nil, err
+		}
+		add(content, UploadRef{Kind: "post", PostID: id, Title: defaultPostTitle(title, id)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// One reference per post however many of its revisions use a file
+	rows, err = a.DB.Query(`SELECT p.id, p.title, group_concat(r.content, ' ') FROM post_revisions r
+        JOIN posts p ON p.id = r.post_id
+        WHERE r.content LIKE '%/api/uploads/%' GROUP BY p.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var title *string
+		var content string
+		if err := rows.Scan(&id, &title, &content); err != nil {
+			return nil, err
+		}
+		add(content, UploadRef{Kind: "revision", PostID: id, Title: defaultPostTitle(title, id)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	settingKinds := map[string]string{"aboutContent": "about", "heroImage": "hero", "introText": "intro"}
+	rows, err = a.DB.Query(`SELECT key, value FROM settings WHERE key IN ('aboutContent', 'heroImage', 'introText')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		add(value, UploadRef{Kind: settingKinds[key]})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = a.DB.Query(`SELECT username, avatar FROM users WHERE avatar LIKE '%/api/uploads/%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var username, avatar string
+		if err := rows.Scan(&username, &avatar); err != nil {
+			return nil, err
+		}
+		add(avatar, UploadRef{Kind: "avatar", Username: username})
+	}
+	return refs, rows.Err()
+}
+
+// attachmentReferences collects references to an attachment or any of its
+// variants
+func attachmentReferences(refs map[string][]UploadRef, att *Attachment) []UploadRef {
+	out := append([]UploadRef{}, refs[att.Filename]...)
+	for _, v := range att.Variants {
+		out = append(out, refs[v.Filename]...)
+	}
+	return out
+}
+
+func newUploadInfo(att *Attachment, refs map[string][]UploadRef) UploadInfo {
+	return UploadInfo{
+		Attachment: att,
+		URL:        "/api/uploads/" + att.Filename,
+		TotalSize:  att.totalSize(),
+		References: attachmentReferences(refs, att),
+	}
+}
+
+// listAttachments returns attachments newest first, starting below the
+// before ID when it is set
+func (a *App) listAttachments(before int64, limit int) ([]*Attachment, error) {
+	rows, err := a.DB.Query(`SELECT `+attachmentColumns+` FROM attachments
+        WHERE ? = 0 OR id < ? ORDER BY id DESC LIMIT ?`, before, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []*Attachment{}
+	for rows.Next() {
+		att, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, att)
+	}
+	return attachments, rows.Err()
+}
+
+// deleteAttachment removes an attachment's record and then its files, so a
+// failed blob delete leaves an unlisted file rather than a broken image
+func (a *App) deleteAttachment(ctx context.Context, att *Attachment) error {
+	if _, err := a.DB.Exec(`DELETE FROM attachments WHERE id = ?`, att.ID); err != nil {
+		return fmt.Errorf("failed to delete attachment: %v", err)
+	}
+	keys := []string{att.Filename}
+	for _, v := range att.Variants {
+		keys = append(keys, v.Filename)
+	}
+	for _, key := range keys {
+		if err := a.blobs.Delete(ctx, key); err != nil {
+			a.Logger.Error("Failed to delete upload file", "filename", key, "error", err.Error())
+		}
+	}
+	return nil
+}
+
+// collectUploads finds attachments nothing references that are older than
+// the grace period and, unless dryRun is set, deletes them
+func (a *App) collectUploads(ctx context.Context, now time.Time, dryRun bool) (UploadGCReport, error) {
+	report := UploadGCReport{Orphans: []UploadInfo{}, DryRun: dryRun}
+	refs, err := a.uploadReferences()
+	if err != nil {
+		return report, fmt.Errorf("failed to scan upload references: %v", err)
+	}
+	rows, err := a.DB.Query(`SELECT ` + attachmentColumns + ` FROM attachments ORDER BY id`)
+	if err != nil {
+		return report, err
+	}
+	var orphans []*Attachment
+	for rows.Next() {
+		att, err := scanAttachment(rows)
+		if err != nil {
+			rows.Close()
+			return report, err
+		}
+		if len(attachmentReferences(refs, att)) == 0 && now.Sub(att.CreatedAt) >= uploadGCGrace {
+			orphans = append(orphans, att)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	for _, att := range orphans {
+		report.Orphans = append(report.Orphans, newUploadInfo(att, nil))
+		if dryRun {
+			continue
+		}
+		if err := a.deleteAttachment(ctx, att); err != nil {
+			return report, err
+		}
+		report.Removed++
+		report.FreedBytes += att.totalSize()
+	}
+	if report.Removed > 0 {
+		a.Logger.Info("Removed unused uploads", "count", report.Removed, "freedBytes", report.FreedBytes)
+	}
+	return report, nil
+}
+
+// maybeCollectUploads runs garbage collection from the scheduler when
+// NOET_UPLOAD_GC_INTERVAL is set and the interval has passed
+func (a *App) maybeCollectUploads(now time.Time) {
+	if a.uploadLimits.gcInterval <= 0 || now.Sub(a.uploadLimits.lastGC) < a.uploadLimits.gcInterval {
+		return
+	}
+	a.uploadLimits.lastGC = now
+	if _, err := a.collectUploads(context.Background(), now, false); err != nil {
+		a.Logger.Error("Upload garbage collection failed", "error", err)
+	}
+}
+
+// handleUploadList lists uploads with where they are used and the storage
+// used overall
+func (a *App) handleUploadList(w http.ResponseWriter, r *http.Request) {
+	a.requireRole(roleAuthor, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit := 50
+		if raw := q.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, 200)
+		}
+		var before int64
+		if raw := q.Get("before"); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid before", http.StatusBadRequest)
+				return
+			}
+			before = n
+		}
+
+		attachments, err := a.listAttachments(before, limit)
+		if err != nil {
+			a.Logger.Error("Failed to list uploads", "error", err.Error())
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		refs, err := a.uploadReferences()
+		if err != nil {
+			a.Logger.Error("Failed to scan upload references", "error", err.Error())
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		used, err := a.storageUsage()
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		var files int64
+		if err := a.DB.QueryRow(`SELECT COUNT(*) FROM attachments`).Scan(&files); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+
+		uploads := make([]UploadInfo, 0, len(attachments))
+		for _, att := range attachments {
+			uploads = append(uploads, newUploadInfo(att, refs))
+		}
+		response := map[string]interface{}{
+			"uploads": uploads,
+			"usage": map[string]interface{}{
+				"files":       files,
+				"bytes":       used,
+				"quota":       a.uploadLimits.quota,
+				"maxFileSize": a.uploadLimits.maxFileSize,
+			},
+		}
+		if len(attachments) == limit {
+			response["nextBefore"] = attachments[len(attachments)-1].ID
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	})(w, r)
+}
+
+// handleUpload serves an uploaded file or one of its variants, and deletes
+// uploads. Uploads still in use are only deleted with ?force=true.
+func (a *App) handleUpload(w http.ResponseWriter, r *http.Request) {
+	filename := r.PathValue("filename")
+	switch r.Method {
+	case http.MethodGet:
+		// Get attachment metadata; resized variants share their original's
+		attachment, mimeType, err := a.getUpload(filename)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, "database error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", mimeType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", attachment.OriginalName))
+		a.serveBlob(w, r, filename)
+	case http.MethodDelete:
+		a.requireRole(roleEditor, func(w http.ResponseWriter, r *http.Request) {
+			attachment, err := a.getAttachment(filename)
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			if r.URL.Query().Get("force") != "true" {
+				refs, err := a.uploadReferences()
+				if err != nil {
+					http.Error(w, "db error", http.StatusInternalServerError)
+					return
+				}
+				if n := len(attachmentReferences(refs, attachment)); n > 0 {
+					http.Error(w, fmt.Sprintf("upload is still used in %d places; add ?force=true to delete it anyway", n), http.StatusConflict)
+					return
+				}
+			}
+			if err := a.deleteAttachment(r.Context(), attachment); err != nil {
+				a.Logger.Error("Failed to delete upload", "filename", filename, "error", err.Error())
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+			a.Logger.Info("Upload deleted", "filename", filename, "userID", requestClaims(r).UserID)
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUploadsGC reports unused uploads on GET and deletes them on POST
+func (a *App) handleUploadsGC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		report, err := a.collectUploads(r.Context(), time.Now(), r.Method == http.MethodGet)
+		if err != nil {
+			a.Logger.Error("Upload garbage collection failed", "error", err.Error())
+			http.Error(w, "garbage collection failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	})(w, r)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noisyPNG encodes an image that doesn't compress, for size limits
+func noisyPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadsSniffContent(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	// The stored type and extension come from the bytes, not the client
+	data := testPNG(t, 8, 8)
+	status, body := uploadTestFile(t, srv.URL, token, "photo.gif", "image/gif", data)
+	var uploaded Attachment
+	_ = json.Unmarshal(body, &uploaded)
+	if status != http.StatusCreated || uploaded.MimeType != "image/png" || !strings.HasSuffix(uploaded.Filename, ".png") {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	resp, err := http.Get(srv.URL + "/api/uploads/" + uploaded.Filename)
+	if err != nil {
+		t.Fatalf("GET upload: %v", err)
+	}
+	stored, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if int64(len(stored)) != uploaded.Size || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("recorded size %d, served %d bytes", uploaded.Size, len(stored))
+	}
+
+	var polyglot bytes.Buffer
+	pal := image.NewPaletted(image.Rect(0, 0, 2, 2), []color.Color{color.Black, color.White})
+	_ = gif.Encode(&polyglot, pal, nil)
+	polyglot.WriteString("<SCRIPT>alert(1)</SCRIPT>")
+
+	for name, c := range map[string]struct {
+		filename, contentType string
+		data                  []byte
+	}{
+		"svg":       {"logo.png", "image/png", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)},
+		"html":      {"page.jpg", "image/jpeg", []byte("<!DOCTYPE html><html><body>hi</body></html>")},
+		"polyglot":  {"anim.gif", "image/gif", polyglot.Bytes()},
+		"truncated": {"cut.png", "image/png", data[:20]},
+	} {
+		if status, body := uploadTestFile(t, srv.URL, token, c.filename, c.contentType, c.data); status != http.StatusBadRequest {
+			t.Fatalf("%s upload accepted: %d %s", name, status, body)
+		}
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	big := noisyPNG(t, 64, 64)
+	app.uploadLimits.maxFileSize = int64(len(big)) - 1
+	if status, body := uploadTestFile(t, srv.URL, token, "big.png", "image/png", big); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: %d %s", status, body)
+	}
+
+	app.uploadLimits.maxFileSize = defaultUploadMaxSize
+	status, body := uploadTestFile(t, srv.URL, token, "big.png", "image/png", big)
+	if status != http.StatusCreated {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	used, err := app.storageUsage()
+	if err != nil || used == 0 {
+		t.Fatalf("storage usage: %d %v", used, err)
+	}
+	app.uploadLimits.quota = used + 100
+	if status, body := uploadTestFile(t, srv.URL, token, "big.png", "image/png", big); status != http.StatusInsufficientStorage {
+		t.Fatalf("upload over quota: %d %s", status, body)
+	}
+
+	for in, want := range map[string]int64{"512": 512, "10MB": 10 << 20, "1.5GB": -1, "2 kb": 2048, "0": 0, "-1": -1} {
+		got, err := parseByteSize(in)
+		if (want < 0) != (err != nil) || (err == nil && got != want) {
+			t.Fatalf("parseByteSize(%q) = %d, %v", in, got, err)
+		}
+	}
+}
+
+func TestUploadLibraryAndGC(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+	authorToken := createTestAccount(t, app, "writer", roleAuthor)
+
+	upload := func(name string, w int) Attachment {
+		status, body := uploadTestFile(t, srv.URL, token, name, "image/png", testPNG(t, w, 10))
+		var att Attachment
+		if status != http.StatusCreated || json.Unmarshal(body, &att) != nil {
+			t.Fatalf("upload %s: %d %s", name, status, body)
+		}
+		return att
+	}
+	inPost := upload("post.png", 1000)
+	hero := upload("hero.png", 20)
+	orphan := upload("orphan.png", 20)
+	fresh := upload("fresh.png", 20)
+
+	// Posts may reference a resized variant rather than the original
+	insertTestPost(t, app, "Gallery", `<p><img src="/api/uploads/`+inPost.Variants[0].Filename+`"></p>`, true)
+	if _, err := app.DB.Exec(`INSERT INTO settings (key, value, updated_at) VALUES ('heroImage', ?, CURRENT_TIMESTAMP)`,
+		srv.URL+"/api/uploads/"+hero.Filename); err != nil {
+		t.Fatalf("set hero image: %v", err)
+	}
+
+	status, body := doJSON(t, http.MethodGet, srv.URL+"/api/uploads?limit=3", authorToken, "")
+	var list struct {
+		Uploads    []UploadInfo `json:"uploads"`
+		NextBefore int64        `json:"nextBefore"`
+		Usage      struct {
+			Files int64 `json:"files"`
+			Bytes int64 `json:"bytes"`
+		} `json:"usage"`
+	}
+	if status != http.StatusOK || json.Unmarshal(body, &list) != nil {
+		t.Fatalf("list uploads: %d %s", status, body)
+	}
+	if len(list.Uploads) != 3 || list.Uploads[0].Filename != fresh.Filename || list.Usage.Files != 4 || list.Usage.Bytes == 0 {
+		t.Fatalf("unexpected listing: %s", body)
+	}
+	if refs := list.Uploads[2].References; len(refs) != 1 || refs[0].Kind != "hero" {
+		t.Fatalf("hero image reference missing: %+v", list.Uploads[2])
+	}
+	status, body = doJSON(t, http.MethodGet, srv.URL+"/api/uploads?before="+itoa(list.NextBefore), authorToken, "")
+	if status != http.StatusOK || !strings.Contains(string(body), inPost.Filename) || !strings.Contains(string(body), `"kind":"post"`) {
+		t.Fatalf("second page: %d %s", status, body)
+	}
+
+	// Only editors delete, and uploads in use need force
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/uploads/"+orphan.Filename, authorToken, ""); status != http.StatusForbidden {
+		t.Fatalf("author deleted an upload: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/uploads/"+inPost.Filename, token, ""); status != http.StatusConflict {
+		t.Fatalf("upload in use deleted without force: %d", status)
+	}
+
+	// Everything but the fresh upload is past the grace period
+	if _, err := app.DB.Exec(`UPDATE attachments SET created_at = ? WHERE filename != ?`,
+		time.Now().Add(-2*uploadGCGrace), fresh.Filename); err != nil {
+		t.Fatalf("backdate uploads: %v", err)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/uploads/gc", authorToken, ""); status != http.StatusForbidden {
+		t.Fatalf("author ran gc: %d", status)
+	}
+	var report UploadGCReport
+	status, body = doJSON(t, http.MethodGet, srv.URL+"/api/uploads/gc", token, "")
+	if status != http.StatusOK || json.Unmarshal(body, &report) != nil || !report.DryRun ||
+		len(report.Orphans) != 1 || report.Orphans[0].Filename != orphan.Filename || report.Removed != 0 {
+		t.Fatalf("gc dry run: %d %s", status, body)
+	}
+	if _, _, err := app.getUpload(orphan.Filename); err != nil {
+		t.Fatalf("dry run removed the orphan: %v", err)
+	}
+
+	status, body = doJSON(t, http.MethodPost, srv.URL+"/api/uploads/gc", token, "")
+	if status != http.StatusOK || json.Unmarshal(body, &report) != nil || report.Removed != 1 || report.FreedBytes != orphan.Size {
+		t.Fatalf("gc: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/uploads/"+orphan.Filename, "", ""); status != http.StatusNotFound {
+		t.Fatalf("collected upload still served: %d", status)
+	}
+	if _, _, err := app.blobs.Get(context.Background(), orphan.Filename); !errors.Is(err, errBlobNotFound) {
+		t.Fatalf("collected upload file kept: %v", err)
+	}
+
+	// Forced deletes remove the variants too
+	status, body = doJSON(t, http.MethodDelete, srv.URL+"/api/uploads/"+inPost.Filename+"?force=true", token, "")
+	if status != http.StatusNoContent {
+		t.Fatalf("forced delete: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/uploads/"+inPost.Variants[0].Filename, "", ""); status != http.StatusNotFound {
+		t.Fatalf("variant of deleted upload still served: %d", status)
+	}
+}
+
+func TestUploadGCKeepsRevisionImages(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+
+	status, body := uploadTestFile(t, srv.URL, token, "old.png", "image/png", testPNG(t, 20, 10))
+	var att Attachment
+	if status != http.StatusCreated || json.Unmarshal(body, &att) != nil {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	id := insertTestPost(t, app, "Draft", `<p><img src="/api/uploads/`+att.Filename+`"></p>`, true)
+	postURL := srv.URL + "/api/posts/" + itoa(id)
+	// Replacing the content leaves the image only in the baseline revision
+	if status, body := doJSON(t, http.MethodPut, postURL, token, `{"content":"<p>No pictures</p>"}`); status != http.StatusOK {
+		t.Fatalf("update: %d %s", status, body)
+	}
+
+	if _, err := app.DB.Exec(`UPDATE attachments SET created_at = ?`, time.Now().Add(-2*uploadGCGrace)); err != nil {
+		t.Fatalf("backdate uploads: %v", err)
+	}
+	status, body = doJSON(t, http.MethodGet, srv.URL+"/api/uploads", token, "")
+	if status != http.StatusOK || !strings.Contains(string(body), `"kind":"revision"`) {
+		t.Fatalf("revision reference missing: %d %s", status, body)
+	}
+	var report UploadGCReport
+	status, body = doJSON(t, http.MethodPost, srv.URL+"/api/uploads/gc", token, "")
+	if status != http.StatusOK || json.Unmarshal(body, &report) != nil || report.Removed != 0 {
+		t.Fatalf("gc removed an image a revision uses: %d %s", status, body)
+	}
+
+	_, body = doJSON(t, http.MethodGet, postURL+"/revisions", token, "")
+	var revisions []PostRevision
+	if err := json.Unmarshal(body, &revisions); err != nil || len(revisions) == 0 {
+		t.Fatalf("list revisions: %s", body)
+	}
+	baseline := revisions[len(revisions)-1]
+	status, body = doJSON(t, http.MethodPost, postURL+"/revisions/"+itoa(baseline.ID)+"/restore", token, "")
+	if status != http.StatusOK || !strings.Contains(string(body), att.Filename) {
+		t.Fatalf("restore: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/uploads/"+att.Filename, "", ""); status != http.StatusOK {
+		t.Fatalf("restored post's image not served: %d", status)
+	}
+}
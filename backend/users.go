@@ -0,0 +1,587 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles, from least to most privileged. Viewers can read private posts,
+// authors can write and manage their own posts, editors can manage every
+// post and admins can also change settings and manage users.
+const (
+	roleViewer = "viewer"
+	roleAuthor = "author"
+	roleEditor = "editor"
+	roleAdmin  = "admin"
+)
+
+var roleRank = map[string]int{
+	roleViewer: 1,
+	roleAuthor: 2,
+	roleEditor: 3,
+	roleAdmin:  4,
+}
+
+const (
+	usernameMaxLength = 64
+
+	// invitationDefaultTTL is how long an invitation link stays valid
+	invitationDefaultTTL = 7 * 24 * time.Hour
+	invitationMaxTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	errRegistrationClosed = errors.New("user registration is not allowed - user already exists")
+	errUsernameInvalid    = fmt.Errorf("username must be 1-%d letters, digits, dots, dashes or underscores", usernameMaxLength)
+	errUsernameTaken      = errors.New("username is already taken")
+	errInvalidRole        = errors.New("role must be one of admin, editor, author, viewer")
+	errLastAdmin          = errors.New("the last admin cannot be removed or demoted")
+	errInvitationInvalid  = errors.New("invitation is invalid or has expired")
+)
+
+type Invitation struct {
+	ID        int64     `json:"id"`
+	Role      string    `json:"role"`
+	CreatedBy int64     `json:"createdBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type contextKey int
+
+const claimsContextKey contextKey = iota
+
+// requestClaims returns the claims stored by requireAuth, or nil outside of
+// an authenticated handler
+func requestClaims(r *http.Request) *Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(*Claims)
+	return claims
+}
+
+func validRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// roleAtLeast reports whether role grants everything min does
+func roleAtLeast(role, min string) bool {
+	return roleRank[role] >= roleRank[min]
+}
+
+// validateUsername keeps usernames safe to use in URLs such as /authors/{username}
+func validateUsername(username string) error {
+	if username == "" || len(username) > usernameMaxLength {
+		return errUsernameInvalid
+	}
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return errUsernameInvalid
+		}
+	}
+	return nil
+}
+
+// sqlExecQueryer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecQueryer interface {
+	sqlQueryer
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertUser validates and stores a new account with the given role
+func insertUser(q sqlExecQueryer, username, password, role string) (*User, error) {
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	if !validRole(role) {
+		return nil, errInvalidRole
+	}
+
+	var exists bool
+	if err := q.QueryRow(`SELECT COUNT(*) > 0 FROM users WHERE username = ? COLLATE NOCASE`, username).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errUsernameTaken
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res, err := q.Exec(`INSERT INTO users (username, password_hash, role, created_at) VALUES (?, ?, ?, ?)`,
+		username, string(passwordHash), role, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &User{ID: id, Username: username, Role: role, CreatedAt: now}, nil
+}
+
+// getUser loads an account by ID
+func (a *App) getUser(id int64) (*User, error) {
+	var user User
+	err := a.DB.QueryRow(`SELECT id, username, role, created_at FROM users WHERE id = ?`, id).
+		Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *App) listUsers() ([]User, error) {
+	rows, err := a.DB.Query(`SELECT id, username, role, created_at FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// otherAdminsExist reports whether an admin other than userID remains
+func (a *App) otherAdminsExist(userID int64) (bool, error) {
+	var count int
+	err := a.DB.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ? AND id != ?`, roleAdmin, userID).Scan(&count)
+	return count > 0, err
+}
+
+// setUserRole changes a user's role, refusing to demote the last admin
+func (a *App) setUserRole(userID int64, role string) (*User, error) {
+	if !validRole(role) {
+		return nil, errInvalidRole
+	}
+	user, err := a.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == roleAdmin && role != roleAdmin {
+		ok, err := a.otherAdminsExist(userID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errLastAdmin
+		}
+	}
+	if _, err := a.DB.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, userID); err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return user, nil
+}
+
+// deleteUser removes an account with its sessions, tokens and second
+// factors. Their posts stay, without an author. Dependent rows are deleted
+// here rather than left to foreign key cascades, so nothing that signs in as
+// the account can outlive it.
+func (a *App) deleteUser(userID int64) error {
+	user, err := a.getUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.Role == roleAdmin {
+		ok, err := a.otherAdminsExist(userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errLastAdmin
+		}
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if _, err := tx.Exec(`UPDATE posts SET author_id = NULL WHERE author_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to detach posts: %v", err)
+	}
+	for _, table := range []string{"refresh_tokens", "api_tokens", "webauthn_credentials", "webauthn_challenges",
+		"recovery_codes", "login_challenges", "password_resets"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", table, err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE invitations SET created_by = NULL WHERE created_by = ?`, userID); err != nil {
+		return fmt.Errorf("failed to detach invitations: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE invitations SET used_by = NULL WHERE used_by = ?`, userID); err != nil {
+		return fmt.Errorf("failed to detach invitations: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	return tx.Commit()
+}
+
+// canEditPost reports whether the caller may modify a post: editors and
+// admins may edit anything, authors only what they wrote
+func canEditPost(claims *Claims, p Post) bool {
+	if claims == nil {
+		return false
+	}
+	if roleAtLeast(claims.Role, roleEditor) {
+		return true
+	}
+	return claims.Role == roleAuthor && p.AuthorID != nil && *p.AuthorID == claims.UserID
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// createInvitation stores a one-time invitation and returns its token; only
+// the hash is kept, like refresh tokens
+func (a *App) createInvitation(role string, createdBy int64, ttl time.Duration) (Invitation, string, error) {
+	if !validRole(role) {
+		return Invitation{}, "", errInvalidRole
+	}
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return Invitation{}, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	now := time.Now()
+	inv := Invitation{Role: role, CreatedBy: createdBy, ExpiresAt: now.Add(ttl), CreatedAt: now}
+	res, err := a.DB.Exec(`INSERT INTO invitations (token_hash, role, created_by, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		hashInvitationToken(token), role, createdBy, inv.ExpiresAt, now)
+	if err != nil {
+		return Invitation{}, "", err
+	}
+	inv.ID, _ = res.LastInsertId()
+	return inv, token, nil
+}
+
+// listInvitations returns invitations that can still be accepted
+func (a *App) listInvitations() ([]Invitation, error) {
+	rows, err := a.DB.Query(`SELECT id, role, created_by, expires_at, created_at FROM invitations WHERE used_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	invitations := []Invitation{}
+	for rows.Next() {
+		var inv Invitation
+		if err := rows.Scan(&inv.ID, &inv.Role, &inv.CreatedBy, &inv.ExpiresAt, &inv.CreatedAt); err != nil {
+			return nil, err
+		}
+		if inv.ExpiresAt.After(now) {
+			invitations = append(invitations, inv)
+		}
+	}
+	return invitations, rows.Err()
+}
+
+// acceptInvitation redeems an invitation token for a new account. The token
+// is consumed in the same transaction, so it works exactly once.
+func (a *App) acceptInvitation(token, username, password string) (*User, error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	var id int64
+	var role string
+	var expiresAt time.Time
+	err = tx.QueryRow(`SELECT id, role, expires_at FROM invitations WHERE token_hash = ? AND used_at IS NULL`,
+		hashInvitationToken(token)).Scan(&id, &role, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !expiresAt.After(time.Now())) {
+		return nil, errInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := insertUser(tx, username, password, role)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE invitations SET used_at = ?, used_by = ? WHERE id = ?`, time.Now(), user.ID, id); err != nil {
+		return nil, fmt.Errorf("failed to consume invitation: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return user, nil
+}
+
+// writeUserError maps account validation errors to HTTP responses
+func (a *App) writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "user not found", http.StatusNotFound)
+	case errors.Is(err, errUsernameTaken), errors.Is(err, errLastAdmin):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errUsernameInvalid), errors.Is(err, errInvalidRole), errors.Is(err, errInvitationInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		a.Logger.Error("User management failed", "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+	}
+}
+
+// handleUsers lists (GET) and creates (POST) accounts; admin only
+func (a *App) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+			users, err := a.listUsers()
+			if err != nil {
+				a.writeUserError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			_ = json.NewEncoder(w).Encode(users)
+		})(w, r)
+	case http.MethodPost:
+		a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+			var payload struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+				Role     string `json:"role"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if err := a.passwordPolicy.check(strings.TrimSpace(payload.Username), payload.Password); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			user, err := insertUser(a.DB, strings.TrimSpace(payload.Username), payload.Password, payload.Role)
+			if err != nil {
+				a.writeUserError(w, err)
+				return
+			}
+			a.Logger.Info("User created", "userID", user.ID, "username", user.Username, "role", user.Role, "by", requestClaims(r).UserID)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(user)
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUser changes the role of (PUT) or deletes (DELETE) an account; admin only
+func (a *App) handleUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+			var payload struct {
+				Role string `json:"role"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			user, err := a.setUserRole(userID, payload.Role)
+			if err != nil {
+				a.writeUserError(w, err)
+				return
+			}
+			a.Logger.Info("User role changed", "userID", user.ID, "role", user.Role, "by", requestClaims(r).UserID)
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(user)
+		})(w, r)
+	case http.MethodDelete:
+		a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+			if err := a.deleteUser(userID); err != nil {
+				a.writeUserError(w, err)
+				return
+			}
+			a.Logger.Info("User deleted", "userID", userID, "by", requestClaims(r).UserID)
+			a.cacheInvalidatePattern("posts_list_")
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleInvitations lists pending (GET) and creates (POST) invitations; admin only
+func (a *App) handleInvitations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+			invitations, err := a.listInvitations()
+			if err != nil {
+				a.writeUserError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			_ = json.NewEncoder(w).Encode(invitations)
+		})(w, r)
+	case http.MethodPost:
+		a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+			var payload struct {
+				Role           string `json:"role"`
+				ExpiresInHours int    `json:"expiresInHours"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			ttl := invitationDefaultTTL
+			if payload.ExpiresInHours > 0 {
+				ttl = min(time.Duration(payload.ExpiresInHours)*time.Hour, invitationMaxTTL)
+			}
+
+			inv, token, err := a.createInvitation(payload.Role, requestClaims(r).UserID, ttl)
+			if err != nil {
+				a.writeUserError(w, err)
+				return
+			}
+			a.Logger.Info("Invitation created", "invitationID", inv.ID, "role", inv.Role, "by", inv.CreatedBy)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"invitation": inv,
+				"token":      token,
+				"url":        a.requestSiteBase(r) + "/invite?token=" + token,
+			})
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleInvitation revokes a pending invitation; admin only
+func (a *App) handleInvitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireRole(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		res, err := a.DB.Exec(`DELETE FROM invitations WHERE id = ? AND used_at IS NULL`, r.PathValue("id"))
+		if err != nil {
+			a.writeUserError(w, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})(w, r)
+}
+
+// handleAcceptInvitation creates an account from an invitation token and
+// signs the new user in
+func (a *App) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if payload.Token == "" {
+		http.Error(w, "invitation token required", http.StatusBadRequest)
+		return
+	}
+	if err := a.passwordPolicy.check(strings.TrimSpace(payload.Username), payload.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.acceptInvitation(payload.Token, strings.TrimSpace(payload.Username), payload.Password)
+	if err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+	a.Logger.Info("Invitation accepted", "userID", user.ID, "username", user.Username, "role", user.Role)
+	a.writeAuthResponse(w, r, user)
+}
+
+// writeAuthResponse starts a new session for user and responds with its
+// access and refresh token pair
+func (a *App) writeAuthResponse(w http.ResponseWriter, r *http.Request, user *User) {
+	sessionID, refreshToken, err := a.createRefreshToken(user.ID, r)
+	if err != nil {
+		a.Logger.Error("Failed to generate refresh token", "userID", user.ID, "error", err.Error())
+		http.Error(w, "failed to generate refresh token", http.StatusInternalServerError)
+		return
+	}
+	a.writeTokenPair(w, user, sessionID, refreshToken)
+}
+
+// writeTokenPair responds with a new access token for an existing session
+func (a *App) writeTokenPair(w http.ResponseWriter, user *User, sessionID int64, refreshToken string) {
+	token, err := a.generateJWT(user, sessionID)
+	if err != nil {
+		a.Logger.Error("Failed to generate JWT token", "userID", user.ID, "error", err.Error())
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":        token,
+		"expiresIn":    int(a.tokens.accessTTL.Seconds()),
+		"refreshToken": refreshToken,
+		"user": map[string]interface{}{
+			"id":       user.ID,
+			"username": user.Username,
+			"role":     user.Role,
+		},
+	})
+}
+
+// withClaims returns r carrying claims for requestClaims
+func withClaims(r *http.Request, claims *Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims))
+}
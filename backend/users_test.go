@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// createTestAccount adds a user with the given role and returns an access token
+func createTestAccount(t *testing.T, app *App, username, role string) string {
+	t.Helper()
+	user, err := insertUser(app.DB, username, "secret-password", role)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	sessionID, _, err := app.createRefreshToken(user.ID, httptest.NewRequest(http.MethodPost, "/api/auth/login", nil))
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	token, err := app.generateJWT(user, sessionID)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return token
+}
+
+func doJSON(t *testing.T, method, url, token, body string) (int, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, out
+}
+
+func TestInvitationCreatesAccountOnce(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	admin := registerTestUser(t, srv.URL)
+
+	status, body := doJSON(t, http.MethodPost, srv.URL+"/api/invitations", admin, `{"role":"author"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create invitation: %d %s", status, body)
+	}
+	var created struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	_ = json.Unmarshal(body, &created)
+	if created.Token == "" || !strings.Contains(created.URL, created.Token) {
+		t.Fatalf("unexpected invitation response: %s", body)
+	}
+
+	accept := `{"token":"` + created.Token + `","username":"writer","password":"another-password"}`
+	status, body = doJSON(t, http.MethodPost, srv.URL+"/api/invitations/accept", "", accept)
+	if status != http.StatusOK {
+		t.Fatalf("accept invitation: %d %s", status, body)
+	}
+	var auth struct {
+		Token string `json:"token"`
+		User  struct {
+			Role string `json:"role"`
+		} `json:"user"`
+	}
+	_ = json.Unmarshal(body, &auth)
+	if auth.Token == "" || auth.User.Role != roleAuthor {
+		t.Fatalf("unexpected accept response: %s", body)
+	}
+
+	accept = `{"token":"` + created.Token + `","username":"second","password":"another-password"}`
+	if status, _ = doJSON(t, http.MethodPost, srv.URL+"/api/invitations/accept", "", accept); status != http.StatusBadRequest {
+		t.Fatalf("expected reused invitation to fail, got %d", status)
+	}
+
+	// Only admins manage users
+	if status, _ = doJSON(t, http.MethodGet, srv.URL+"/api/users", auth.Token, ""); status != http.StatusForbidden {
+		t.Fatalf("expected 403 listing users as author, got %d", status)
+	}
+}
+
+func TestRolesLimitPostEditing(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	admin := registerTestUser(t, srv.URL)
+	author := createTestAccount(t, app, "author", roleAuthor)
+	editor := createTestAccount(t, app, "editor", roleEditor)
+	viewer := createTestAccount(t, app, "viewer", roleViewer)
+
+	createPost := func(token string) (int, Post) {
+		t.Helper()
+		status, body := doJSON(t, http.MethodPost, srv.URL+"/api/posts", token, "")
+		var p Post
+		_ = json.Unmarshal(body, &p)
+		return status, p
+	}
+
+	if status, _ := createPost(viewer); status != http.StatusForbidden {
+		t.Fatalf("viewer created a post: %d", status)
+	}
+	_, adminPost := createPost(admin)
+	status, own := createPost(author)
+	if status != http.StatusCreated || own.AuthorID == nil {
+		t.Fatalf("author could not create post: %d %+v", status, own)
+	}
+
+	update := `{"content":"<h1>Edited</h1>"}`
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(own.ID), author, update); status != http.StatusOK {
+		t.Fatalf("author could not edit own post: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(adminPost.ID), author, update); status != http.StatusForbidden {
+		t.Fatalf("author edited someone else's post: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/posts/"+itoa(adminPost.ID)+"/publish", author, ""); status != http.StatusForbidden {
+		t.Fatalf("author published someone else's post: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/posts/"+itoa(adminPost.ID), author, ""); status != http.StatusForbidden {
+		t.Fatalf("author deleted someone else's post: %d", status)
+	}
+	if _, err := app.getPost(itoa(adminPost.ID)); err != nil {
+		t.Fatalf("post gone after refused delete: %v", err)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/posts/999999", author, ""); status != http.StatusNotFound {
+		t.Fatalf("deleting a missing post: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(adminPost.ID), editor, update); status != http.StatusOK {
+		t.Fatalf("editor could not edit post: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/posts/"+itoa(own.ID), viewer, ""); status != http.StatusOK {
+		t.Fatalf("viewer could not read private post: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/settings", editor, `{"key":"siteTitle","value":"x"}`); status != http.StatusForbidden {
+		t.Fatalf("editor changed settings: %d", status)
+	}
+
+	// The last admin cannot demote themselves
+	if status, _ := doJSON(t, http.MethodPut, srv.URL+"/api/users/1", admin, `{"role":"editor"}`); status != http.StatusConflict {
+		t.Fatalf("expected 409 demoting last admin, got %d", status)
+	}
+}
+
+func TestPostPageJSONLDUsesAuthor(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	author := createTestAccount(t, app, "ada", roleAuthor)
+
+	_, body := doJSON(t, http.MethodPost, srv.URL+"/api/posts", author, "")
+	var p Post
+	_ = json.Unmarshal(body, &p)
+	doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(p.ID), author, `{"content":"<h1>Hello</h1><p>World</p>"}`)
+	doJSON(t, http.MethodPost, srv.URL+"/api/posts/"+itoa(p.ID)+"/publish", author, "")
+
+	status, page := doJSON(t, http.MethodGet, srv.URL+"/posts/"+itoa(p.ID), "", "")
+	if status != http.StatusOK {
+		t.Fatalf("get post page: %d", status)
+	}
+	if !strings.Contains(string(page), `"author":{"@type":"Person","name":"ada","url":"`+srv.URL+`/authors/ada"}`) {
+		t.Fatalf("JSON-LD author not set to post author:\n%s", page)
+	}
+}
+
+func TestDeleteUserRevokesTokensAndTrust(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	admin := registerTestUser(t, srv.URL)
+	editor := createTestAccount(t, app, "editor", roleEditor)
+	var editorID int64
+	app.DB.QueryRow(`SELECT id FROM users WHERE username = 'editor'`).Scan(&editorID)
+
+	_, body := doJSON(t, http.MethodPost, srv.URL+"/api/posts", editor, "")
+	var p Post
+	_ = json.Unmarshal(body, &p)
+	raw, _ := json.Marshal(map[string]string{"content": `<h1>Embed</h1><script>alert(1)</script>`})
+	if status, body := doJSON(t, http.MethodPut, srv.URL+"/api/posts/"+itoa(p.ID), editor, string(raw)); status != http.StatusOK {
+		t.Fatalf("update: %d %s", status, body)
+	}
+	app.DB.Exec(`UPDATE posts SET is_private = 0 WHERE id = ?`, p.ID)
+	if page := getBodyOK(t, srv.URL+"/posts/"+itoa(p.ID)); !strings.Contains(page, "alert(1)") {
+		t.Fatalf("editor's raw HTML not rendered:\n%s", page)
+	}
+	_, apiToken, err := app.createAPIToken(editorID, "script", []string{scopePostsRead}, 0)
+	if err != nil {
+		t.Fatalf("create API token: %v", err)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", apiToken, ""); status != http.StatusOK {
+		t.Fatalf("API token rejected: %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/users/"+itoa(editorID), admin, ""); status != http.StatusNoContent {
+		t.Fatalf("delete user: %d", status)
+	}
+	var tokens int
+	app.DB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = ?`, editorID).Scan(&tokens)
+	if tokens != 0 {
+		t.Fatalf("%d API tokens outlived their user", tokens)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", apiToken, ""); status != http.StatusUnauthorized {
+		t.Fatalf("deleted user's API token still accepted: %d", status)
+	}
+	// Nobody vouches for the orphaned post's HTML any more
+	if page := getBodyOK(t, srv.URL+"/posts/"+itoa(p.ID)); strings.Contains(page, "alert(1)") || !strings.Contains(page, "<h1>Embed</h1>") {
+		t.Fatalf("orphaned post rendered unsanitized:\n%s", page)
+	}
+}
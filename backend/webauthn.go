@@ -0,0 +1,669 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	webauthnChallengeTTL = 5 * time.Minute
+	passkeyNameMax       = 64
+
+	// COSE algorithm identifiers offered to authenticators, in order of
+	// preference
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+
+	// authenticator data flags
+	authFlagUserPresent  = 0x01
+	authFlagUserVerified = 0x04
+	authFlagAttested     = 0x40
+)
+
+var (
+	errWebAuthnFailed = errors.New("passkey verification failed")
+	errPasskeyExists  = errors.New("passkey is already registered")
+	errPasskeyUnknown = errors.New("passkey not found")
+)
+
+// Passkey is a WebAuthn credential registered to a user
+type Passkey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// webauthnCredential is the PublicKeyCredential a browser returns, with
+// binary fields base64url encoded as by PublicKeyCredential.toJSON()
+type webauthnCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// collectedClientData is the browser-signed part of a WebAuthn ceremony
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData is the parsed authenticator data structure. The
+// credential fields are only set during registration.
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// decodeWebAuthnBase64 decodes base64url, with or without padding
+func decodeWebAuthnBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// webauthnUserHandle is the opaque user.id given to authenticators
+func webauthnUserHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// webauthnRelyingParty returns the origin passkeys are bound to and its
+// host, which serves as the relying party ID
+func (a *App) webauthnRelyingParty(r *http.Request) (string, string) {
+	origin := a.requestSiteBase(r)
+	u, err := url.Parse(origin)
+	if err != nil {
+		return origin, ""
+	}
+	return origin, u.Hostname()
+}
+
+// parseAuthenticatorData decodes authenticator data, including the attested
+// credential when the AT flag is set
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	var ad authenticatorData
+	if len(data) < 37 {
+		return ad, errors.New("authenticator data too short")
+	}
+	ad.rpIDHash = data[:32]
+	ad.flags = data[32]
+	ad.signCount = binary.BigEndian.Uint32(data[33:37])
+	if ad.flags&authFlagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return ad, errors.New("attested credential data too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return ad, errors.New("invalid credential ID")
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+	// The COSE key is a single CBOR item; extensions may follow it
+	_, after, err := cborDecode(rest)
+	if err != nil {
+		return ad, fmt.Errorf("invalid credential public key: %v", err)
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+	return ad, nil
+}
+
+// parseCOSEKey returns the public key and algorithm of a COSE_Key. Only the
+// algorithms offered in pubKeyCredParams are accepted.
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	item, _, err := cborDecode(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("COSE key is not a map")
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	x, _ := m[int64(-2)].([]byte)
+
+	switch {
+	case kty == 2 && alg == coseAlgES256 && crv == 1:
+		y, _ := m[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid P-256 coordinates")
+		}
+		// ecdh rejects points that are not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, 0, fmt.Errorf("invalid P-256 key: %v", err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, alg, nil
+	case kty == 1 && alg == coseAlgEdDSA && crv == 6:
+		if len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == coseAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 || len(e) == 0 || len(e) > 4 || pub.E < 3 {
+			return nil, 0, errors.New("invalid RSA key")
+		}
+		return pub, alg, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported COSE key (kty %d, alg %d)", kty, alg)
+}
+
+// verifyCOSESignature checks an assertion signature made with a COSE key
+func verifyCOSESignature(raw, signed, sig []byte) error {
+	pub, alg, err := parseCOSEKey(raw)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case coseAlgES256:
+		if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case coseAlgEdDSA:
+		if !ed25519.Verify(pub.(ed25519.PublicKey), signed, sig) {
+			return errors.New("invalid signature")
+		}
+	case coseAlgRS256:
+		return rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], sig)
+	}
+	return nil
+}
+
+// createWebAuthnChallenge stores a single-use challenge for a registration
+// (userID set) or a login (userID 0)
+func (a *App) createWebAuthnChallenge(userID int64, kind string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	var owner interface{}
+	if userID != 0 {
+		owner = userID
+	}
+	_, _ = a.DB.Exec(`DELETE FROM webauthn_challenges WHERE expires_at < ?`, now)
+	_, err := a.DB.Exec(`INSERT INTO webauthn_challenges (challenge_hash, user_id, kind, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		hashRefreshToken(challenge), owner, kind, now.Add(webauthnChallengeTTL), now)
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge redeems a challenge echoed in client data. It is
+// deleted whether or not the rest of the ceremony succeeds.
+func consumeWebAuthnChallenge(q sqlExecQueryer, challenge string, userID int64, kind string) error {
+	var id int64
+	var owner sql.NullInt64
+	var expiresAt time.Time
+	err := q.QueryRow(`SELECT id, user_id, expires_at FROM webauthn_challenges WHERE challenge_hash = ? AND kind = ?`,
+		hashRefreshToken(challenge), kind).Scan(&id, &owner, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebAuthnFailed
+	}
+	if err != nil {
+		return err
+	}
+	res, err := q.Exec(`DELETE FROM webauthn_challenges WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	// A concurrent request may have redeemed it first
+	if n, _ := res.RowsAffected(); n != 1 || !expiresAt.After(time.Now()) || owner.Int64 != userID {
+		return errWebAuthnFailed
+	}
+	return nil
+}
+
+// verifyClientData checks the ceremony type and origin and returns the
+// challenge the browser signed
+func verifyClientData(raw []byte, wantType, origin string) (string, error) {
+	var cd collectedClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return "", fmt.Errorf("invalid client data: %v", err)
+	}
+	if cd.Type != wantType {
+		return "", fmt.Errorf("unexpected ceremony type %q", cd.Type)
+	}
+	if cd.Origin != origin || cd.CrossOrigin {
+		return "", fmt.Errorf("unexpected origin %q", cd.Origin)
+	}
+	if cd.Challenge == "" {
+		return "", errors.New("missing challenge")
+	}
+	return cd.Challenge, nil
+}
+
+// checkAuthenticatorData requires the relying party hash to match and the
+// user to have been present and verified, since passkeys replace passwords
+func checkAuthenticatorData(ad authenticatorData, rpID string) error {
+	want := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) {
+		return errors.New("relying party ID mismatch")
+	}
+	if ad.flags&authFlagUserPresent == 0 || ad.flags&authFlagUserVerified == 0 {
+		return errors.New("user was not verified")
+	}
+	return nil
+}
+
+// registerPasskey verifies an attestation and stores the new credential.
+// Attestation statements are not checked; options ask for "none".
+func (a *App) registerPasskey(userID int64, name string, cred webauthnCredential, origin, rpID string) (*Passkey, error) {
+	clientDataJSON, err := decodeWebAuthnBase64(cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid client data", errWebAuthnFailed)
+	}
+	challenge, err := verifyClientData(clientDataJSON, "webauthn.create", origin)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+
+	if err := consumeWebAuthnChallenge(a.DB, challenge, userID, "register"); err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeWebAuthnBase64(cred.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestation object", errWebAuthnFailed)
+	}
+	item, _, err := cborDecode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+	attestation, _ := item.(map[interface{}]interface{})
+	authData, _ := attestation["authData"].([]byte)
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+	if err := checkAuthenticatorData(ad, rpID); err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+	if ad.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", errWebAuthnFailed)
+	}
+	if rawID, err := decodeWebAuthnBase64(cred.RawID); err != nil || !bytes.Equal(rawID, ad.credentialID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", errWebAuthnFailed)
+	}
+	if _, _, err := parseCOSEKey(ad.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len([]rune(name)) > passkeyNameMax {
+		name = string([]rune(name)[:passkeyNameMax])
+	}
+	credentialID := base64.RawURLEncoding.EncodeToString(ad.credentialID)
+	var exists bool
+	if err := a.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM webauthn_credentials WHERE credential_id = ?)`, credentialID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errPasskeyExists
+	}
+
+	pk := Passkey{Name: name, CreatedAt: time.Now()}
+	res, err := a.DB.Exec(`INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, name, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, credentialID, base64.StdEncoding.EncodeToString(ad.publicKey), ad.signCount, pk.Name, pk.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %v", err)
+	}
+	pk.ID, _ = res.LastInsertId()
+	return &pk, nil
+}
+
+// verifyPasskeyAssertion checks a login assertion and returns its user
+func (a *App) verifyPasskeyAssertion(cred webauthnCredential, origin, rpID string) (*User, error) {
+	clientDataJSON, err := decodeWebAuthnBase64(cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid client data", errWebAuthnFailed)
+	}
+	challenge, err := verifyClientData(clientDataJSON, "webauthn.get", origin)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+	if err := consumeWebAuthnChallenge(a.DB, challenge, 0, "login"); err != nil {
+		return nil, err
+	}
+
+	rawID, err := decodeWebAuthnBase64(cred.RawID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid credential ID", errWebAuthnFailed)
+	}
+	var credID, userID int64
+	var publicKey string
+	var storedCount uint32
+	err = a.DB.QueryRow(`SELECT id, user_id, public_key, sign_count FROM webauthn_credentials WHERE credential_id = ?`,
+		base64.RawURLEncoding.EncodeToString(rawID)).Scan(&credID, &userID, &publicKey, &storedCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: unknown credential", errWebAuthnFailed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cred.Response.UserHandle != "" {
+		handle, err := decodeWebAuthnBase64(cred.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, webauthnUserHandle(userID)) {
+			return nil, fmt.Errorf("%w: user handle mismatch", errWebAuthnFailed)
+		}
+	}
+
+	authData, err := decodeWebAuthnBase64(cred.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid authenticator data", errWebAuthnFailed)
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+	if err := checkAuthenticatorData(ad, rpID); err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+	sig, err := decodeWebAuthnBase64(cred.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature", errWebAuthnFailed)
+	}
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode passkey %d: %v", credID, err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := verifyCOSESignature(key, append(append([]byte(nil), authData...), clientDataHash[:]...), sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebAuthnFailed, err)
+	}
+	// A counter that does not advance suggests a cloned authenticator;
+	// synced passkeys always report zero
+	if (ad.signCount != 0 || storedCount != 0) && ad.signCount <= storedCount {
+		a.Logger.Warn("Passkey signature counter did not increase", "credentialID", credID, "userID", userID)
+		return nil, fmt.Errorf("%w: signature counter did not increase", errWebAuthnFailed)
+	}
+
+	if _, err := a.DB.Exec(`UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?`,
+		ad.signCount, time.Now(), credID); err != nil {
+		return nil, err
+	}
+	return a.getUser(userID)
+}
+
+// listPasskeys returns a user's passkeys, oldest first
+func (a *App) listPasskeys(userID int64) ([]Passkey, error) {
+	rows, err := a.DB.Query(`SELECT id, name, created_at, last_used_at FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []Passkey{}
+	for rows.Next() {
+		var pk Passkey
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&pk.ID, &pk.Name, &pk.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			pk.LastUsedAt = &lastUsed.Time
+		}
+		passkeys = append(passkeys, pk)
+	}
+	return passkeys, rows.Err()
+}
+
+// writeWebAuthnError maps passkey failures to HTTP responses
+func (a *App) writeWebAuthnError(w http.ResponseWriter, err error, status int) {
+	switch {
+	case errors.Is(err, errWebAuthnFailed):
+		a.Logger.Info("Passkey verification failed", "error", err.Error())
+		http.Error(w, errWebAuthnFailed.Error(), status)
+	case errors.Is(err, errPasskeyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errPasskeyUnknown):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		a.Logger.Error("Passkey request failed", "error", err.Error())
+		http.Error(w, "db error", http.StatusInternalServerError)
+	}
+}
+
+// handlePasskeyRegisterOptions returns PublicKeyCredentialCreationOptions for
+// adding a passkey to the caller's account
+func (a *App) handlePasskeyRegisterOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		claims := requestClaims(r)
+		challenge, err := a.createWebAuthnChallenge(claims.UserID, "register")
+		if err != nil {
+			a.writeWebAuthnError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Keep authenticators from registering a second credential here
+		exclude := []map[string]interface{}{}
+		rows, err := a.DB.Query(`SELECT credential_id FROM webauthn_credentials WHERE user_id = ?`, claims.UserID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err == nil {
+				exclude = append(exclude, map[string]interface{}{"type": "public-key", "id": id})
+			}
+		}
+
+		displayName := claims.Username
+		if profile, err := a.getProfile(claims.UserID); err == nil {
+			displayName = profile.name()
+		}
+		rpName := "Noet"
+		if settings, err := a.getPublicSettings(); err == nil && strings.TrimSpace(settings.SiteTitle) != "" {
+			rpName = strings.TrimSpace(settings.SiteTitle)
+		}
+		_, rpID := a.webauthnRelyingParty(r)
+
+		params := []map[string]interface{}{}
+		for _, alg := range []int{coseAlgES256, coseAlgEdDSA, coseAlgRS256} {
+			params = append(params, map[string]interface{}{"type": "public-key", "alg": alg})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"publicKey": map[string]interface{}{
+				"challenge": challenge,
+				"rp":        map[string]interface{}{"id": rpID, "name": rpName},
+				"user": map[string]interface{}{
+					"id":          base64.RawURLEncoding.EncodeToString(webauthnUserHandle(claims.UserID)),
+					"name":        claims.Username,
+					"displayName": displayName,
+				},
+				"pubKeyCredParams": params,
+				"timeout":          webauthnChallengeTTL.Milliseconds(),
+				"attestation":      "none",
+				"authenticatorSelection": map[string]interface{}{
+					"residentKey":        "required",
+					"requireResidentKey": true,
+					"userVerification":   "required",
+				},
+				"excludeCredentials": exclude,
+			},
+		})
+	})(w, r)
+}
+
+// handlePasskeyRegister verifies a new credential and stores it
+func (a *App) handlePasskeyRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Name       string             `json:"name"`
+			Credential webauthnCredential `json:"credential"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		claims := requestClaims(r)
+		origin, rpID := a.webauthnRelyingParty(r)
+		pk, err := a.registerPasskey(claims.UserID, payload.Name, payload.Credential, origin, rpID)
+		if err != nil {
+			a.writeWebAuthnError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.Logger.Info("Passkey registered", "userID", claims.UserID, "passkeyID", pk.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(pk)
+	})(w, r)
+}
+
+// handlePasskeyLoginOptions returns PublicKeyCredentialRequestOptions. No
+// credentials are listed: passkeys are discoverable, so the authenticator
+// offers the accounts it holds for this site.
+func (a *App) handlePasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	challenge, err := a.createWebAuthnChallenge(0, "login")
+	if err != nil {
+		a.writeWebAuthnError(w, err, http.StatusUnauthorized)
+		return
+	}
+	_, rpID := a.webauthnRelyingParty(r)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"publicKey": map[string]interface{}{
+			"challenge":        challenge,
+			"rpId":             rpID,
+			"timeout":          webauthnChallengeTTL.Milliseconds(),
+			"userVerification": "required",
+			"allowCredentials": []interface{}{},
+		},
+	})
+}
+
+// handlePasskeyLogin signs in with a passkey assertion. User verification
+// makes a passkey a second factor on its own, so TOTP is not asked for.
+func (a *App) handlePasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var cred webauthnCredential
+	if err := json.NewDecoder(r.Body).Decode(&cred); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if a.throttle(w, ipLimitKey(a.clientIP(r))) {
+		return
+	}
+	origin, rpID := a.webauthnRelyingParty(r)
+	user, err := a.verifyPasskeyAssertion(cred, origin, rpID)
+	if err != nil {
+		if errors.Is(err, errWebAuthnFailed) {
+			a.recordAuthFailure(r, "passkey", "", err.Error())
+		}
+		a.writeWebAuthnError(w, err, http.StatusUnauthorized)
+		return
+	}
+	a.Logger.Info("Login successful", "username", user.Username, "userID", user.ID, "method", "passkey")
+	a.writeAuthResponse(w, r, user)
+}
+
+// handlePasskeys lists the caller's passkeys
+func (a *App) handlePasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		passkeys, err := a.listPasskeys(requestClaims(r).UserID)
+		if err != nil {
+			a.writeWebAuthnError(w, err, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(passkeys)
+	})(w, r)
+}
+
+// handlePasskey removes one of the caller's passkeys
+func (a *App) handlePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid passkey id", http.StatusBadRequest)
+			return
+		}
+		claims := requestClaims(r)
+		res, err := a.DB.Exec(`DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?`, id, claims.UserID)
+		if err != nil {
+			a.writeWebAuthnError(w, err, http.StatusBadRequest)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			a.writeWebAuthnError(w, errPasskeyUnknown, http.StatusBadRequest)
+			return
+		}
+		a.Logger.Info("Passkey removed", "userID", claims.UserID, "passkeyID", id)
+		w.WriteHeader(http.StatusNoContent)
+	})(w, r)
+}
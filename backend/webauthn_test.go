@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// cborEncode encodes the few CBOR types a software authenticator needs
+func cborEncode(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		out := head(5, uint64(len(v)))
+		for k, item := range v {
+			out = append(out, cborEncode(k)...)
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	}
+	panic("cborEncode: unsupported type")
+}
+
+// softAuthenticator is an ES256 passkey authenticator held in memory
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle string
+	count      uint32
+}
+
+type testPublicKeyOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+func b64url(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func (s *softAuthenticator) clientData(typ, challenge, origin string) []byte {
+	b, _ := json.Marshal(map[string]interface{}{"type": typ, "challenge": challenge, "origin": origin, "crossOrigin": false})
+	return b
+}
+
+func (s *softAuthenticator) authData(rpID string, flags byte) []byte {
+	rpHash := sha256.Sum256([]byte(rpID))
+	return binary.BigEndian.AppendUint32(append(rpHash[:], flags), s.count)
+}
+
+// create answers navigator.credentials.create() with "none" attestation
+func (s *softAuthenticator) create(t *testing.T, body []byte, origin string) map[string]interface{} {
+	t.Helper()
+	var opts testPublicKeyOptions
+	if err := json.Unmarshal(body, &opts); err != nil {
+		t.Fatalf("creation options: %v", err)
+	}
+	s.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.credID = make([]byte, 16)
+	_, _ = rand.Read(s.credID)
+	s.userHandle = opts.PublicKey.User.ID
+
+	cose := cborEncode(map[interface{}]interface{}{
+		1: 2, 3: -7, -1: 1,
+		-2: s.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: s.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	authData := s.authData(opts.PublicKey.RP.ID, authFlagUserPresent|authFlagUserVerified|authFlagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(s.credID)))
+	authData = append(append(authData, s.credID...), cose...)
+	attestation := cborEncode(map[interface{}]interface{}{
+		"fmt": "none", "attStmt": map[interface{}]interface{}{}, "authData": authData,
+	})
+
+	return map[string]interface{}{
+		"id": b64url(s.credID), "rawId": b64url(s.credID), "type": "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64url(s.clientData("webauthn.create", opts.PublicKey.Challenge, origin)),
+			"attestationObject": b64url(attestation),
+		},
+	}
+}
+
+// get answers navigator.credentials.get() with a signed assertion
+func (s *softAuthenticator) get(t *testing.T, body []byte, origin string) map[string]interface{} {
+	t.Helper()
+	var opts testPublicKeyOptions
+	if err := json.Unmarshal(body, &opts); err != nil {
+		t.Fatalf("request options: %v", err)
+	}
+	s.count++
+	clientData := s.clientData("webauthn.get", opts.PublicKey.Challenge, origin)
+	authData := s.authData(opts.PublicKey.RPID, authFlagUserPresent|authFlagUserVerified)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	return map[string]interface{}{
+		"id": b64url(s.credID), "rawId": b64url(s.credID), "type": "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64url(clientData),
+			"authenticatorData": b64url(authData),
+			"signature":         b64url(sig),
+			"userHandle":        s.userHandle,
+		},
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(b)
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.Mux)
+	defer srv.Close()
+	token := registerTestUser(t, srv.URL)
+	auth := &softAuthenticator{}
+
+	status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/passkeys/register/options", token, "")
+	if status != http.StatusOK || !strings.Contains(string(body), `"rp":{"id":"127.0.0.1"`) {
+		t.Fatalf("register options: %d %s", status, body)
+	}
+	cred := auth.create(t, body, srv.URL)
+	register := mustJSON(t, map[string]interface{}{"name": "Laptop", "credential": cred})
+	if status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/passkeys/register", token, register); status != http.StatusCreated {
+		t.Fatalf("register: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/passkeys/register", token, register); status != http.StatusBadRequest {
+		t.Fatalf("registration challenge reused: %d", status)
+	}
+
+	login := func() (int, []byte, string) {
+		t.Helper()
+		_, options := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login/passkey/options", "", "")
+		assertion := mustJSON(t, auth.get(t, options, srv.URL))
+		status, body := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login/passkey", "", assertion)
+		return status, body, assertion
+	}
+	status, body, assertion := login()
+	var session testSession
+	_ = json.Unmarshal(body, &session)
+	if status != http.StatusOK || session.RefreshToken == "" {
+		t.Fatalf("passkey login: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodGet, srv.URL+"/api/auth/validate", session.Token, ""); status != http.StatusOK {
+		t.Fatalf("passkey session token rejected: %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login/passkey", "", assertion); status != http.StatusUnauthorized {
+		t.Fatalf("assertion replayed: %d", status)
+	}
+
+	// A cloned authenticator shows up as a counter that does not advance
+	auth.count--
+	if status, _, _ := login(); status != http.StatusUnauthorized {
+		t.Fatalf("stale signature counter accepted: %d", status)
+	}
+	auth.count++
+
+	// Assertions made for another site are rejected
+	_, options := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login/passkey/options", "", "")
+	phished := mustJSON(t, auth.get(t, options, "https://evil.example"))
+	if status, _ := doJSON(t, http.MethodPost, srv.URL+"/api/auth/login/passkey", "", phished); status != http.StatusUnauthorized {
+		t.Fatalf("assertion from another origin accepted: %d", status)
+	}
+
+	status, body = doJSON(t, http.MethodGet, srv.URL+"/api/auth/passkeys", token, "")
+	var passkeys []Passkey
+	_ = json.Unmarshal(body, &passkeys)
+	if status != http.StatusOK || len(passkeys) != 1 || passkeys[0].Name != "Laptop" || passkeys[0].LastUsedAt == nil {
+		t.Fatalf("list passkeys: %d %s", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, srv.URL+"/api/auth/passkeys/"+itoa(passkeys[0].ID), token, ""); status != http.StatusNoContent {
+		t.Fatalf("delete passkey: %d", status)
+	}
+	if status, _, _ := login(); status != http.StatusUnauthorized {
+		t.Fatalf("deleted passkey still signs in: %d", status)
+	}
+}
+
+func TestCBORDecodeRejectsMalformedInput(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"truncated bytes":  {0x58, 0x20, 0x01},
+		"huge array":       {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"indefinite map":   {0xbf, 0x01, 0x02, 0xff},
+		"byte string keys": {0xa1, 0x41, 0x00, 0x01},
+		"too deep":         []byte(strings.Repeat("\x81", cborMaxDepth+2) + "\x00"),
+	} {
+		if _, _, err := cborDecode(data); err == nil {
+			t.Errorf("%s: decoded without error", name)
+		}
+	}
+
+	item, rest, err := cborDecode([]byte{0xa2, 0x01, 0x02, 0x20, 0x63, 'a', 'b', 'c', 0xf5})
+	m, _ := item.(map[interface{}]interface{})
+	if err != nil || m[int64(1)] != int64(2) || m[int64(-1)] != "abc" || len(rest) != 1 {
+		t.Fatalf("decode map: %v %#v %x", err, item, rest)
+	}
+}
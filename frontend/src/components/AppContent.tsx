@@ -2,10 +2,15 @@ import { useState, useEffect, useMemo } from "react";
 import { useQueryClient } from "@tanstack/react-query";
 import { Login } from "./auth/Login";
 import { Registration } from "./auth/Registration";
+import { AcceptInvitation } from "./auth/AcceptInvitation";
+import { ResetPassword } from "./auth/ResetPassword";
 import { Home } from "./pages/Home";
 import { Archive } from "./pages/Archive";
 import { AboutMe } from "./pages/AboutMe";
 import { Settings } from "./pages/Settings";
+import { Search } from "./pages/Search";
+import { Tag } from "./pages/Tag";
+import { Author } from "./pages/Author";
 import { PostEditor } from "./pages/PostEditor";
 import { usePrefetch } from "../hooks/usePrefetch";
 import { useAuth } from "../hooks/useAuth";
@@ -23,8 +28,18 @@ export function AppContent() {
 	const { settings } = useSettings();
 
 	const match = useMemo(() => {
-		const m = path.match(/^\/posts\/([A-Za-z0-9_-]+)$/);
-		return m?.[1];
+		const m = path.match(/^\/posts\/([^/]+)$/);
+		return m ? decodeURIComponent(m[1]) : undefined;
+	}, [path]);
+
+	const tagMatch = useMemo(() => {
+		const m = path.match(/^\/tags\/([^/]+)$/);
+		return m ? decodeURIComponent(m[1]) : undefined;
+	}, [path]);
+
+	const authorMatch = useMemo(() => {
+		const m = path.match(/^\/authors\/([^/]+)$/);
+		return m ? decodeURIComponent(m[1]) : undefined;
 	}, [path]);
 
 	useEffect(() => {
@@ -67,6 +82,12 @@ export function AppContent() {
 			title = `About — ${siteTitle}`;
 		} else if (path === "/settings") {
 			title = `Settings — ${siteTitle}`;
+		} else if (path === "/search") {
+			title = `Search — ${siteTitle}`;
+		} else if (tagMatch) {
+			title = `#${tagMatch} — ${siteTitle}`;
+		} else if (authorMatch) {
+			title = `${authorMatch} — ${siteTitle}`;
 		} else if (match) {
 			const detailKey = postsQueryKeys.detail(match);
 			const post =
@@ -84,7 +105,7 @@ export function AppContent() {
 		}
 
 		document.title = title;
-	}, [path, match, queryClient, settings.siteTitle]);
+	}, [path, match, tagMatch, authorMatch, queryClient, settings.siteTitle]);
 
 	// Set up a listener to update title when post data changes in cache
 	useEffect(() => {
@@ -130,6 +151,10 @@ export function AppContent() {
 		<>
 			{path === "/admin" ? (
 				<Login />
+			) : path === "/invite" ? (
+				<AcceptInvitation />
+			) : path === "/reset-password" ? (
+				<ResetPassword />
 			) : match ? (
 				<PostEditor id={match} />
 			) : path === "/archive" ? (
@@ -138,6 +163,12 @@ export function AppContent() {
 				<AboutMe />
 			) : path === "/settings" ? (
 				<Settings />
+			) : path === "/search" ? (
+				<Search />
+			) : tagMatch ? (
+				<Tag tag={tagMatch} />
+			) : authorMatch ? (
+				<Author username={authorMatch} />
 			) : (
 				<Home />
 			)}
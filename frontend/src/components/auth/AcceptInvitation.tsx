@@ -0,0 +1,110 @@
+import { useState } from "react";
+
+export function AcceptInvitation() {
+	const [token] = useState(
+		() => new URLSearchParams(window.location.search).get("token") ?? "",
+	);
+	const [username, setUsername] = useState("");
+	const [password, setPassword] = useState("");
+	const [confirmPassword, setConfirmPassword] = useState("");
+	const [loading, setLoading] = useState(false);
+	const [error, setError] = useState("");
+
+	const handleSubmit = async (e: React.FormEvent) => {
+		e.preventDefault();
+		if (!username || !password || !confirmPassword) {
+			setError("Please fill in all fields");
+			return;
+		}
+
+		if (password !== confirmPassword) {
+			setError("Passwords do not match");
+			return;
+		}
+
+		setLoading(true);
+		setError("");
+
+		try {
+			const res = await fetch("/api/invitations/accept", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ token, username, password }),
+			});
+
+			if (!res.ok) {
+				setError((await res.text()).trim() || "Could not accept invitation");
+				setLoading(false);
+				return;
+			}
+
+			const data = await res.json();
+			localStorage.setItem("auth_token", data.token);
+			localStorage.setItem("refresh_token", data.refreshToken);
+			window.location.assign("/");
+		} catch (e) {
+			console.error("AcceptInvitation: Request failed", e);
+			setError("Could not accept invitation. Please try again.");
+			setLoading(false);
+		}
+	};
+
+	if (!token) {
+		return (
+			<div className="login-container">
+				<div className="login-content">
+					<h1>Invitation</h1>
+					<p>This invitation link is incomplete. Ask an admin for a new one.</p>
+				</div>
+			</div>
+		);
+	}
+
+	return (
+		<div className="login-container">
+			<div className="login-content">
+				<h1>Join this site</h1>
+				<form onSubmit={handleSubmit} className="login-form">
+					{error && <div className="error-message">{error}</div>}
+					<div className="form-group">
+						<label htmlFor="username">Username</label>
+						<input
+							type="text"
+							id="username"
+							value={username}
+							onChange={(e) => setUsername(e.target.value)}
+							disabled={loading}
+							autoFocus
+							placeholder="Choose a username"
+						/>
+					</div>
+					<div className="form-group">
+						<label htmlFor="password">Password</label>
+						<input
+							type="password"
+							id="password"
+							value={password}
+							onChange={(e) => setPassword(e.target.value)}
+							disabled={loading}
+							placeholder="Choose a password"
+						/>
+					</div>
+					<div className="form-group">
+						<label htmlFor="confirmPassword">Confirm Password</label>
+						<input
+							type="password"
+							id="confirmPassword"
+							value={confirmPassword}
+							onChange={(e) => setConfirmPassword(e.target.value)}
+							disabled={loading}
+							placeholder="Confirm your password"
+						/>
+					</div>
+					<button type="submit" className="login-button" disabled={loading}>
+						{loading ? "Creating Account..." : "Create Account"}
+					</button>
+				</form>
+			</div>
+		</div>
+	);
+}
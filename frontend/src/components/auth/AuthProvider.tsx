@@ -1,8 +1,23 @@
 import { createContext, useEffect, useState } from "react";
-import { type AuthContextType, type User } from '../../types';
+import { type AuthContextType, type LoginResult, type User } from '../../types';
+import { getPasskey } from '../../lib/webauthn';
 
 export const AuthContext = createContext<AuthContextType | null>(null);
 
+// Access tokens are short-lived, so they are refreshed this long before
+// they expire
+const REFRESH_MARGIN_MS = 60_000;
+
+// tokenExpiry reads the exp claim of a JWT in milliseconds
+function tokenExpiry(token: string): number | null {
+	try {
+		const payload = JSON.parse(atob(token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/")));
+		return typeof payload.exp === "number" ? payload.exp * 1000 : null;
+	} catch {
+		return null;
+	}
+}
+
 export function AuthProvider({ children }: { children: React.ReactNode }) {
 	const [user, setUser] = useState<User | null>(null);
 	const [token, setToken] = useState<string | null>(null);
@@ -87,10 +102,18 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
 		}
 	};
 
+	const storeSession = (data: { token: string; refreshToken: string; user: User }) => {
+		setToken(data.token);
+		setUser(data.user);
+		setRefreshTokenValue(data.refreshToken);
+		localStorage.setItem("auth_token", data.token);
+		localStorage.setItem("refresh_token", data.refreshToken);
+	};
+
 	const login = async (
 		username: string,
 		password: string,
-	): Promise<boolean> => {
+	): Promise<LoginResult> => {
 		try {
 			const res = await fetch("/api/auth/login", {
 				method: "POST",
@@ -100,23 +123,58 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
 
 			if (res.ok) {
 				const data = await res.json();
-				setToken(data.token);
-				setUser(data.user);
-				setRefreshTokenValue(data.refreshToken);
-				localStorage.setItem("auth_token", data.token);
-				localStorage.setItem("refresh_token", data.refreshToken);
-				return true;
+				if (data.twoFactorRequired) {
+					return { status: "twoFactor", challengeToken: data.challengeToken };
+				}
+				storeSession(data);
+				return { status: "ok" };
+			} else if (res.status === 429) {
+				return { status: "throttled", retryAfter: Number(res.headers.get("Retry-After")) || 60 };
 			} else {
 				console.error("AuthProvider: Login failed - invalid credentials", { status: res.status, username });
 			}
-			return false;
+			return { status: "failed" };
 		} catch (error) {
 			console.error("AuthProvider: Login request failed", error);
+			return { status: "failed" };
+		}
+	};
+
+	const verifyTwoFactor = async (
+		challengeToken: string,
+		code: string,
+		useRecoveryCode = false,
+	): Promise<boolean> => {
+		try {
+			const res = await fetch("/api/auth/login/totp", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(
+					useRecoveryCode ? { challengeToken, recoveryCode: code } : { challengeToken, code },
+				),
+			});
+			if (res.ok) {
+				storeSession(await res.json());
+				return true;
+			}
+			console.error("AuthProvider: Two-factor verification failed", { status: res.status });
+			return false;
+		} catch (error) {
+			console.error("AuthProvider: Two-factor request failed", error);
 			return false;
 		}
 	};
 
 	const logout = () => {
+		// End the session server-side too; the refresh token works even
+		// after the access token expired
+		if (refreshTokenValue) {
+			fetch("/api/auth/logout", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ refreshToken: refreshTokenValue }),
+			}).catch((e) => console.error("AuthProvider: Logout request failed", e));
+		}
 		setToken(null);
 		setUser(null);
 		setRefreshTokenValue(null);
@@ -124,6 +182,28 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
 		localStorage.removeItem("refresh_token");
 	};
 
+	const loginWithPasskey = async (): Promise<boolean> => {
+		try {
+			const optionsRes = await fetch("/api/auth/login/passkey/options", { method: "POST" });
+			if (!optionsRes.ok) return false;
+			const assertion = await getPasskey(await optionsRes.json());
+			const res = await fetch("/api/auth/login/passkey", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(assertion),
+			});
+			if (res.ok) {
+				storeSession(await res.json());
+				return true;
+			}
+			console.error("AuthProvider: Passkey login failed", { status: res.status });
+			return false;
+		} catch (error) {
+			console.error("AuthProvider: Passkey login request failed", error);
+			return false;
+		}
+	};
+
 	const register = async (
 		username: string,
 		password: string,
@@ -181,12 +261,26 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
 		}
 	};
 
+	// Renew the access token shortly before it expires
+	useEffect(() => {
+		if (!token || !refreshTokenValue) return;
+		const expiry = tokenExpiry(token);
+		if (!expiry) return;
+		const timer = setTimeout(() => {
+			refreshToken();
+		}, Math.max(expiry - Date.now() - REFRESH_MARGIN_MS, 0));
+		return () => clearTimeout(timer);
+		// eslint-disable-next-line react-hooks/exhaustive-deps
+	}, [token, refreshTokenValue]);
+
 	return (
 		<AuthContext.Provider
 			value={{
 				user,
 				token,
 				login,
+				verifyTwoFactor,
+				loginWithPasskey,
 				register,
 				logout,
 				isAuthenticated: !!token && !!user,
@@ -1,12 +1,16 @@
 import { useState } from "react";
 import { useAuth } from "../../hooks/useAuth";
+import { passkeysSupported } from "../../lib/webauthn";
 
 export function Login() {
 	const [username, setUsername] = useState("");
 	const [password, setPassword] = useState("");
+	const [challengeToken, setChallengeToken] = useState("");
+	const [code, setCode] = useState("");
+	const [useRecoveryCode, setUseRecoveryCode] = useState(false);
 	const [loading, setLoading] = useState(false);
 	const [error, setError] = useState("");
-	const { login } = useAuth();
+	const { login, verifyTwoFactor, loginWithPasskey } = useAuth();
 
 	const handleSubmit = async (e: React.FormEvent) => {
 		e.preventDefault();
@@ -18,15 +22,94 @@ export function Login() {
 		setLoading(true);
 		setError("");
 
-		const success = await login(username, password);
-		if (success) {
+		const result = await login(username, password);
+		if (result.status === "ok") {
 			window.location.assign("/");
+		} else if (result.status === "twoFactor") {
+			setChallengeToken(result.challengeToken);
+			setLoading(false);
+		} else if (result.status === "throttled") {
+			const wait = result.retryAfter >= 60 ? `${Math.ceil(result.retryAfter / 60)} minutes` : `${result.retryAfter} seconds`;
+			setError(`Too many failed attempts. Try again in ${wait}.`);
+			setLoading(false);
 		} else {
 			setError("Invalid credentials");
 			setLoading(false);
 		}
 	};
 
+	const handlePasskey = async () => {
+		setLoading(true);
+		setError("");
+
+		if (await loginWithPasskey()) {
+			window.location.assign("/");
+		} else {
+			setError("Passkey sign-in failed");
+			setLoading(false);
+		}
+	};
+
+	const handleVerify = async (e: React.FormEvent) => {
+		e.preventDefault();
+		if (!code) {
+			setError("Please enter a code");
+			return;
+		}
+
+		setLoading(true);
+		setError("");
+
+		if (await verifyTwoFactor(challengeToken, code, useRecoveryCode)) {
+			window.location.assign("/");
+		} else {
+			setError("Invalid code. After several failures, sign in again.");
+			setLoading(false);
+		}
+	};
+
+	if (challengeToken) {
+		return (
+			<div className="login-container">
+				<div className="login-content">
+					<h1>Two-Factor Authentication</h1>
+					<form onSubmit={handleVerify} className="login-form">
+						{error && <div className="error-message">{error}</div>}
+						<div className="form-group">
+							<label htmlFor="code">
+								{useRecoveryCode ? "Recovery code" : "Code from your authenticator app"}
+							</label>
+							<input
+								type="text"
+								id="code"
+								value={code}
+								onChange={(e) => setCode(e.target.value)}
+								disabled={loading}
+								autoFocus
+								autoComplete="one-time-code"
+								inputMode={useRecoveryCode ? "text" : "numeric"}
+							/>
+						</div>
+						<button type="submit" className="login-button" disabled={loading}>
+							{loading ? "Verifying..." : "Verify"}
+						</button>
+						<button
+							type="button"
+							onClick={() => {
+								setUseRecoveryCode(!useRecoveryCode);
+								setCode("");
+								setError("");
+							}}
+							style={{ background: "transparent", border: "none", color: "#666", cursor: "pointer", marginTop: 12 }}
+						>
+							{useRecoveryCode ? "Use an authenticator code" : "Use a recovery code"}
+						</button>
+					</form>
+				</div>
+			</div>
+		);
+	}
+
 	return (
 		<div className="login-container">
 			<div className="login-content">
@@ -57,8 +140,18 @@ export function Login() {
 					<button type="submit" className="login-button" disabled={loading}>
 						{loading ? "Signing In..." : "Sign In"}
 					</button>
+					{passkeysSupported() && (
+						<button
+							type="button"
+							onClick={handlePasskey}
+							disabled={loading}
+							style={{ background: "transparent", border: "none", color: "#666", cursor: "pointer", marginTop: 12 }}
+						>
+							Sign in with a passkey
+						</button>
+					)}
 				</form>
 			</div>
 		</div>
 	);
-}
\ No newline at end of file
+}
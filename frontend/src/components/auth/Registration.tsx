@@ -21,8 +21,8 @@ export function Registration() {
 			return;
 		}
 
-		if (password.length < 3) {
-			setError("Password must be at least 3 characters");
+		if (password.length < 10) {
+			setError("Password must be at least 10 characters");
 			return;
 		}
 
@@ -33,7 +33,7 @@ export function Registration() {
 		if (success) {
 			window.location.assign("/");
 		} else {
-			setError("Registration failed. Please try again.");
+			setError("Registration failed. Use a longer password that mixes letters with digits or symbols.");
 			setLoading(false);
 		}
 	};
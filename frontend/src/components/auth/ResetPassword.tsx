@@ -0,0 +1,105 @@
+import { useState } from "react";
+
+export function ResetPassword() {
+	const [token] = useState(
+		() => new URLSearchParams(window.location.search).get("token") ?? "",
+	);
+	const [password, setPassword] = useState("");
+	const [confirmPassword, setConfirmPassword] = useState("");
+	const [loading, setLoading] = useState(false);
+	const [error, setError] = useState("");
+
+	const handleSubmit = async (e: React.FormEvent) => {
+		e.preventDefault();
+		if (!password || !confirmPassword) {
+			setError("Please fill in all fields");
+			return;
+		}
+
+		if (password !== confirmPassword) {
+			setError("Passwords do not match");
+			return;
+		}
+
+		setLoading(true);
+		setError("");
+
+		try {
+			const res = await fetch("/api/auth/reset", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ token, password }),
+			});
+
+			if (!res.ok) {
+				setError((await res.text()).trim() || "Could not reset password");
+				setLoading(false);
+				return;
+			}
+
+			const data = await res.json();
+			if (data.twoFactorRequired) {
+				// The second factor still applies; finish on the login page
+				window.location.assign("/admin");
+				return;
+			}
+			localStorage.setItem("auth_token", data.token);
+			localStorage.setItem("refresh_token", data.refreshToken);
+			window.location.assign("/");
+		} catch (e) {
+			console.error("ResetPassword: Request failed", e);
+			setError("Could not reset password. Please try again.");
+			setLoading(false);
+		}
+	};
+
+	if (!token) {
+		return (
+			<div className="login-container">
+				<div className="login-content">
+					<h1>Reset password</h1>
+					<p>This reset link is incomplete. Ask an admin for a new one.</p>
+				</div>
+			</div>
+		);
+	}
+
+	return (
+		<div className="login-container">
+			<div className="login-content">
+				<h1>Choose a new password</h1>
+				<form onSubmit={handleSubmit} className="login-form">
+					{error && <div className="error-message">{error}</div>}
+					<div className="form-group">
+						<label htmlFor="password">New Password</label>
+						<input
+							type="password"
+							id="password"
+							value={password}
+							onChange={(e) => setPassword(e.target.value)}
+							disabled={loading}
+							autoFocus
+							autoComplete="new-password"
+							placeholder="Choose a password"
+						/>
+					</div>
+					<div className="form-group">
+						<label htmlFor="confirmPassword">Confirm Password</label>
+						<input
+							type="password"
+							id="confirmPassword"
+							value={confirmPassword}
+							onChange={(e) => setConfirmPassword(e.target.value)}
+							disabled={loading}
+							autoComplete="new-password"
+							placeholder="Confirm your password"
+						/>
+					</div>
+					<button type="submit" className="login-button" disabled={loading}>
+						{loading ? "Saving..." : "Set Password"}
+					</button>
+				</form>
+			</div>
+		</div>
+	);
+}
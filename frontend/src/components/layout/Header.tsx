@@ -84,6 +84,12 @@ export const Header = memo<HeaderProps>(function Header({
 							About Me
 						</Link>
 					)}
+					<Link
+						className={`header-button ${path === "/search" ? "active" : ""}`}
+						href="/search"
+					>
+						Search
+					</Link>
 					<a className="header-button" href="/rss.xml">
 						RSS
 					</a>
@@ -148,6 +154,13 @@ export const Header = memo<HeaderProps>(function Header({
 										About Me
 									</Link>
 								)}
+								<Link
+									className={`mobile-menu-item ${path === "/search" ? "active" : ""}`}
+									href="/search"
+									onClick={handleLinkClick}
+								>
+									Search
+								</Link>
 								<a className="mobile-menu-item" href="/rss.xml" onClick={handleLinkClick}>
 									RSS
 								</a>
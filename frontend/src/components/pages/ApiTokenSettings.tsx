@@ -0,0 +1,213 @@
+import { useState, useEffect, useCallback } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { formatDate } from "../../utils";
+
+type ApiToken = {
+	id: number;
+	name: string;
+	prefix: string;
+	scopes: string[];
+	createdAt: string;
+	lastUsedAt?: string;
+	expiresAt?: string;
+};
+
+const SCOPES = [
+	{ id: "posts:read", label: "Read posts, including private ones" },
+	{ id: "posts:write", label: "Create, edit and delete posts" },
+	{ id: "uploads:write", label: "Upload and manage images" },
+	{ id: "settings:write", label: "Change site settings" },
+];
+
+// ApiTokenSettings manages personal API tokens for scripts and CI. A new
+// token is shown once, right after it is created.
+export function ApiTokenSettings() {
+	const { token } = useAuth();
+	const [tokens, setTokens] = useState<ApiToken[]>([]);
+	const [name, setName] = useState("");
+	const [scopes, setScopes] = useState<string[]>(["posts:read"]);
+	const [expiresInDays, setExpiresInDays] = useState(0);
+	const [created, setCreated] = useState("");
+	const [busy, setBusy] = useState(false);
+	const [error, setError] = useState("");
+
+	const load = useCallback(async () => {
+		if (!token) return;
+		try {
+			const res = await fetch("/api/tokens", {
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to load API tokens: ${res.status}`);
+			setTokens(await res.json());
+		} catch (e) {
+			console.error("ApiTokenSettings: Failed to load tokens", e);
+		}
+	}, [token]);
+
+	useEffect(() => {
+		load();
+	}, [load]);
+
+	const toggleScope = (scope: string) =>
+		setScopes((prev) => (prev.includes(scope) ? prev.filter((s) => s !== scope) : [...prev, scope]));
+
+	const create = async (e: React.FormEvent) => {
+		e.preventDefault();
+		setBusy(true);
+		setError("");
+		try {
+			const res = await fetch("/api/tokens", {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token}`,
+				},
+				body: JSON.stringify({ name, scopes, expiresInDays }),
+			});
+			if (!res.ok) {
+				setError((await res.text()).trim() || "Could not create token");
+				return;
+			}
+			const data = await res.json();
+			setCreated(data.token);
+			setName("");
+			await load();
+		} catch (e) {
+			console.error("ApiTokenSettings: Failed to create token", e);
+			setError("Could not create token");
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	const revoke = async (t: ApiToken) => {
+		if (!confirm(`Revoke "${t.name}"? Scripts using it will stop working.`)) return;
+		setBusy(true);
+		try {
+			const res = await fetch(`/api/tokens/${t.id}`, {
+				method: "DELETE",
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to revoke token: ${res.status}`);
+			await load();
+		} catch (e) {
+			console.error("ApiTokenSettings: Failed to revoke token", e);
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	return (
+		<div style={{ marginTop: "32px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}>
+			<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
+				API tokens
+			</h3>
+			<div style={{ fontSize: "12px", color: "#666" }}>
+				Tokens let scripts call the API as you, limited to the scopes you pick. Send them as{" "}
+				<code>Authorization: Bearer noet_…</code>
+			</div>
+			{error && <div className="error-message">{error}</div>}
+
+			{created && (
+				<div style={{ fontSize: 14, margin: "12px 0" }}>
+					<div style={{ color: "#444" }}>Copy this token now. It will not be shown again.</div>
+					<code style={{ display: "block", margin: "8px 0", wordBreak: "break-all" }}>{created}</code>
+				</div>
+			)}
+
+			<ul style={{ listStyle: "none", padding: 0, margin: "12px 0 0" }}>
+				{tokens.map((t) => (
+					<li
+						key={t.id}
+						style={{ display: "flex", justifyContent: "space-between", gap: 12, padding: "8px 0", fontSize: 14 }}
+					>
+						<div>
+							<div>
+								{t.name} <code style={{ fontSize: 12, color: "#666" }}>{t.prefix}…</code>
+							</div>
+							<div style={{ fontSize: 12, color: "#666" }}>
+								{t.scopes.join(", ")} · created {formatDate(t.createdAt)}
+								{t.lastUsedAt ? <> · last used {formatDate(t.lastUsedAt)}</> : <> · never used</>}
+								{t.expiresAt && <> · expires {formatDate(t.expiresAt)}</>}
+							</div>
+						</div>
+						<button
+							onClick={() => revoke(t)}
+							disabled={busy}
+							style={{
+								background: "transparent",
+								border: "1px solid #dc2626",
+								color: "#dc2626",
+								padding: "4px 8px",
+								borderRadius: 4,
+								fontSize: 12,
+								cursor: "pointer",
+								alignSelf: "center",
+							}}
+						>
+							Revoke
+						</button>
+					</li>
+				))}
+			</ul>
+
+			<form onSubmit={create} style={{ marginTop: 12, fontSize: 14 }}>
+				<input
+					type="text"
+					placeholder="Name, e.g. Release notes CI"
+					value={name}
+					onChange={(e) => setName(e.target.value)}
+					disabled={busy}
+					maxLength={100}
+					style={{
+						width: "100%",
+						boxSizing: "border-box",
+						fontFamily: "Inter, system-ui, sans-serif",
+						fontSize: 14,
+						padding: 8,
+						border: "1px solid #d1d5db",
+						borderRadius: 6,
+					}}
+				/>
+				{SCOPES.map((s) => (
+					<label key={s.id} style={{ display: "block", margin: "6px 0", color: "#444" }}>
+						<input
+							type="checkbox"
+							checked={scopes.includes(s.id)}
+							onChange={() => toggleScope(s.id)}
+							disabled={busy}
+						/>{" "}
+						<code>{s.id}</code> {s.label}
+					</label>
+				))}
+				<label style={{ display: "block", margin: "6px 0", color: "#444" }}>
+					Expires{" "}
+					<select
+						value={expiresInDays}
+						onChange={(e) => setExpiresInDays(Number(e.target.value))}
+						disabled={busy}
+					>
+						<option value={0}>never</option>
+						<option value={30}>in 30 days</option>
+						<option value={90}>in 90 days</option>
+						<option value={365}>in a year</option>
+					</select>
+				</label>
+				<button
+					type="submit"
+					disabled={busy || !name.trim() || scopes.length === 0}
+					style={{
+						marginTop: 8,
+						background: "#fff",
+						border: "1px solid #d1d5db",
+						borderRadius: 8,
+						padding: "8px 12px",
+						cursor: busy ? "default" : "pointer",
+					}}
+				>
+					Create token
+				</button>
+			</form>
+		</div>
+	);
+}
@@ -0,0 +1,105 @@
+import { useEffect, useState } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { useSettings } from "../../hooks/useSettings";
+import { Header } from "../layout/Header";
+import { Link } from "../common/Link";
+import { type Note, type AuthorProfile } from "../../types";
+import { formatDate } from "../../utils";
+import { navigateTo } from "../../lib/router";
+
+export function Author({ username }: { username: string }) {
+	const { isAuthenticated, logout, token } = useAuth();
+	const { settings } = useSettings();
+	const [profile, setProfile] = useState<AuthorProfile | null>(null);
+	const [posts, setPosts] = useState<Note[]>([]);
+	const [loading, setLoading] = useState(true);
+	const [error, setError] = useState<string | null>(null);
+
+	useEffect(() => {
+		const controller = new AbortController();
+		const load = async () => {
+			setLoading(true);
+			setError(null);
+			try {
+				const res = await fetch(`/api/authors/${encodeURIComponent(username)}`, {
+					headers: token ? { Authorization: `Bearer ${token}` } : {},
+					signal: controller.signal,
+				});
+				if (res.status === 404) {
+					setError("Author not found.");
+					return;
+				}
+				if (!res.ok) throw new Error(`Failed to load author: ${res.status}`);
+				const data = await res.json();
+				setProfile(data.profile);
+				setPosts(data.posts ?? []);
+			} catch (e) {
+				if (controller.signal.aborted) return;
+				console.error("Author: Failed to load author", { username, error: e });
+				setError("Failed to load author.");
+			} finally {
+				if (!controller.signal.aborted) setLoading(false);
+			}
+		};
+		load();
+		return () => controller.abort();
+	}, [username, token]);
+
+	const name = profile?.displayName || profile?.username || username;
+
+	return (
+		<div className="home-container">
+			<Header
+				siteTitle={settings.siteTitle}
+				isAuthenticated={isAuthenticated}
+				onLogout={logout}
+				onSettings={() => navigateTo("/settings")}
+				aboutEnabled={settings.aboutEnabled}
+			/>
+			<div className="home-content author-profile">
+				{profile?.avatar && (
+					<img className="author-avatar" src={profile.avatar} alt="" width={96} height={96} />
+				)}
+				<h1>{name}</h1>
+				{profile?.bio && (
+					<div className="post-content author-bio" dangerouslySetInnerHTML={{ __html: profile.bio }} />
+				)}
+				{profile && profile.links.length > 0 && (
+					<ul className="author-links">
+						{profile.links.map((link) => (
+							<li key={link.url}>
+								<a href={link.url} rel="me noopener">
+									{link.label}
+								</a>
+							</li>
+						))}
+					</ul>
+				)}
+				{profile && (
+					<p className="post-meta">
+						<a href={`/authors/${encodeURIComponent(profile.username)}/rss.xml`}>RSS feed</a>
+					</p>
+				)}
+				{loading && posts.length === 0 && <p>Loading…</p>}
+				{error && <p>{error}</p>}
+				{!loading && !error && posts.length === 0 && <p>No posts yet.</p>}
+				{posts.length > 0 && (
+					<ul className="post-list">
+						{posts.map((p) => (
+							<li key={p.id}>
+								<Link href={`/posts/${p.slug || p.id}`} className="post-link group">
+									<span className="post-title group-underline">
+										{p.title && p.title.trim() ? p.title : "Untitled"}
+									</span>
+									{p.updatedAt && (
+										<span className="post-meta"> — {formatDate(p.updatedAt)}</span>
+									)}
+								</Link>
+							</li>
+						))}
+					</ul>
+				)}
+			</div>
+		</div>
+	);
+}
@@ -0,0 +1,119 @@
+import { useState } from "react";
+import { useAuth } from "../../hooks/useAuth";
+
+const inputStyle = {
+	width: "100%",
+	fontFamily: "Inter, system-ui, sans-serif",
+	fontSize: 14,
+	padding: 10,
+	boxSizing: "border-box" as const,
+	border: "1px solid #d1d5db",
+	borderRadius: 6,
+};
+
+const labelStyle = { display: "block", margin: "12px 0 6px", color: "#444" };
+
+// ChangePassword lets the signed-in user pick a new password. The server
+// signs out every other session and returns a fresh token pair.
+export function ChangePassword() {
+	const { token } = useAuth();
+	const [currentPassword, setCurrentPassword] = useState("");
+	const [newPassword, setNewPassword] = useState("");
+	const [confirmPassword, setConfirmPassword] = useState("");
+	const [saving, setSaving] = useState(false);
+	const [error, setError] = useState("");
+
+	const handleSubmit = async (e: React.FormEvent) => {
+		e.preventDefault();
+		if (newPassword !== confirmPassword) {
+			setError("Passwords do not match");
+			return;
+		}
+
+		setSaving(true);
+		setError("");
+		try {
+			const res = await fetch("/api/auth/password", {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token}`,
+				},
+				body: JSON.stringify({ currentPassword, newPassword }),
+			});
+			if (!res.ok) {
+				setError((await res.text()).trim() || "Could not change password");
+				return;
+			}
+			const data = await res.json();
+			localStorage.setItem("auth_token", data.token);
+			localStorage.setItem("refresh_token", data.refreshToken);
+			window.location.reload();
+		} catch (e) {
+			console.error("ChangePassword: Request failed", e);
+			setError("Could not change password. Please try again.");
+		} finally {
+			setSaving(false);
+		}
+	};
+
+	return (
+		<form
+			onSubmit={handleSubmit}
+			style={{ marginTop: "32px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}
+		>
+			<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
+				Password
+			</h3>
+			<div style={{ fontSize: "12px", color: "#666" }}>
+				Changing your password signs out all other devices.
+			</div>
+			{error && <div className="error-message">{error}</div>}
+
+			<label style={labelStyle}>Current password</label>
+			<input
+				type="password"
+				autoComplete="current-password"
+				value={currentPassword}
+				onChange={(e) => setCurrentPassword(e.target.value)}
+				style={inputStyle}
+				disabled={saving}
+			/>
+			<label style={labelStyle}>New password</label>
+			<input
+				type="password"
+				autoComplete="new-password"
+				value={newPassword}
+				onChange={(e) => setNewPassword(e.target.value)}
+				style={inputStyle}
+				disabled={saving}
+			/>
+			<label style={labelStyle}>Confirm new password</label>
+			<input
+				type="password"
+				autoComplete="new-password"
+				value={confirmPassword}
+				onChange={(e) => setConfirmPassword(e.target.value)}
+				style={inputStyle}
+				disabled={saving}
+			/>
+
+			<div style={{ marginTop: 20 }}>
+				<button
+					type="submit"
+					disabled={saving || !currentPassword || !newPassword}
+					style={{
+						background: "#fff",
+						border: "1px solid #d1d5db",
+						borderRadius: 8,
+						padding: "8px 12px",
+						cursor: saving ? "default" : "pointer",
+						opacity: saving ? 0.6 : 1,
+					}}
+				>
+					{saving ? "Saving..." : "Change password"}
+				</button>
+			</div>
+		</form>
+	);
+}
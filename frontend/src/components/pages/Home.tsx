@@ -8,7 +8,7 @@ import { ContextMenu } from "../common/ContextMenu";
 import { ConfirmDialog } from "../common/ConfirmDialog";
 import { PrivacyToggle } from "../common/PrivacyToggle";
 import { type Note, type ContextMenuState, type ConfirmDialogState } from "../../types";
-import { formatDate } from "../../utils";
+import { formatDate, noteDate } from "../../utils";
 import { navigateTo } from "../../lib/router";
 import { Link } from "../common/Link";
 
@@ -129,16 +129,16 @@ export const Home = memo(function Home() {
 											/>
 										)}
 										<Link
-											href={`/posts/${p.id}`}
+											href={`/posts/${p.slug || p.id}`}
 											className="post-link group"
 											style={{ flex: 1 }}
 										>
 											<span className="post-title group-underline">
 												{p.title && p.title.trim() ? p.title : "Untitled"}
 											</span>
-											{p.updatedAt && (
+											{noteDate(p, isAuthenticated) && (
 												<span className="post-meta">
-													— {formatDate(p.updatedAt)}
+													— {formatDate(noteDate(p, isAuthenticated)!)}
 												</span>
 											)}
 										</Link>
@@ -0,0 +1,164 @@
+import { useState, useEffect, useCallback } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { formatDate } from "../../utils";
+import { createPasskey, passkeysSupported } from "../../lib/webauthn";
+
+type Passkey = {
+	id: number;
+	name: string;
+	createdAt: string;
+	lastUsedAt?: string;
+};
+
+// PasskeySettings registers passkeys for passwordless sign-in and lists the
+// ones already on this account
+export function PasskeySettings() {
+	const { token } = useAuth();
+	const [passkeys, setPasskeys] = useState<Passkey[]>([]);
+	const [name, setName] = useState("");
+	const [busy, setBusy] = useState(false);
+	const [error, setError] = useState("");
+
+	const load = useCallback(async () => {
+		if (!token) return;
+		try {
+			const res = await fetch("/api/auth/passkeys", {
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to load passkeys: ${res.status}`);
+			setPasskeys(await res.json());
+		} catch (e) {
+			console.error("PasskeySettings: Failed to load passkeys", e);
+		}
+	}, [token]);
+
+	useEffect(() => {
+		load();
+	}, [load]);
+
+	const add = async () => {
+		setBusy(true);
+		setError("");
+		try {
+			const optionsRes = await fetch("/api/auth/passkeys/register/options", {
+				method: "POST",
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!optionsRes.ok) throw new Error(`Failed to start registration: ${optionsRes.status}`);
+			const credential = await createPasskey(await optionsRes.json());
+			const res = await fetch("/api/auth/passkeys/register", {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token}`,
+				},
+				body: JSON.stringify({ name, credential }),
+			});
+			if (!res.ok) {
+				setError((await res.text()).trim() || "Could not add passkey");
+				return;
+			}
+			setName("");
+			await load();
+		} catch (e) {
+			console.error("PasskeySettings: Registration failed", e);
+			setError("Could not add passkey");
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	const remove = async (passkey: Passkey) => {
+		if (!confirm(`Remove the passkey "${passkey.name}"?`)) return;
+		setBusy(true);
+		try {
+			const res = await fetch(`/api/auth/passkeys/${passkey.id}`, {
+				method: "DELETE",
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to remove passkey: ${res.status}`);
+			await load();
+		} catch (e) {
+			console.error("PasskeySettings: Failed to remove passkey", e);
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	if (!passkeysSupported()) return null;
+
+	return (
+		<div style={{ marginTop: "32px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}>
+			<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
+				Passkeys
+			</h3>
+			<div style={{ fontSize: "12px", color: "#666" }}>
+				Sign in with your fingerprint, face or device PIN instead of a password.
+			</div>
+			{error && <div className="error-message">{error}</div>}
+			<ul style={{ listStyle: "none", padding: 0, margin: "12px 0 0" }}>
+				{passkeys.map((p) => (
+					<li
+						key={p.id}
+						style={{ display: "flex", justifyContent: "space-between", gap: 12, padding: "8px 0", fontSize: 14 }}
+					>
+						<div>
+							<div>{p.name}</div>
+							<div style={{ fontSize: 12, color: "#666" }}>
+								added {formatDate(p.createdAt)}
+								{p.lastUsedAt && <> · last used {formatDate(p.lastUsedAt)}</>}
+							</div>
+						</div>
+						<button
+							onClick={() => remove(p)}
+							disabled={busy}
+							style={{
+								background: "transparent",
+								border: "1px solid #dc2626",
+								color: "#dc2626",
+								padding: "4px 8px",
+								borderRadius: 4,
+								fontSize: 12,
+								cursor: "pointer",
+								alignSelf: "center",
+							}}
+						>
+							Remove
+						</button>
+					</li>
+				))}
+			</ul>
+			<div style={{ display: "flex", gap: 8, marginTop: 12 }}>
+				<input
+					type="text"
+					placeholder="Name, e.g. Laptop"
+					value={name}
+					onChange={(e) => setName(e.target.value)}
+					disabled={busy}
+					maxLength={64}
+					style={{
+						flex: 1,
+						fontFamily: "Inter, system-ui, sans-serif",
+						fontSize: 14,
+						padding: 8,
+						border: "1px solid #d1d5db",
+						borderRadius: 6,
+					}}
+				/>
+				<button
+					onClick={add}
+					disabled={busy}
+					style={{
+						background: "#fff",
+						border: "1px solid #d1d5db",
+						borderRadius: 8,
+						padding: "8px 12px",
+						cursor: busy ? "default" : "pointer",
+					}}
+				>
+					Add passkey
+				</button>
+			</div>
+		</div>
+	);
+}
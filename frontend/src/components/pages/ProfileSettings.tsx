@@ -0,0 +1,214 @@
+import { useState, useEffect } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { type AuthorProfile, type ProfileLink } from "../../types";
+
+const inputStyle = {
+	width: "100%",
+	fontFamily: "Inter, system-ui, sans-serif",
+	fontSize: 14,
+	padding: 10,
+	boxSizing: "border-box" as const,
+	border: "1px solid #d1d5db",
+	borderRadius: 6,
+};
+
+const labelStyle = { display: "block", margin: "12px 0 6px", color: "#444" };
+
+// ProfileSettings edits the signed-in user's public author profile
+export function ProfileSettings() {
+	const { token } = useAuth();
+	const [profile, setProfile] = useState<AuthorProfile | null>(null);
+	const [uploading, setUploading] = useState(false);
+	const [saving, setSaving] = useState(false);
+
+	useEffect(() => {
+		if (!token) return;
+		const load = async () => {
+			try {
+				const res = await fetch("/api/profile", {
+					headers: { Authorization: `Bearer ${token}` },
+				});
+				if (!res.ok) throw new Error(`Failed to load profile: ${res.status}`);
+				setProfile(await res.json());
+			} catch (e) {
+				console.error("ProfileSettings: Failed to load profile", e);
+			}
+		};
+		load();
+	}, [token]);
+
+	if (!profile) return null;
+
+	const update = (patch: Partial<AuthorProfile>) => setProfile({ ...profile, ...patch });
+	const updateLink = (index: number, patch: Partial<ProfileLink>) =>
+		update({ links: profile.links.map((l, i) => (i === index ? { ...l, ...patch } : l)) });
+
+	const handleAvatarUpload = async (file: File) => {
+		setUploading(true);
+		try {
+			const formData = new FormData();
+			formData.append("file", file);
+			const res = await fetch("/api/uploads", {
+				method: "POST",
+				headers: { Authorization: `Bearer ${token}` },
+				body: formData,
+			});
+			if (!res.ok) throw new Error(`Upload failed: ${await res.text()}`);
+			const data = await res.json();
+			update({ avatar: data.url });
+		} catch (e: any) {
+			console.error("ProfileSettings: Avatar upload failed", e);
+			alert(`Failed to upload avatar: ${e.message}`);
+		} finally {
+			setUploading(false);
+		}
+	};
+
+	const handleSave = async () => {
+		setSaving(true);
+		try {
+			const res = await fetch("/api/profile", {
+				method: "PUT",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token}`,
+				},
+				body: JSON.stringify({
+					...profile,
+					links: profile.links.filter((l) => l.url.trim() !== ""),
+				}),
+			});
+			if (!res.ok) throw new Error(await res.text());
+			setProfile(await res.json());
+		} catch (e: any) {
+			console.error("ProfileSettings: Failed to save profile", e);
+			alert(`Failed to save profile: ${e.message}`);
+		} finally {
+			setSaving(false);
+		}
+	};
+
+	return (
+		<div style={{ marginTop: "32px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}>
+			<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
+				Author profile
+			</h3>
+			<div style={{ fontSize: "12px", color: "#666" }}>
+				Shown on <a href={`/authors/${encodeURIComponent(profile.username)}`}>your author page</a> and
+				in post metadata.
+			</div>
+
+			<label style={labelStyle}>Display name</label>
+			<input
+				type="text"
+				value={profile.displayName}
+				onChange={(e) => update({ displayName: e.target.value })}
+				style={inputStyle}
+				placeholder={profile.username}
+				disabled={saving}
+			/>
+
+			<label style={labelStyle}>Bio (HTML)</label>
+			<textarea
+				value={profile.bio}
+				onChange={(e) => update({ bio: e.target.value })}
+				style={{ ...inputStyle, minHeight: 100 }}
+				disabled={saving}
+			/>
+
+			<label style={labelStyle}>Avatar</label>
+			<input
+				type="file"
+				accept="image/*"
+				onChange={(e) => {
+					const file = e.target.files?.[0];
+					if (file) handleAvatarUpload(file);
+				}}
+				style={inputStyle}
+				disabled={saving || uploading}
+			/>
+			{profile.avatar && (
+				<div style={{ marginTop: 12 }}>
+					<img
+						src={profile.avatar}
+						alt="Avatar preview"
+						style={{ width: 64, height: 64, objectFit: "cover", borderRadius: "50%" }}
+					/>
+					<button
+						onClick={() => update({ avatar: "" })}
+						style={{
+							display: "block",
+							marginTop: 8,
+							background: "transparent",
+							border: "1px solid #dc2626",
+							color: "#dc2626",
+							padding: "4px 8px",
+							borderRadius: 4,
+							fontSize: 12,
+							cursor: "pointer",
+						}}
+						disabled={saving}
+					>
+						Remove avatar
+					</button>
+				</div>
+			)}
+
+			<label style={labelStyle}>Links</label>
+			{profile.links.map((link, i) => (
+				<div key={i} style={{ display: "flex", gap: 8, marginBottom: 8 }}>
+					<input
+						type="text"
+						value={link.label}
+						onChange={(e) => updateLink(i, { label: e.target.value })}
+						style={{ ...inputStyle, width: "30%" }}
+						placeholder="Label"
+						disabled={saving}
+					/>
+					<input
+						type="url"
+						value={link.url}
+						onChange={(e) => updateLink(i, { url: e.target.value })}
+						style={inputStyle}
+						placeholder="https://"
+						disabled={saving}
+					/>
+					<button
+						onClick={() => update({ links: profile.links.filter((_, j) => j !== i) })}
+						style={{ background: "transparent", border: "none", cursor: "pointer" }}
+						disabled={saving}
+						aria-label="Remove link"
+					>
+						×
+					</button>
+				</div>
+			))}
+			{profile.links.length < 10 && (
+				<button
+					onClick={() => update({ links: [...profile.links, { label: "", url: "" }] })}
+					style={{ background: "transparent", border: "none", color: "#2563eb", cursor: "pointer", padding: 0 }}
+					disabled={saving}
+				>
+					+ Add link
+				</button>
+			)}
+
+			<div style={{ marginTop: 20 }}>
+				<button
+					onClick={handleSave}
+					disabled={saving || uploading}
+					style={{
+						background: "#fff",
+						border: "1px solid #d1d5db",
+						borderRadius: 8,
+						padding: "8px 12px",
+						cursor: saving ? "default" : "pointer",
+						opacity: saving ? 0.6 : 1,
+					}}
+				>
+					{saving ? "Saving..." : "Save profile"}
+				</button>
+			</div>
+		</div>
+	);
+}
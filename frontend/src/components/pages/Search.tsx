@@ -0,0 +1,123 @@
+import { useEffect, useState } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { useSettings } from "../../hooks/useSettings";
+import { Header } from "../layout/Header";
+import { Link } from "../common/Link";
+import { formatDate } from "../../utils";
+import { navigateTo } from "../../lib/router";
+
+type SearchResult = {
+	id: number;
+	title?: string;
+	slug?: string;
+	snippet: string;
+	updatedAt?: string;
+	publishedAt?: string;
+	isPrivate: boolean;
+};
+
+export function Search() {
+	const { isAuthenticated, logout, token } = useAuth();
+	const { settings } = useSettings();
+	const [query, setQuery] = useState(
+		() => new URLSearchParams(window.location.search).get("q") ?? "",
+	);
+	const [results, setResults] = useState<SearchResult[]>([]);
+	const [loading, setLoading] = useState(false);
+	const [error, setError] = useState<string | null>(null);
+
+	useEffect(() => {
+		const q = query.trim();
+		if (!q) {
+			setResults([]);
+			return;
+		}
+
+		const controller = new AbortController();
+		const timer = window.setTimeout(async () => {
+			setLoading(true);
+			setError(null);
+			try {
+				const res = await fetch(`/api/search?q=${encodeURIComponent(q)}`, {
+					headers: token ? { Authorization: `Bearer ${token}` } : {},
+					signal: controller.signal,
+				});
+				if (!res.ok) throw new Error(`Search failed: ${res.status}`);
+				const data = await res.json();
+				setResults(data.results ?? []);
+				window.history.replaceState({}, "", `/search?q=${encodeURIComponent(q)}`);
+			} catch (e) {
+				if (controller.signal.aborted) return;
+				console.error("Search: request failed", e);
+				setError("Search is unavailable right now.");
+			} finally {
+				if (!controller.signal.aborted) setLoading(false);
+			}
+		}, 200);
+
+		return () => {
+			controller.abort();
+			window.clearTimeout(timer);
+		};
+	}, [query, token]);
+
+	return (
+		<div className="home-container">
+			<Header
+				siteTitle={settings.siteTitle}
+				isAuthenticated={isAuthenticated}
+				onLogout={logout}
+				onSettings={() => navigateTo("/settings")}
+				aboutEnabled={settings.aboutEnabled}
+			/>
+			<div className="home-content">
+				<h1>Search</h1>
+				<form
+					className="search-container"
+					action="/search"
+					method="get"
+					role="search"
+					onSubmit={(e) => e.preventDefault()}
+				>
+					<input
+						type="search"
+						name="q"
+						placeholder="Search posts..."
+						value={query}
+						onChange={(e) => setQuery(e.target.value)}
+						className="search-input"
+						autoFocus
+					/>
+				</form>
+
+				{error && <p>{error}</p>}
+				{!error && query.trim() && !loading && results.length === 0 && (
+					<p>No posts match your search.</p>
+				)}
+				{results.length > 0 && (
+					<ul className="post-list search-results">
+						{results.map((r) => (
+							<li key={r.id}>
+								<Link href={`/posts/${r.slug || r.id}`} className="post-link group">
+									<span className="post-title group-underline">
+										{r.title && r.title.trim() ? r.title : "Untitled"}
+									</span>
+									{(r.publishedAt ?? r.updatedAt) && (
+										<span className="post-meta">
+											{" "}
+											— {formatDate((r.publishedAt ?? r.updatedAt) as string)}
+										</span>
+									)}
+								</Link>
+								<p
+									className="search-snippet"
+									dangerouslySetInnerHTML={{ __html: r.snippet }}
+								/>
+							</li>
+						))}
+					</ul>
+				)}
+			</div>
+		</div>
+	);
+}
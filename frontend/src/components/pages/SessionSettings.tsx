@@ -0,0 +1,131 @@
+import { useState, useEffect, useCallback } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { formatDate } from "../../utils";
+
+type Session = {
+	id: number;
+	createdAt: string;
+	lastUsedAt?: string;
+	expiresAt: string;
+	userAgent: string;
+	ip: string;
+	current: boolean;
+};
+
+// SessionSettings lists the devices signed in to this account and lets the
+// user sign them out
+export function SessionSettings() {
+	const { token, logout } = useAuth();
+	const [sessions, setSessions] = useState<Session[]>([]);
+	const [busy, setBusy] = useState(false);
+
+	const load = useCallback(async () => {
+		if (!token) return;
+		try {
+			const res = await fetch("/api/auth/sessions", {
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to load sessions: ${res.status}`);
+			setSessions(await res.json());
+		} catch (e) {
+			console.error("SessionSettings: Failed to load sessions", e);
+		}
+	}, [token]);
+
+	useEffect(() => {
+		load();
+	}, [load]);
+
+	const revoke = async (session: Session) => {
+		setBusy(true);
+		try {
+			const res = await fetch(`/api/auth/sessions/${session.id}`, {
+				method: "DELETE",
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to revoke session: ${res.status}`);
+			if (session.current) {
+				logout();
+				window.location.assign("/");
+				return;
+			}
+			await load();
+		} catch (e) {
+			console.error("SessionSettings: Failed to revoke session", e);
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	const revokeAll = async () => {
+		if (!confirm("Sign out of every device, including this one?")) return;
+		setBusy(true);
+		try {
+			await fetch("/api/auth/sessions", {
+				method: "DELETE",
+				headers: { Authorization: `Bearer ${token}` },
+			});
+		} catch (e) {
+			console.error("SessionSettings: Failed to log out everywhere", e);
+		}
+		logout();
+		window.location.assign("/");
+	};
+
+	return (
+		<div style={{ marginTop: "32px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}>
+			<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
+				Sessions
+			</h3>
+			<ul style={{ listStyle: "none", padding: 0, margin: 0 }}>
+				{sessions.map((s) => (
+					<li
+						key={s.id}
+						style={{ display: "flex", justifyContent: "space-between", gap: 12, padding: "8px 0", fontSize: 14 }}
+					>
+						<div>
+							<div>
+								{s.userAgent || "Unknown device"}
+								{s.current && <strong> (this device)</strong>}
+							</div>
+							<div style={{ fontSize: 12, color: "#666" }}>
+								{s.ip} · signed in {formatDate(s.createdAt)}
+								{s.lastUsedAt && <> · last active {formatDate(s.lastUsedAt)}</>}
+							</div>
+						</div>
+						<button
+							onClick={() => revoke(s)}
+							disabled={busy}
+							style={{
+								background: "transparent",
+								border: "1px solid #dc2626",
+								color: "#dc2626",
+								padding: "4px 8px",
+								borderRadius: 4,
+								fontSize: 12,
+								cursor: "pointer",
+								alignSelf: "center",
+							}}
+						>
+							Sign out
+						</button>
+					</li>
+				))}
+			</ul>
+			<button
+				onClick={revokeAll}
+				disabled={busy}
+				style={{
+					marginTop: 12,
+					background: "#fff",
+					border: "1px solid #d1d5db",
+					borderRadius: 8,
+					padding: "8px 12px",
+					cursor: busy ? "default" : "pointer",
+				}}
+			>
+				Log out everywhere
+			</button>
+		</div>
+	);
+}
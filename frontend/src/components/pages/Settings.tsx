@@ -2,6 +2,13 @@ import { useState, useEffect } from "react";
 import { useAuth } from "../../hooks/useAuth";
 import { Header } from "../layout/Header";
 import { navigateTo } from "../../lib/router";
+import { ProfileSettings } from "./ProfileSettings";
+import { ChangePassword } from "./ChangePassword";
+import { SessionSettings } from "./SessionSettings";
+import { PasskeySettings } from "./PasskeySettings";
+import { TwoFactorSettings } from "./TwoFactorSettings";
+import { ApiTokenSettings } from "./ApiTokenSettings";
+import { UploadSettings } from "./UploadSettings";
 
 export function Settings() {
 	const { isAuthenticated, token, logout } = useAuth();
@@ -9,7 +16,11 @@ export function Settings() {
 	const [siteTitle, setSiteTitle] = useState<string>("");
 	const [heroImage, setHeroImage] = useState<string>("");
 	const [aboutEnabled, setAboutEnabled] = useState<boolean>(false);
+	const [robotsTxt, setRobotsTxt] = useState<string>("");
+	const [siteUrl, setSiteUrl] = useState<string>("");
 	const [openaiApiKey, setOpenaiApiKey] = useState<string>("");
+	const [openaiKeyConfigured, setOpenaiKeyConfigured] = useState(false);
+	const [replacingOpenaiKey, setReplacingOpenaiKey] = useState(false);
 	const [aiEnabled, setAiEnabled] = useState<boolean>(false);
 	const [logLevel, setLogLevel] = useState<string>("INFO");
 	const [uploading, setUploading] = useState(false);
@@ -19,9 +30,12 @@ export function Settings() {
 	useEffect(() => {
 		const loadSettings = async () => {
 			try {
-				// Load settings and log level in parallel
+				// Load settings and log level in parallel. Signed-in requests also
+				// report whether secrets such as the OpenAI key are set.
 				const [settingsRes, logRes] = await Promise.all([
-					fetch("/api/settings"),
+					fetch("/api/settings", {
+						headers: token ? { Authorization: `Bearer ${token}` } : {},
+					}),
 					fetch("/api/settings/log-level")
 				]);
 				
@@ -31,7 +45,9 @@ export function Settings() {
 					setSiteTitle(data.siteTitle || "");
 					setHeroImage(data.heroImage || "");
 					setAboutEnabled(data.aboutEnabled === "true");
-					setOpenaiApiKey(data.openai_api_key || "");
+					setRobotsTxt(data.robotsTxt || "");
+					setSiteUrl(data.site_url || "");
+					setOpenaiKeyConfigured(data.openai_api_key_configured === "true");
 					setAiEnabled(data.ai_enabled === "true");
 				}
 				
@@ -46,7 +62,7 @@ export function Settings() {
 			}
 		};
 		loadSettings();
-	}, []);
+	}, [token]);
 
 	const handleImageUpload = async (file: File) => {
 		if (!isAuthenticated || !token) return;
@@ -162,6 +178,40 @@ export function Settings() {
 
 			const aboutResult = await aboutRes.json();
 
+			// Save public site URL
+			const siteUrlRes = await fetch("/api/settings", {
+				method: "PUT",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token}`,
+				},
+				body: JSON.stringify({ key: "site_url", value: siteUrl }),
+			});
+
+			if (!siteUrlRes.ok) {
+				const errorText = await siteUrlRes.text();
+				throw new Error(
+					`Failed to save site URL: ${siteUrlRes.status} - ${errorText}`,
+				);
+			}
+
+			// Save robots.txt rules
+			const robotsRes = await fetch("/api/settings", {
+				method: "PUT",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token}`,
+				},
+				body: JSON.stringify({ key: "robotsTxt", value: robotsTxt }),
+			});
+
+			if (!robotsRes.ok) {
+				const errorText = await robotsRes.text();
+				throw new Error(
+					`Failed to save robots.txt: ${robotsRes.status} - ${errorText}`,
+				);
+			}
+
 			// Save AI settings
 			const aiEnabledRes = await fetch("/api/settings", {
 				method: "PUT",
@@ -196,6 +246,9 @@ export function Settings() {
 						`Failed to save OpenAI API key: ${apiKeyRes.status} - ${errorText}`,
 					);
 				}
+				setOpenaiApiKey("");
+				setOpenaiKeyConfigured(true);
+				setReplacingOpenaiKey(false);
 			}
 
 			// Save log level
@@ -427,6 +480,59 @@ export function Settings() {
 						</div>
 					</div>
 
+					<div style={{ marginBottom: "24px" }}>
+						<label
+							style={{ display: "block", margin: "12px 0 6px", color: "#444" }}
+						>
+							Site URL
+						</label>
+						<input
+							type="url"
+							value={siteUrl}
+							onChange={(e) => setSiteUrl(e.target.value)}
+							style={{
+								width: "100%",
+								fontFamily: "Inter, system-ui, sans-serif",
+								fontSize: 14,
+								padding: 10,
+								boxSizing: "border-box",
+								border: "1px solid #d1d5db",
+								borderRadius: 6,
+							}}
+							placeholder="https://yourdomain.com"
+							disabled={saving}
+						/>
+						<div style={{ fontSize: "12px", color: "#666", marginTop: "4px" }}>
+							Used for canonical links, feeds and the sitemap. The NOET_BASE_URL
+							environment variable takes precedence
+						</div>
+
+						<label
+							style={{ display: "block", margin: "12px 0 6px", color: "#444" }}
+						>
+							robots.txt rules
+						</label>
+						<textarea
+							value={robotsTxt}
+							onChange={(e) => setRobotsTxt(e.target.value)}
+							rows={5}
+							style={{
+								width: "100%",
+								fontFamily: "ui-monospace, SFMono-Regular, Menlo, monospace",
+								fontSize: 13,
+								padding: 10,
+								boxSizing: "border-box",
+								border: "1px solid #d1d5db",
+								borderRadius: 6,
+							}}
+							placeholder={"User-agent: *\nDisallow: /api/"}
+							disabled={saving}
+						/>
+						<div style={{ fontSize: "12px", color: "#666", marginTop: "4px" }}>
+							Leave empty for the defaults. A Sitemap line is added automatically
+						</div>
+					</div>
+
 					{/* AI Settings Section */}
 					<div style={{ marginBottom: "24px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}>
 						<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
@@ -458,22 +564,43 @@ export function Settings() {
 								>
 									OpenAI API Key
 								</label>
-								<input
-									type="password"
-									value={openaiApiKey}
-									onChange={(e) => setOpenaiApiKey(e.target.value)}
-									style={{
-										width: "100%",
-										fontFamily: "Inter, system-ui, sans-serif",
-										fontSize: 14,
-										padding: 10,
-										boxSizing: "border-box",
-										border: "1px solid #d1d5db",
-										borderRadius: 6,
-									}}
-									placeholder="sk-..."
-									disabled={saving}
-								/>
+								{openaiKeyConfigured && !replacingOpenaiKey ? (
+									<div style={{ display: "flex", alignItems: "center", gap: 12, fontSize: 14, color: "#444" }}>
+										<span>A key is configured</span>
+										<button
+											type="button"
+											onClick={() => setReplacingOpenaiKey(true)}
+											disabled={saving}
+											style={{
+												background: "#fff",
+												border: "1px solid #d1d5db",
+												borderRadius: 6,
+												padding: "4px 10px",
+												cursor: saving ? "default" : "pointer",
+											}}
+										>
+											Replace key
+										</button>
+									</div>
+								) : (
+									<input
+										type="password"
+										value={openaiApiKey}
+										onChange={(e) => setOpenaiApiKey(e.target.value)}
+										style={{
+											width: "100%",
+											fontFamily: "Inter, system-ui, sans-serif",
+											fontSize: 14,
+											padding: 10,
+											boxSizing: "border-box",
+											border: "1px solid #d1d5db",
+											borderRadius: 6,
+										}}
+										placeholder={openaiKeyConfigured ? "New key, sk-..." : "sk-..."}
+										autoComplete="off"
+										disabled={saving}
+									/>
+								)}
 								<div style={{ fontSize: "12px", color: "#666", marginTop: "4px" }}>
 									Your OpenAI API key is stored securely and never exposed to the frontend.{" "}
 									<a 
@@ -555,6 +682,14 @@ export function Settings() {
 							Cancel
 						</button>
 					</div>
+
+					<ProfileSettings />
+					<ChangePassword />
+					<SessionSettings />
+					<PasskeySettings />
+					<TwoFactorSettings />
+					<ApiTokenSettings />
+					<UploadSettings />
 				</main>
 			</div>
 		</>
@@ -0,0 +1,77 @@
+import { useEffect, useState } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { useSettings } from "../../hooks/useSettings";
+import { Header } from "../layout/Header";
+import { Link } from "../common/Link";
+import { type Note } from "../../types";
+import { formatDate } from "../../utils";
+import { navigateTo } from "../../lib/router";
+
+export function Tag({ tag }: { tag: string }) {
+	const { isAuthenticated, logout, token } = useAuth();
+	const { settings } = useSettings();
+	const [posts, setPosts] = useState<Note[]>([]);
+	const [loading, setLoading] = useState(true);
+	const [error, setError] = useState<string | null>(null);
+
+	useEffect(() => {
+		const controller = new AbortController();
+		const load = async () => {
+			setLoading(true);
+			setError(null);
+			try {
+				const res = await fetch(`/api/posts?tag=${encodeURIComponent(tag)}`, {
+					headers: token ? { Authorization: `Bearer ${token}` } : {},
+					signal: controller.signal,
+				});
+				if (!res.ok) throw new Error(`Failed to load posts: ${res.status}`);
+				setPosts((await res.json()) ?? []);
+			} catch (e) {
+				if (controller.signal.aborted) return;
+				console.error("Tag: Failed to load posts", { tag, error: e });
+				setError("Failed to load posts.");
+			} finally {
+				if (!controller.signal.aborted) setLoading(false);
+			}
+		};
+		load();
+		return () => controller.abort();
+	}, [tag, token]);
+
+	return (
+		<div className="home-container">
+			<Header
+				siteTitle={settings.siteTitle}
+				isAuthenticated={isAuthenticated}
+				onLogout={logout}
+				onSettings={() => navigateTo("/settings")}
+				aboutEnabled={settings.aboutEnabled}
+			/>
+			<div className="home-content">
+				<h1>#{tag}</h1>
+				<p className="post-meta">
+					<a href={`/tags/${encodeURIComponent(tag)}/rss.xml`}>RSS feed</a>
+				</p>
+				{loading && posts.length === 0 && <p>Loading…</p>}
+				{error && <p>{error}</p>}
+				{!loading && !error && posts.length === 0 && <p>No posts with this tag.</p>}
+				{posts.length > 0 && (
+					<ul className="post-list">
+						{posts.map((p) => (
+							<li key={p.id}>
+								<Link href={`/posts/${p.slug || p.id}`} className="post-link group">
+									<span className="post-title group-underline">
+										{p.title && p.title.trim() ? p.title : "Untitled"}
+									</span>
+									{p.updatedAt && (
+										<span className="post-meta"> — {formatDate(p.updatedAt)}</span>
+									)}
+								</Link>
+							</li>
+						))}
+					</ul>
+				)}
+			</div>
+		</div>
+	);
+}
@@ -0,0 +1,207 @@
+import { useState, useEffect, useCallback } from "react";
+import { useAuth } from "../../hooks/useAuth";
+
+const inputStyle = {
+	width: "100%",
+	fontFamily: "Inter, system-ui, sans-serif",
+	fontSize: 14,
+	padding: 10,
+	boxSizing: "border-box" as const,
+	border: "1px solid #d1d5db",
+	borderRadius: 6,
+};
+
+const labelStyle = { display: "block", margin: "12px 0 6px", color: "#444" };
+
+const buttonStyle = {
+	background: "#fff",
+	border: "1px solid #d1d5db",
+	borderRadius: 8,
+	padding: "8px 12px",
+	cursor: "pointer",
+};
+
+type Status = {
+	enabled: boolean;
+	recoveryCodesRemaining: number;
+};
+
+type Setup = {
+	secret: string;
+	uri: string;
+};
+
+// TwoFactorSettings enrolls an authenticator app and shows the recovery
+// codes once, right after they are generated
+export function TwoFactorSettings() {
+	const { token } = useAuth();
+	const [status, setStatus] = useState<Status | null>(null);
+	const [setup, setSetup] = useState<Setup | null>(null);
+	const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+	const [code, setCode] = useState("");
+	const [password, setPassword] = useState("");
+	const [busy, setBusy] = useState(false);
+	const [error, setError] = useState("");
+
+	const load = useCallback(async () => {
+		if (!token) return;
+		try {
+			const res = await fetch("/api/auth/totp", {
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to load two-factor status: ${res.status}`);
+			setStatus(await res.json());
+		} catch (e) {
+			console.error("TwoFactorSettings: Failed to load status", e);
+		}
+	}, [token]);
+
+	useEffect(() => {
+		load();
+	}, [load]);
+
+	const post = async (path: string, body?: object) => {
+		setBusy(true);
+		setError("");
+		try {
+			const res = await fetch(path, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token}`,
+				},
+				body: body ? JSON.stringify(body) : undefined,
+			});
+			if (!res.ok) {
+				setError((await res.text()).trim() || "Request failed");
+				return null;
+			}
+			return res.status === 204 ? {} : await res.json();
+		} catch (e) {
+			console.error("TwoFactorSettings: Request failed", e);
+			setError("Request failed. Please try again.");
+			return null;
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	const begin = async () => {
+		const data = await post("/api/auth/totp/setup");
+		if (data) {
+			setSetup(data);
+			setCode("");
+		}
+	};
+
+	const enable = async (e: React.FormEvent) => {
+		e.preventDefault();
+		const data = await post("/api/auth/totp/enable", { code });
+		if (data) {
+			setSetup(null);
+			setCode("");
+			setRecoveryCodes(data.recoveryCodes);
+			await load();
+		}
+	};
+
+	const disable = async (e: React.FormEvent) => {
+		e.preventDefault();
+		const data = await post("/api/auth/totp/disable", { password, code });
+		if (data) {
+			setPassword("");
+			setCode("");
+			setRecoveryCodes([]);
+			await load();
+		}
+	};
+
+	if (!status) return null;
+
+	return (
+		<div style={{ marginTop: "32px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}>
+			<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
+				Two-factor authentication
+			</h3>
+			{error && <div className="error-message">{error}</div>}
+
+			{recoveryCodes.length > 0 && (
+				<div style={{ fontSize: 14, marginBottom: 16 }}>
+					<div style={{ color: "#444" }}>
+						Save these recovery codes somewhere safe. Each one signs you in once if you
+						lose your authenticator. They will not be shown again.
+					</div>
+					<pre style={{ background: "#f9fafb", padding: 12, borderRadius: 6 }}>
+						{recoveryCodes.join("\n")}
+					</pre>
+				</div>
+			)}
+
+			{status.enabled ? (
+				<form onSubmit={disable}>
+					<div style={{ fontSize: "12px", color: "#666" }}>
+						Enabled. {status.recoveryCodesRemaining} recovery codes left.
+					</div>
+					<label style={labelStyle}>Password</label>
+					<input
+						type="password"
+						autoComplete="current-password"
+						value={password}
+						onChange={(e) => setPassword(e.target.value)}
+						style={inputStyle}
+						disabled={busy}
+					/>
+					<label style={labelStyle}>Authentication or recovery code</label>
+					<input
+						type="text"
+						autoComplete="one-time-code"
+						value={code}
+						onChange={(e) => setCode(e.target.value)}
+						style={inputStyle}
+						disabled={busy}
+					/>
+					<div style={{ marginTop: 20 }}>
+						<button type="submit" disabled={busy || !password || !code} style={buttonStyle}>
+							Disable two-factor authentication
+						</button>
+					</div>
+				</form>
+			) : setup ? (
+				<form onSubmit={enable}>
+					<div style={{ fontSize: 14, color: "#444" }}>
+						Add this account to your authenticator app by opening the{" "}
+						<a href={setup.uri}>setup link</a> on your phone or entering the key
+						manually:
+					</div>
+					<code style={{ display: "block", margin: "8px 0", wordBreak: "break-all" }}>
+						{setup.secret}
+					</code>
+					<label style={labelStyle}>Code from the app</label>
+					<input
+						type="text"
+						inputMode="numeric"
+						autoComplete="one-time-code"
+						value={code}
+						onChange={(e) => setCode(e.target.value)}
+						style={inputStyle}
+						disabled={busy}
+					/>
+					<div style={{ marginTop: 20 }}>
+						<button type="submit" disabled={busy || !code} style={buttonStyle}>
+							Turn on
+						</button>
+					</div>
+				</form>
+			) : (
+				<>
+					<div style={{ fontSize: "12px", color: "#666" }}>
+						Require a code from an authenticator app when signing in.
+					</div>
+					<button onClick={begin} disabled={busy} style={{ ...buttonStyle, marginTop: 12 }}>
+						Set up
+					</button>
+				</>
+			)}
+		</div>
+	);
+}
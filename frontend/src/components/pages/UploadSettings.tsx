@@ -0,0 +1,220 @@
+import { useState, useEffect, useCallback } from "react";
+import { useAuth } from "../../hooks/useAuth";
+import { formatDate } from "../../utils";
+
+type UploadRef = {
+	kind: "post" | "revision" | "about" | "hero" | "intro" | "avatar";
+	postId?: number;
+	title?: string;
+	username?: string;
+};
+
+type Upload = {
+	id: number;
+	filename: string;
+	originalName: string;
+	url: string;
+	width?: number;
+	height?: number;
+	totalSize: number;
+	createdAt: string;
+	references: UploadRef[];
+};
+
+type Usage = {
+	files: number;
+	bytes: number;
+	quota: number;
+};
+
+const PAGE_SIZE = 20;
+
+const formatBytes = (n: number): string => {
+	if (n >= 1 << 30) return `${(n / (1 << 30)).toFixed(1)} GB`;
+	if (n >= 1 << 20) return `${(n / (1 << 20)).toFixed(1)} MB`;
+	if (n >= 1 << 10) return `${Math.round(n / (1 << 10))} KB`;
+	return `${n} B`;
+};
+
+const describeRef = (ref: UploadRef): string => {
+	switch (ref.kind) {
+		case "post":
+			return ref.title || `post ${ref.postId}`;
+		case "revision":
+			return `an earlier version of ${ref.title || `post ${ref.postId}`}`;
+		case "avatar":
+			return `${ref.username}'s avatar`;
+		case "hero":
+			return "hero image";
+		default:
+			return `${ref.kind} page`;
+	}
+};
+
+// UploadSettings lists uploaded images with where they are used. Editors can
+// delete them and admins can clean up images nothing uses.
+export function UploadSettings() {
+	const { token, user } = useAuth();
+	const [uploads, setUploads] = useState<Upload[]>([]);
+	const [usage, setUsage] = useState<Usage | null>(null);
+	const [nextBefore, setNextBefore] = useState(0);
+	const [busy, setBusy] = useState(false);
+	const [message, setMessage] = useState("");
+	const canDelete = user?.role === "admin" || user?.role === "editor";
+
+	const load = useCallback(
+		async (before = 0) => {
+			if (!token) return;
+			try {
+				const query = before ? `&before=${before}` : "";
+				const res = await fetch(`/api/uploads?limit=${PAGE_SIZE}${query}`, {
+					headers: { Authorization: `Bearer ${token}` },
+				});
+				if (!res.ok) throw new Error(`Failed to load uploads: ${res.status}`);
+				const data = await res.json();
+				setUploads((prev) => (before ? [...prev, ...data.uploads] : data.uploads));
+				setUsage(data.usage);
+				setNextBefore(data.nextBefore || 0);
+			} catch (e) {
+				console.error("UploadSettings: Failed to load uploads", e);
+			}
+		},
+		[token],
+	);
+
+	useEffect(() => {
+		load();
+	}, [load]);
+
+	const remove = async (u: Upload) => {
+		const used = u.references.length > 0;
+		const prompt = used
+			? `"${u.originalName}" is still used by ${u.references.map(describeRef).join(", ")}. Delete it anyway?`
+			: `Delete "${u.originalName}"?`;
+		if (!confirm(prompt)) return;
+		setBusy(true);
+		try {
+			const res = await fetch(`/api/uploads/${u.filename}${used ? "?force=true" : ""}`, {
+				method: "DELETE",
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			if (!res.ok) throw new Error(`Failed to delete upload: ${res.status}`);
+			await load();
+		} catch (e) {
+			console.error("UploadSettings: Failed to delete upload", e);
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	const collect = async () => {
+		setBusy(true);
+		setMessage("");
+		try {
+			const headers = { Authorization: `Bearer ${token}` };
+			const res = await fetch("/api/uploads/gc", { headers });
+			if (!res.ok) throw new Error(`Failed to find unused uploads: ${res.status}`);
+			const report = await res.json();
+			if (report.orphans.length === 0) {
+				setMessage("No unused images to remove.");
+				return;
+			}
+			const size = report.orphans.reduce((sum: number, u: Upload) => sum + u.totalSize, 0);
+			if (!confirm(`Remove ${report.orphans.length} unused images (${formatBytes(size)})?`)) return;
+			const done = await fetch("/api/uploads/gc", { method: "POST", headers });
+			if (!done.ok) throw new Error(`Failed to remove unused uploads: ${done.status}`);
+			const result = await done.json();
+			setMessage(`Removed ${result.removed} images and freed ${formatBytes(result.freedBytes)}.`);
+			await load();
+		} catch (e) {
+			console.error("UploadSettings: Failed to remove unused uploads", e);
+		} finally {
+			setBusy(false);
+		}
+	};
+
+	const buttonStyle = {
+		background: "#fff",
+		border: "1px solid #d1d5db",
+		borderRadius: 8,
+		padding: "8px 12px",
+		cursor: busy ? "default" : "pointer",
+	};
+
+	return (
+		<div style={{ marginTop: "32px", paddingTop: "24px", borderTop: "1px solid #e5e7eb" }}>
+			<h3 style={{ fontWeight: 500, fontSize: "16px", margin: "0 0 16px", color: "#111" }}>
+				Uploaded images
+			</h3>
+			{usage && (
+				<div style={{ fontSize: "12px", color: "#666" }}>
+					{usage.files} images using {formatBytes(usage.bytes)}
+					{usage.quota > 0 && <> of {formatBytes(usage.quota)}</>}
+				</div>
+			)}
+			{message && <div style={{ fontSize: 14, margin: "12px 0", color: "#444" }}>{message}</div>}
+
+			<ul style={{ listStyle: "none", padding: 0, margin: "12px 0 0" }}>
+				{uploads.map((u) => (
+					<li
+						key={u.id}
+						style={{ display: "flex", alignItems: "center", gap: 12, padding: "8px 0", fontSize: 14 }}
+					>
+						<img
+							src={u.url}
+							alt=""
+							loading="lazy"
+							style={{ width: 48, height: 48, objectFit: "cover", borderRadius: 4, flexShrink: 0 }}
+						/>
+						<div style={{ flex: 1, minWidth: 0 }}>
+							<div style={{ overflow: "hidden", textOverflow: "ellipsis", whiteSpace: "nowrap" }}>
+								{u.originalName}
+							</div>
+							<div style={{ fontSize: 12, color: "#666" }}>
+								{u.width && u.height ? <>{u.width}×{u.height} · </> : null}
+								{formatBytes(u.totalSize)} · uploaded {formatDate(u.createdAt)} ·{" "}
+								{u.references.length > 0 ? <>used by {u.references.map(describeRef).join(", ")}</> : "unused"}
+							</div>
+						</div>
+						<button
+							onClick={() => navigator.clipboard.writeText(u.url)}
+							style={{ ...buttonStyle, padding: "4px 8px", borderRadius: 4, fontSize: 12 }}
+						>
+							Copy URL
+						</button>
+						{canDelete && (
+							<button
+								onClick={() => remove(u)}
+								disabled={busy}
+								style={{
+									background: "transparent",
+									border: "1px solid #dc2626",
+									color: "#dc2626",
+									padding: "4px 8px",
+									borderRadius: 4,
+									fontSize: 12,
+									cursor: "pointer",
+								}}
+							>
+								Delete
+							</button>
+						)}
+					</li>
+				))}
+			</ul>
+
+			<div style={{ display: "flex", gap: 8, marginTop: 12 }}>
+				{nextBefore > 0 && (
+					<button onClick={() => load(nextBefore)} disabled={busy} style={buttonStyle}>
+						Show more
+					</button>
+				)}
+				{user?.role === "admin" && (
+					<button onClick={collect} disabled={busy} style={buttonStyle}>
+						Remove unused images
+					</button>
+				)}
+			</div>
+		</div>
+	);
+}
@@ -213,9 +213,11 @@ export function usePosts(token: string | null) {
 	const togglePrivacy = useCallback(async (postId: number) => {
 		if (!token) return;
 		
+		const current = posts.find(p => p.id === postId);
+		const action = current && !current.isPrivate ? 'unpublish' : 'publish';
 		try {
-			const res = await fetch(`/api/posts/${postId}/publish`, {
-				method: 'PUT',
+			const res = await fetch(`/api/posts/${postId}/${action}`, {
+				method: 'POST',
 				headers: { Authorization: `Bearer ${token}` },
 			});
 			
@@ -226,7 +228,7 @@ export function usePosts(token: string | null) {
 		} catch (error) {
 			console.error("usePosts: Failed to toggle post privacy", { postId, error });
 		}
-	}, [token]);
+	}, [token, posts]);
 
 	return {
 		posts,
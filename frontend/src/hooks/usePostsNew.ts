@@ -29,16 +29,18 @@ export function usePosts(token: string | null) {
       if (!token) return;
       
       try {
+        const post = postsQuery.data?.find((p) => p.id === postId);
         await togglePrivacyMutation.mutateAsync({
           id: postId.toString(),
           token,
+          publish: post ? post.isPrivate : true,
         });
       } catch (error) {
         console.error('Failed to toggle post privacy:', error);
         throw error;
       }
     },
-    [token, togglePrivacyMutation]
+    [token, togglePrivacyMutation, postsQuery.data]
   );
 
   return {
@@ -27,7 +27,8 @@ async function fetchPosts(token: string | null): Promise<Note[]> {
   
   const data = await response.json();
   const posts = ensureArray(data);
-  return sortNotes(posts);
+  // Public lists arrive ordered by publication date; keep that order
+  return token ? sortNotes(posts) : posts;
 }
 
 // Fetch a single post
@@ -105,10 +106,10 @@ async function deletePost(id: string, token: string): Promise<void> {
   }
 }
 
-// Toggle post privacy
-async function togglePostPrivacy(id: string, token: string): Promise<Note> {
-  const response = await fetch(`/api/posts/${id}/publish`, {
-    method: 'PUT',
+// Publish or unpublish a post; both calls are idempotent
+async function togglePostPrivacy(id: string, token: string, publish: boolean): Promise<Note> {
+  const response = await fetch(`/api/posts/${id}/${publish ? 'publish' : 'unpublish'}`, {
+    method: 'POST',
     headers: {
       Authorization: `Bearer ${token}`,
       'Content-Type': 'application/json',
@@ -263,8 +264,8 @@ export function useTogglePostPrivacy() {
   const queryClient = useQueryClient();
   
   return useMutation({
-    mutationFn: ({ id, token }: { id: string; token: string }) =>
-      togglePostPrivacy(id, token),
+    mutationFn: ({ id, token, publish }: { id: string; token: string; publish: boolean }) =>
+      togglePostPrivacy(id, token, publish),
     onSuccess: (updatedPost) => {
       // Update the post in cache
       queryClient.setQueryData(postsQueryKeys.detail(updatedPost.id), updatedPost);
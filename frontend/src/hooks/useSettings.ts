@@ -7,7 +7,7 @@ export interface Settings {
 	heroImage: string;
 	aboutEnabled: boolean;
 	ai_enabled: boolean;
-	openai_api_key: string;
+	openai_api_key_configured: boolean;
 }
 
 const DEFAULT_SETTINGS: Settings = {
@@ -16,7 +16,7 @@ const DEFAULT_SETTINGS: Settings = {
 	heroImage: "",
 	aboutEnabled: false,
 	ai_enabled: false,
-	openai_api_key: "",
+	openai_api_key_configured: false,
 };
 
 export async function fetchSettings(): Promise<Settings> {
@@ -32,7 +32,7 @@ export async function fetchSettings(): Promise<Settings> {
 		heroImage: data.heroImage || "",
 		aboutEnabled: data.aboutEnabled === "true",
 		ai_enabled: data.ai_enabled === "true",
-		openai_api_key: data.openai_api_key || "",
+		openai_api_key_configured: data.openai_api_key_configured === "true",
 	};
 }
 
@@ -0,0 +1,83 @@
+// Helpers for the WebAuthn ceremonies. The server sends and expects binary
+// fields as base64url strings, the format of PublicKeyCredential.toJSON().
+
+const toBase64url = (buf: ArrayBuffer): string =>
+	btoa(String.fromCharCode(...new Uint8Array(buf)))
+		.replace(/\+/g, "-")
+		.replace(/\//g, "_")
+		.replace(/=+$/, "");
+
+const fromBase64url = (s: string): ArrayBuffer => {
+	const b64 = s.replace(/-/g, "+").replace(/_/g, "/");
+	const bin = atob(b64 + "=".repeat((4 - (b64.length % 4)) % 4));
+	return Uint8Array.from(bin, (c) => c.charCodeAt(0)).buffer;
+};
+
+type Descriptor = { type: "public-key"; id: string };
+
+export const passkeysSupported = (): boolean =>
+	typeof window !== "undefined" && !!window.PublicKeyCredential;
+
+// createPasskey runs navigator.credentials.create() with options from
+// /api/auth/passkeys/register/options
+export async function createPasskey(options: {
+	publicKey: Omit<PublicKeyCredentialCreationOptions, "challenge" | "user" | "excludeCredentials"> & {
+		challenge: string;
+		user: { id: string; name: string; displayName: string };
+		excludeCredentials: Descriptor[];
+	};
+}) {
+	const { publicKey } = options;
+	const cred = (await navigator.credentials.create({
+		publicKey: {
+			...publicKey,
+			challenge: fromBase64url(publicKey.challenge),
+			user: { ...publicKey.user, id: fromBase64url(publicKey.user.id) },
+			excludeCredentials: publicKey.excludeCredentials.map((c) => ({ ...c, id: fromBase64url(c.id) })),
+		},
+	})) as PublicKeyCredential | null;
+	if (!cred) throw new Error("Passkey creation was cancelled");
+
+	const response = cred.response as AuthenticatorAttestationResponse;
+	return {
+		id: cred.id,
+		rawId: toBase64url(cred.rawId),
+		type: cred.type,
+		response: {
+			clientDataJSON: toBase64url(response.clientDataJSON),
+			attestationObject: toBase64url(response.attestationObject),
+		},
+	};
+}
+
+// getPasskey runs navigator.credentials.get() with options from
+// /api/auth/login/passkey/options
+export async function getPasskey(options: {
+	publicKey: Omit<PublicKeyCredentialRequestOptions, "challenge" | "allowCredentials"> & {
+		challenge: string;
+		allowCredentials: Descriptor[];
+	};
+}) {
+	const { publicKey } = options;
+	const cred = (await navigator.credentials.get({
+		publicKey: {
+			...publicKey,
+			challenge: fromBase64url(publicKey.challenge),
+			allowCredentials: publicKey.allowCredentials.map((c) => ({ ...c, id: fromBase64url(c.id) })),
+		},
+	})) as PublicKeyCredential | null;
+	if (!cred) throw new Error("Passkey sign-in was cancelled");
+
+	const response = cred.response as AuthenticatorAssertionResponse;
+	return {
+		id: cred.id,
+		rawId: toBase64url(cred.rawId),
+		type: cred.type,
+		response: {
+			clientDataJSON: toBase64url(response.clientDataJSON),
+			authenticatorData: toBase64url(response.authenticatorData),
+			signature: toBase64url(response.signature),
+			userHandle: response.userHandle ? toBase64url(response.userHandle) : "",
+		},
+	};
+}
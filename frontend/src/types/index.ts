@@ -1,21 +1,56 @@
 export type Note = {
 	id: number;
 	title?: string;
+	slug?: string;
 	content?: string;
 	createdAt?: string;
 	updatedAt?: string;
 	isPrivate: boolean;
+	publishAt?: string;
+	publishedAt?: string;
+	tags?: string[];
 };
 
+export type Role = "admin" | "editor" | "author" | "viewer";
+
 export type User = {
 	id: number;
 	username: string;
+	role?: Role;
+};
+
+export type ProfileLink = {
+	label: string;
+	url: string;
+};
+
+export type AuthorProfile = {
+	id: number;
+	username: string;
+	displayName: string;
+	bio: string;
+	avatar: string;
+	links: ProfileLink[];
 };
 
+// LoginResult is "twoFactor" when the password was right but the account
+// needs a second factor to finish signing in
+export type LoginResult =
+	| { status: "ok" }
+	| { status: "failed" }
+	| { status: "throttled"; retryAfter: number }
+	| { status: "twoFactor"; challengeToken: string };
+
 export type AuthContextType = {
 	user: User | null;
 	token: string | null;
-	login: (username: string, password: string) => Promise<boolean>;
+	login: (username: string, password: string) => Promise<LoginResult>;
+	verifyTwoFactor: (
+		challengeToken: string,
+		code: string,
+		useRecoveryCode?: boolean,
+	) => Promise<boolean>;
+	loginWithPasskey: () => Promise<boolean>;
 	register: (username: string, password: string) => Promise<boolean>;
 	logout: () => void;
 	isAuthenticated: boolean;
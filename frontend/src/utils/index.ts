@@ -22,6 +22,10 @@ export const ensureArray = <T>(value: T[] | null | undefined): T[] => {
 	return value || [];
 };
 
+// Readers see when a post was published; editors see when it last changed
+export const noteDate = (note: Note, isAuthenticated: boolean): string | undefined =>
+	isAuthenticated ? note.updatedAt : note.publishedAt ?? note.updatedAt;
+
 export const formatDate = (dateString: string): string => {
 	return new Date(dateString).toLocaleDateString(undefined, {
 		year: "numeric",